@@ -0,0 +1,196 @@
+// Command ggcache-ctl inspects a running ggcache node through the admin
+// endpoints of its API server.
+//
+// Usage:
+//
+//	ggcache-ctl [-addr http://127.0.0.1:8000] [-group scores] ring [-vnodes]
+//	ggcache-ctl [-addr http://127.0.0.1:8000] [-group scores] explain key...
+//	ggcache-ctl [-addr http://127.0.0.1:8000] [-group scores] breakers
+//
+// With -cacert, an https address is verified against the given CAs, and
+// -cert and -key present a client certificate to servers requiring one.
+// -token sends a bearer token to servers requiring authentication.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache"
+)
+
+var (
+	addr  = flag.String("addr", "http://127.0.0.1:8000", "address of the node's API server")
+	group = flag.String("group", "", "cache group, the API server's own group if empty")
+
+	caFile   = flag.String("cacert", "", "PEM CAs verifying the API server, the system roots if empty")
+	certFile = flag.String("cert", "", "PEM client certificate, for API servers requiring one")
+	keyFile  = flag.String("key", "", "PEM private key of the client certificate")
+	token    = flag.String("token", "", "bearer token, for API servers requiring authentication")
+)
+
+var client = &http.Client{Timeout: 5 * time.Second}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if err := setupTLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "ggcache-ctl: %v\n", err)
+		os.Exit(1)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "ring":
+		err = ring(args)
+	case "explain":
+		err = explain(args)
+	case "breakers":
+		err = breakers()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ggcache-ctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: ggcache-ctl [flags] command [args]
+
+commands:
+  ring [-vnodes]   show the share of the hash ring each node owns
+  explain key...   show where keys land on the hash ring
+  breakers         show the circuit breakers of the peers
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+// ring prints the ownership of the hash ring, and its virtual nodes with -vnodes.
+func ring(args []string) error {
+	fs := flag.NewFlagSet("ring", flag.ExitOnError)
+	vnodes := fs.Bool("vnodes", false, "also list the virtual nodes in clockwise order")
+	fs.Parse(args)
+
+	var info cache.RingInfo
+	if err := get("/admin/ring", url.Values{"vnodes": {fmt.Sprint(*vnodes)}}, &info); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tVNODES\tSHARE\tIN-FLIGHT")
+	for _, n := range info.Nodes {
+		fmt.Fprintf(w, "%s\t%d\t%.2f%%\t%d\n", n.Node, n.VirtualNodes, n.Share*100, n.InFlight)
+	}
+	if *vnodes {
+		fmt.Fprintln(w, "\nINDEX\tHASH\tNODE\tREPLICA")
+		for i, v := range info.VirtualNodes {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%d\n", i, v.Hash, v.Node, v.Replica)
+		}
+	}
+	return w.Flush()
+}
+
+// explain prints where each key lands on the hash ring.
+func explain(keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("explain needs at least one key")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tHASH\tVNODE HASH\tINDEX\tREPLICA\tOWNER")
+	for _, key := range keys {
+		var p cache.KeyPlacement
+		if err := get("/admin/ring/explain", url.Values{"key": {key}}, &p); err != nil {
+			return err
+		}
+		index := fmt.Sprint(p.Index)
+		if p.Wrapped {
+			index += " (wrapped)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%s\n", p.Key, p.Hash, p.VirtualNode.Hash, index, p.VirtualNode.Replica, p.Owner)
+	}
+	return w.Flush()
+}
+
+// breakers prints the state of the circuit breaker of each peer.
+func breakers() error {
+	var stats []cache.BreakerStatus
+	if err := get("/admin/breakers", url.Values{}, &stats); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tSTATE\tFAILURES\tEJECTIONS\tOPEN FOR")
+	for _, s := range stats {
+		openFor := "-"
+		if s.OpenUntil != nil {
+			openFor = time.Until(*s.OpenUntil).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", s.Peer, s.State, s.Failures, s.Ejections, openFor)
+	}
+	return w.Flush()
+}
+
+// setupTLS configures the client with the CAs and certificate of the flags, if any.
+func setupTLS() error {
+	if *caFile == "" && *certFile == "" {
+		return nil
+	}
+	tlsConfig, err := cache.TLSConfig{
+		Enabled:    true,
+		CertFile:   *certFile,
+		KeyFile:    *keyFile,
+		CAFile:     *caFile,
+		ClientAuth: *certFile != "",
+	}.ClientTLS()
+	if err != nil {
+		return err
+	}
+	client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	return nil
+}
+
+// get fetches an admin endpoint for the selected group and decodes its JSON body into v.
+func get(path string, params url.Values, v any) error {
+	if *group != "" {
+		params.Set("group", *group)
+	}
+	u := strings.TrimSuffix(*addr, "/") + path + "?" + params.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -28,7 +28,7 @@ func main() {
 	gm := grpcservice.NewGroupManager([]string{"scores", "website"}, serviceAddr)
 
 	// get a grpc service instance
-	updateChan := make(chan struct{})
+	updateChan := make(chan struct{}, 1)
 	svr, err := grpcservice.NewServer(updateChan, serviceAddr)
 	if err != nil {
 		logger.LogrusObj.Errorf("acquire grpc server instance failed, %v", err)
@@ -38,12 +38,42 @@ func main() {
 	go discovery.DynamicServices(updateChan, config.Conf.Services["ggcache"].Name)
 
 	// Server implemented Pick interface, register a node selector for ggcache
-	peers, err := discovery.ListServicePeers(config.Conf.Services["ggcache"].Name)
+	peers, err := discovery.ListServiceWeights(config.Conf.Services["ggcache"].Name)
 	if err != nil {
-		peers = []string{"serviceAddr"}
+		peers = map[string]int{serviceAddr: discovery.DefaultWeight}
 	}
 
-	svr.SetPeers(peers)
+	if err := svr.SetPlacement(config.Conf.Services["ggcache"].Placement); err != nil {
+		logger.LogrusObj.Errorf("invalid placement, using %s: %v", grpcservice.DefaultPlacement, err)
+	}
+	svr.SetLoadBound(config.Conf.Services["ggcache"].LoadBound)
+	if d := config.Conf.Services["ggcache"].UpdateDebounce; d != 0 {
+		svr.SetUpdateDebounce(d)
+	}
+	if h := config.Conf.Services["ggcache"].Handoff; h != nil {
+		svr.SetHandoff(grpcservice.HandoffConfig{
+			Enabled:          h.Enabled,
+			EntriesPerSecond: h.EntriesPerSecond,
+			BytesPerSecond:   h.BytesPerSecond,
+			MaxEntries:       h.MaxEntries,
+		})
+	}
+	svr.SetClientConfig(grpcservice.ClientConfigFromConf(config.Conf.PeerClient))
+	if config.Conf.PeerClient != nil {
+		svr.SetBreaker(grpcservice.BreakerConfigFromConf(config.Conf.PeerClient.Breaker))
+	}
+	if config.Conf.TLS != nil {
+		if err := svr.SetTLSConfig(grpcservice.TLSConfigFromConf(config.Conf.TLS.Peer)); err != nil {
+			logger.LogrusObj.Fatalf("invalid peer TLS config: %v", err)
+		}
+	}
+	auth, err := grpcservice.AuthFromConf(config.Conf.Auth)
+	if err != nil {
+		logger.LogrusObj.Fatalf("invalid auth config: %v", err)
+	}
+	svr.SetAuth(auth)
+	svr.SetWeightedPeers(peers)
+	svr.SetWeight(config.Conf.Services["ggcache"].Weight)
 
 	gm["scores"].RegisterServer(svr)
 
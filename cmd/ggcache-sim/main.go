@@ -0,0 +1,140 @@
+// Command ggcache-sim replays a key-access trace against every registered
+// eviction strategy at several cache sizes and reports hit ratio,
+// byte hit ratio and throughput.
+//
+// Usage:
+//
+//	ggcache-sim -trace accesses.txt -sizes 1%,5%,10%,25% -csv results.csv
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"github.com/1055373165/ggcache/pkg/common/logger"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	tracePath  = flag.String("trace", "", "path of the key-access trace file")
+	format     = flag.String("format", "auto", "trace format: text, csv or auto (by file extension)")
+	sizes      = flag.String("sizes", "1%,5%,10%,25%,50%", "comma separated cache sizes in bytes (KB/MB/GB suffix) or percent of the trace footprint")
+	strategies = flag.String("strategies", strings.Join(eviction.Names(), ","), "comma separated eviction strategies to compare")
+	valueSize  = flag.Int("valueSize", 64, "value size in bytes for accesses without a size column")
+	csvPath    = flag.String("csv", "", "optional path of a CSV file to write the results to")
+)
+
+func main() {
+	flag.Parse()
+	if *tracePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Strategies log through logrus; keep the report readable.
+	logger.LogrusObj.SetLevel(logrus.ErrorLevel)
+
+	t, err := loadTrace(*tracePath, *format, *valueSize)
+	if err != nil {
+		log.Fatalf("Failed to load trace: %v", err)
+	}
+
+	cacheSizes, err := parseSizes(*sizes, t.footprint)
+	if err != nil {
+		log.Fatalf("Invalid sizes: %v", err)
+	}
+
+	// Values share one zeroed buffer; strategies only need their length.
+	maxSize := 0
+	for _, a := range t.accesses {
+		maxSize = max(maxSize, a.size)
+	}
+	values := make([]byte, maxSize)
+
+	var results []result
+	names := strings.Split(*strategies, ",")
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		for _, size := range cacheSizes {
+			r, err := simulate(t, name, size, values)
+			if err != nil {
+				log.Fatalf("Simulation of %s failed: %v", name, err)
+			}
+			results = append(results, r)
+		}
+	}
+
+	fmt.Printf("trace: %s, %d requests, %d unique keys, footprint %s\n\n",
+		*tracePath, len(t.accesses), t.uniqueKeys, formatBytes(t.footprint))
+	printTable(os.Stdout, "Hit ratio", results, cacheSizes, func(r result) string {
+		return fmt.Sprintf("%.2f%%", r.hitRatio()*100)
+	})
+	printTable(os.Stdout, "Byte hit ratio", results, cacheSizes, func(r result) string {
+		return fmt.Sprintf("%.2f%%", r.byteHitRatio()*100)
+	})
+	printTable(os.Stdout, "Throughput (ops/s)", results, cacheSizes, func(r result) string {
+		return strconv.FormatFloat(r.opsPerSec(), 'f', 0, 64)
+	})
+
+	if *csvPath != "" {
+		if err := writeCSV(*csvPath, results); err != nil {
+			log.Fatalf("Failed to write CSV: %v", err)
+		}
+		fmt.Printf("results written to %s\n", *csvPath)
+	}
+}
+
+// printTable prints one metric as a strategy by cache size table.
+func printTable(w io.Writer, title string, results []result, cacheSizes []int64, cell func(result) string) {
+	fmt.Fprintf(w, "%s\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprint(tw, "strategy\t")
+	for _, size := range cacheSizes {
+		fmt.Fprintf(tw, "%s\t", formatBytes(size))
+	}
+	fmt.Fprintln(tw)
+
+	for i := 0; i < len(results); i += len(cacheSizes) {
+		fmt.Fprintf(tw, "%s\t", results[i].strategy)
+		for _, r := range results[i : i+len(cacheSizes)] {
+			fmt.Fprintf(tw, "%s\t", cell(r))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// writeCSV writes one row per strategy and cache size for plotting.
+func writeCSV(path string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"strategy", "cache_bytes", "requests", "hits", "hit_ratio", "byte_hit_ratio", "ops_per_sec"})
+	for _, r := range results {
+		w.Write([]string{
+			r.strategy,
+			strconv.FormatInt(r.cacheBytes, 10),
+			strconv.Itoa(r.requests),
+			strconv.Itoa(r.hits),
+			strconv.FormatFloat(r.hitRatio(), 'f', 6, 64),
+			strconv.FormatFloat(r.byteHitRatio(), 'f', 6, 64),
+			strconv.FormatFloat(r.opsPerSec(), 'f', 0, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
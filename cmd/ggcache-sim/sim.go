@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+)
+
+// result holds the outcome of replaying a trace against one strategy and cache size.
+type result struct {
+	strategy   string
+	cacheBytes int64
+	requests   int
+	hits       int
+	bytes      int64 // bytes requested
+	hitBytes   int64 // bytes served from cache
+	elapsed    time.Duration
+}
+
+// hitRatio returns the fraction of requests served from cache.
+func (r result) hitRatio() float64 {
+	if r.requests == 0 {
+		return 0
+	}
+	return float64(r.hits) / float64(r.requests)
+}
+
+// byteHitRatio returns the fraction of requested bytes served from cache.
+func (r result) byteHitRatio() float64 {
+	if r.bytes == 0 {
+		return 0
+	}
+	return float64(r.hitBytes) / float64(r.bytes)
+}
+
+// opsPerSec returns the replay throughput in requests per second.
+func (r result) opsPerSec() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.requests) / r.elapsed.Seconds()
+}
+
+// simulate replays t against a fresh cache of the named strategy.
+// Every miss is followed by a Put, as Group.getLocally does, of a prefix of
+// values as long as the access size.
+func simulate(t *trace, strategy string, cacheBytes int64, values []byte) (result, error) {
+	evictionType, err := eviction.StringToEvictionType(strategy)
+	if err != nil {
+		return result{}, err
+	}
+	s, err := eviction.NewWithConfig(eviction.CacheConfig{
+		MaxBytes:     cacheBytes,
+		EvictionType: evictionType,
+		TTL:          24 * time.Hour,
+	}, nil)
+	if err != nil {
+		return result{}, err
+	}
+	if stopper, ok := s.(eviction.Stopper); ok {
+		defer stopper.Stop()
+	}
+
+	r := result{strategy: strategy, cacheBytes: cacheBytes, requests: len(t.accesses)}
+	start := time.Now()
+	for _, a := range t.accesses {
+		if a.size < 0 || a.size > len(values) {
+			return result{}, fmt.Errorf("access to %q has size %d, outside the %d byte values buffer", a.key, a.size, len(values))
+		}
+		r.bytes += int64(a.size)
+		if _, _, ok := s.Get(a.key); ok {
+			r.hits++
+			r.hitBytes += int64(a.size)
+			continue
+		}
+		s.Put(a.key, eviction.BytesValue(values[:a.size]))
+	}
+	r.elapsed = time.Since(start)
+	return r, nil
+}
+
+// parseSizes parses a comma separated list of cache sizes. Each size is a
+// byte count with an optional KB, MB or GB suffix, or a percentage of the
+// trace footprint such as "10%".
+func parseSizes(list string, footprint int64) ([]int64, error) {
+	var sizes []int64
+	for _, field := range strings.Split(list, ",") {
+		field = strings.ToUpper(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		if strings.HasSuffix(field, "%") {
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(field, "%"), 64)
+			if err != nil || pct <= 0 {
+				return nil, fmt.Errorf("invalid cache size %q", field)
+			}
+			sizes = append(sizes, max(int64(float64(footprint)*pct/100), 1))
+			continue
+		}
+
+		multiplier := int64(1)
+		for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+			if strings.HasSuffix(field, suffix) {
+				multiplier = m
+				field = strings.TrimSuffix(field, suffix)
+				break
+			}
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(field, "B"), 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid cache size %q", field)
+		}
+		sizes = append(sizes, n*multiplier)
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no cache sizes given")
+	}
+	return sizes, nil
+}
+
+// formatBytes renders n with a binary unit suffix.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
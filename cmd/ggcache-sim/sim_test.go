@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int64
+		wantErr bool
+	}{
+		{"1024,4KB,2MB", []int64{1024, 4 << 10, 2 << 20}, false},
+		{"10%, 50%", []int64{100, 500}, false},
+		{"1GB", []int64{1 << 30}, false},
+		{"abc", nil, true},
+		{"", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := parseSizes(tt.list, 1000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSizes(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseSizes(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseSizes(%q)[%d] = %d, want %d", tt.list, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	accesses, err := parseCSV(strings.NewReader("key,size\nk1,10\nk2\nk1,10\n"), 64)
+	if err != nil {
+		t.Fatalf("parseCSV returned error: %v", err)
+	}
+	want := []access{{"k1", 10}, {"k2", 64}, {"k1", 10}}
+	if len(accesses) != len(want) {
+		t.Fatalf("parseCSV returned %v, want %v", accesses, want)
+	}
+	for i := range want {
+		if accesses[i] != want[i] {
+			t.Errorf("access %d = %v, want %v", i, accesses[i], want[i])
+		}
+	}
+
+	if _, err := parseCSV(strings.NewReader("k1,10\nk2,big\n"), 64); err == nil {
+		t.Error("parseCSV should reject a non-numeric size after the first line")
+	}
+	if _, err := parseCSV(strings.NewReader("k1,-1\n"), 64); err == nil {
+		t.Error("parseCSV should reject a negative size")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	tr := &trace{accesses: []access{{"a", 4}, {"a", 4}, {"b", 4}, {"a", 4}}}
+	r, err := simulate(tr, "lfu", 1024, make([]byte, 4))
+	if err != nil {
+		t.Fatalf("simulate returned error: %v", err)
+	}
+	if r.hits != 2 || r.hitRatio() != 0.5 || r.byteHitRatio() != 0.5 {
+		t.Errorf("simulate hits = %d, hit ratio = %v, byte hit ratio = %v", r.hits, r.hitRatio(), r.byteHitRatio())
+	}
+
+	if _, err := simulate(tr, "lfu", 1024, make([]byte, 2)); err == nil {
+		t.Error("simulate should reject sizes larger than the values buffer")
+	}
+}
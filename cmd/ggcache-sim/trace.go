@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// access is a single request in a trace.
+type access struct {
+	key  string
+	size int // value size in bytes
+}
+
+// trace is a sequence of accesses together with its footprint.
+type trace struct {
+	accesses   []access
+	uniqueKeys int
+	footprint  int64 // total bytes of the distinct keys and their values
+}
+
+// loadTrace reads a trace file. Plain text traces hold one key per line;
+// CSV traces hold "key" or "key,size" records and may start with a header.
+// Accesses without a size use defaultSize.
+func loadTrace(path, format string, defaultSize int) (*trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+	defer f.Close()
+
+	if format == "auto" {
+		format = "text"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+
+	var accesses []access
+	switch format {
+	case "text":
+		accesses, err = parseText(f, defaultSize)
+	case "csv":
+		accesses, err = parseCSV(f, defaultSize)
+	default:
+		return nil, fmt.Errorf("invalid trace format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(accesses) == 0 {
+		return nil, fmt.Errorf("trace %s contains no accesses", path)
+	}
+
+	t := &trace{accesses: accesses}
+	seen := make(map[string]struct{})
+	for _, a := range accesses {
+		if _, ok := seen[a.key]; !ok {
+			seen[a.key] = struct{}{}
+			t.footprint += int64(len(a.key) + a.size)
+		}
+	}
+	t.uniqueKeys = len(seen)
+	return t, nil
+}
+
+// parseText reads one key per line, skipping blank lines and # comments.
+func parseText(r io.Reader, defaultSize int) ([]access, error) {
+	var accesses []access
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		accesses = append(accesses, access{key: key, size: defaultSize})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read trace: %w", err)
+	}
+	return accesses, nil
+}
+
+// parseCSV reads "key" or "key,size" records. A first record whose size
+// column is not a number is treated as a header.
+func parseCSV(r io.Reader, defaultSize int) ([]access, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var accesses []access
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read trace: %w", err)
+		}
+		if len(record) == 0 || record[0] == "" {
+			continue
+		}
+
+		a := access{key: record[0], size: defaultSize}
+		if len(record) > 1 && record[1] != "" {
+			size, err := strconv.Atoi(record[1])
+			if err != nil && line == 1 {
+				continue // header
+			}
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("line %d: invalid size %q", line, record[1])
+			}
+			a.size = size
+		}
+		accesses = append(accesses, a)
+	}
+	return accesses, nil
+}
@@ -19,6 +19,9 @@ type Config struct {
 	Services     map[string]*Service `yaml:"services"`
 	Domain       map[string]*Domain  `yaml:"domain"`
 	GroupManager *GroupManager       `yaml:"groupManager"`
+	PeerClient   *PeerClient         `yaml:"peerClient"`
+	TLS          *TLS                `yaml:"tls"`
+	Auth         *Auth               `yaml:"auth"`
 }
 
 type MySQL struct {
@@ -31,15 +34,80 @@ type MySQL struct {
 }
 
 type Etcd struct {
-	Address []string `yaml:"address"`
-	TTL     int      `yaml:"ttl"`
+	Address     []string      `yaml:"address"`
+	TTL         int           `yaml:"ttl"`
+	DialTimeout time.Duration `yaml:"dialTimeout"`
 }
 
 type Service struct {
-	Name        string   `yaml:"name"`
-	LoadBalance bool     `yaml:"loadBalance"`
-	Addr        []string `yaml:"addr"`
-	TTL         int      `yaml:"ttl"`
+	Name           string        `yaml:"name"`
+	LoadBalance    bool          `yaml:"loadBalance"`
+	Addr           []string      `yaml:"addr"`
+	TTL            int           `yaml:"ttl"`
+	Weight         int           `yaml:"weight"`
+	Placement      string        `yaml:"placement"`
+	LoadBound      float64       `yaml:"loadBound"`
+	UpdateDebounce time.Duration `yaml:"updateDebounce"`
+	Handoff        *Handoff      `yaml:"handoff"`
+}
+
+type Handoff struct {
+	Enabled          bool    `yaml:"enabled"`
+	EntriesPerSecond float64 `yaml:"entriesPerSecond"`
+	BytesPerSecond   float64 `yaml:"bytesPerSecond"`
+	MaxEntries       int     `yaml:"maxEntries"`
+}
+
+type PeerClient struct {
+	DialTimeout      time.Duration `yaml:"dialTimeout"`
+	RequestTimeout   time.Duration `yaml:"requestTimeout"`
+	KeepaliveTime    time.Duration `yaml:"keepaliveTime"`
+	KeepaliveTimeout time.Duration `yaml:"keepaliveTimeout"`
+	MaxMessageSize   int           `yaml:"maxMessageSize"`
+	BackoffBaseDelay time.Duration `yaml:"backoffBaseDelay"`
+	BackoffMaxDelay  time.Duration `yaml:"backoffMaxDelay"`
+
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int           `yaml:"maxConnsPerHost"`
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout"`
+
+	Breaker *Breaker `yaml:"breaker"`
+}
+
+type Breaker struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenTimeout      time.Duration `yaml:"openTimeout"`
+	MaxOpenTimeout   time.Duration `yaml:"maxOpenTimeout"`
+	HalfOpenRequests int           `yaml:"halfOpenRequests"`
+}
+
+type TLS struct {
+	Peer *TLSOptions `yaml:"peer"`
+	API  *TLSOptions `yaml:"api"`
+}
+
+type TLSOptions struct {
+	Enabled        bool          `yaml:"enabled"`
+	CertFile       string        `yaml:"certFile"`
+	KeyFile        string        `yaml:"keyFile"`
+	CAFile         string        `yaml:"caFile"`
+	ClientAuth     bool          `yaml:"clientAuth"`
+	ServerName     string        `yaml:"serverName"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+type Auth struct {
+	Enabled      bool          `yaml:"enabled"`
+	PeerSecret   string        `yaml:"peerSecret"`
+	MaxClockSkew time.Duration `yaml:"maxClockSkew"`
+	Tokens       []*AuthToken  `yaml:"tokens"`
+}
+
+type AuthToken struct {
+	Name   string            `yaml:"name"`
+	Token  string            `yaml:"token"`
+	Groups map[string]string `yaml:"groups"`
 }
 
 type Domain struct {
@@ -47,8 +115,40 @@ type Domain struct {
 }
 
 type GroupManager struct {
-	Strategy     string `yaml:"strategy"`
-	MaxCacheSize int64  `yaml:"maxCacheSize"`
+	Strategy        string        `yaml:"strategy"`
+	MaxCacheSize    int64         `yaml:"maxCacheSize"`
+	MaxEntries      int           `yaml:"maxEntries"`
+	SizeEstimator   string        `yaml:"sizeEstimator"`
+	TTL             time.Duration `yaml:"ttl"`
+	CleanupInterval time.Duration `yaml:"cleanupInterval"`
+	BatchSize       int           `yaml:"batchSize"`
+	AgingPeriod     time.Duration `yaml:"agingPeriod"`
+	AgingFactor     float64       `yaml:"agingFactor"`
+	Replicas        int           `yaml:"replicas"`
+	Shadow          *Shadow       `yaml:"shadow"`
+	// Compression of the values of each group, by group name
+	Compression map[string]*Compression `yaml:"compression"`
+	Hedge       *Hedge                  `yaml:"hedge"`
+}
+
+type Hedge struct {
+	Enabled     bool          `yaml:"enabled"`
+	Quantile    float64       `yaml:"quantile"`
+	MinDelay    time.Duration `yaml:"minDelay"`
+	MaxDelay    time.Duration `yaml:"maxDelay"`
+	BudgetRatio float64       `yaml:"budgetRatio"`
+	BudgetBurst float64       `yaml:"budgetBurst"`
+}
+
+type Shadow struct {
+	SampleRate float64   `yaml:"sampleRate"`
+	Sizes      []float64 `yaml:"sizes"`
+	Strategies []string  `yaml:"strategies"`
+}
+
+type Compression struct {
+	Codec   string `yaml:"codec"`
+	MinSize int    `yaml:"minSize"`
 }
 
 func InitConfig() {
@@ -71,9 +171,13 @@ func InitConfig() {
 }
 
 func InitClientV3Config() {
+	dialTimeout := Conf.Etcd.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = 5 * time.Second
+	}
 	DefaultEtcdConfig = clientv3.Config{
 		Endpoints:   Conf.Etcd.Address,
-		DialTimeout: 5 * time.Second,
+		DialTimeout: dialTimeout,
 	}
 }
 
@@ -6,6 +6,7 @@ toolchain go1.23.3
 
 require (
 	github.com/google/generative-ai-go v0.19.0
+	github.com/klauspost/compress v1.17.0
 	github.com/prometheus/client_golang v1.11.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.18.2
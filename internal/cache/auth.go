@@ -0,0 +1,418 @@
+package cache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1055373165/ggcache/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Access is a set of permissions on the keys of a group.
+type Access uint8
+
+const (
+	AccessRead  Access = 1 << iota // get keys
+	AccessWrite                    // set keys and change the group's settings
+)
+
+// anyGroup grants a principal access to every group.
+const anyGroup = "*"
+
+// ParseAccess parses "read", "write" or "read-write".
+func ParseAccess(s string) (Access, error) {
+	switch s {
+	case "read":
+		return AccessRead, nil
+	case "write":
+		return AccessWrite, nil
+	case "read-write":
+		return AccessRead | AccessWrite, nil
+	default:
+		return 0, fmt.Errorf("invalid access %q, want read, write or read-write", s)
+	}
+}
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	Name   string
+	Groups map[string]Access // access per group, "*" for every group
+}
+
+// Allowed reports whether the principal has the access need to group.
+func (p *Principal) Allowed(group string, need Access) bool {
+	if p == nil {
+		return false
+	}
+	return (p.Groups[group]|p.Groups[anyGroup])&need == need
+}
+
+// Authenticator identifies the principal behind a request.
+type Authenticator interface {
+	// Authenticate returns the principal of a request to resource whose
+	// headers are read by header. It returns nil and no error if the request
+	// carries no credentials of the authenticator's kind, and an error if
+	// it carries invalid ones.
+	Authenticate(resource string, header func(name string) string) (*Principal, error)
+}
+
+var (
+	_ Authenticator = TokenAuthenticator(nil)
+	_ Authenticator = (*PeerAuthenticator)(nil)
+)
+
+var (
+	errNoCredentials  = errors.New("missing credentials")
+	errBadCredentials = errors.New("invalid credentials")
+)
+
+// authorizationHeader carries the credentials of HTTP requests, and in lower
+// case those of gRPC requests in their metadata.
+const authorizationHeader = "Authorization"
+
+// TokenAuthenticator authenticates requests bearing a static token, by token.
+type TokenAuthenticator map[string]*Principal
+
+// Authenticate implements Authenticator for "Bearer <token>" credentials.
+func (ta TokenAuthenticator) Authenticate(resource string, header func(string) string) (*Principal, error) {
+	token, ok := strings.CutPrefix(header(authorizationHeader), "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+	var found *Principal
+	for t, p := range ta {
+		// Every token is compared so that the time taken does not reveal which one matched.
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			found = p
+		}
+	}
+	if found == nil {
+		return nil, errBadCredentials
+	}
+	return found, nil
+}
+
+// peerScheme is the authorization scheme of requests signed by peers.
+const peerScheme = "GGCache-HMAC "
+
+// defaultMaxClockSkew is how far the timestamp of a signed request may be from the local clock.
+const defaultMaxClockSkew = 5 * time.Minute
+
+// PeerAuthenticator authenticates the requests of peers, signed with an
+// HMAC-SHA256 of a secret shared by the nodes over the request's resource
+// and time. Peers get read and write access to every group.
+//
+// The signature does not cover request bodies: peer traffic should also use
+// TLS, which protects their integrity. gRPC streams are signed by method
+// alone, so they are refused from peers connecting without TLS.
+type PeerAuthenticator struct {
+	secret       []byte
+	maxClockSkew time.Duration
+	principal    *Principal
+}
+
+// NewPeerAuthenticator returns an authenticator of peers sharing secret that
+// accepts signatures made at most maxClockSkew away from now, 5 minutes if
+// maxClockSkew is not positive.
+func NewPeerAuthenticator(secret string, maxClockSkew time.Duration) *PeerAuthenticator {
+	if maxClockSkew <= 0 {
+		maxClockSkew = defaultMaxClockSkew
+	}
+	return &PeerAuthenticator{
+		secret:       []byte(secret),
+		maxClockSkew: maxClockSkew,
+		principal:    &Principal{Name: "peer", Groups: map[string]Access{anyGroup: AccessRead | AccessWrite}},
+	}
+}
+
+// Authenticate implements Authenticator for "GGCache-HMAC <unix time>:<hex signature>" credentials.
+func (pa *PeerAuthenticator) Authenticate(resource string, header func(string) string) (*Principal, error) {
+	creds, ok := strings.CutPrefix(header(authorizationHeader), peerScheme)
+	if !ok {
+		return nil, nil
+	}
+	ts, sig, ok := strings.Cut(creds, ":")
+	if !ok {
+		return nil, errBadCredentials
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errBadCredentials
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > pa.maxClockSkew || skew < -pa.maxClockSkew {
+		return nil, fmt.Errorf("signature time %s is too far from the local clock", ts)
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, pa.mac(unix, resource)) {
+		return nil, errBadCredentials
+	}
+	return pa.principal, nil
+}
+
+// sign returns the credentials of a request of this node to resource made now.
+func (pa *PeerAuthenticator) sign(resource string) string {
+	now := time.Now().Unix()
+	return peerScheme + strconv.FormatInt(now, 10) + ":" + hex.EncodeToString(pa.mac(now, resource))
+}
+
+func (pa *PeerAuthenticator) mac(unix int64, resource string) []byte {
+	m := hmac.New(sha256.New, pa.secret)
+	fmt.Fprintf(m, "%d\n%s", unix, resource)
+	return m.Sum(nil)
+}
+
+// Auth authenticates requests with a chain of authenticators, the first one
+// recognizing the credentials of a request deciding, and authorizes them by
+// the group access of the principal.
+type Auth struct {
+	authenticators []Authenticator
+	peer           *PeerAuthenticator // signs the requests of this node, nil if peers are not authenticated
+}
+
+// NewAuth returns an Auth trying peer, if not nil, then the other authenticators in order.
+// The requests of this node to its peers are signed by peer.
+func NewAuth(peer *PeerAuthenticator, others ...Authenticator) *Auth {
+	a := &Auth{peer: peer}
+	if peer != nil {
+		a.authenticators = append(a.authenticators, peer)
+	}
+	a.authenticators = append(a.authenticators, others...)
+	return a
+}
+
+// AuthFromConf builds the Auth of the auth section of the configuration, or
+// returns nil if the section is missing or disabled.
+func AuthFromConf(ac *config.Auth) (*Auth, error) {
+	if ac == nil || !ac.Enabled {
+		return nil, nil
+	}
+
+	tokens := make(TokenAuthenticator, len(ac.Tokens))
+	for _, t := range ac.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("auth token %s is empty", t.Name)
+		}
+		p := &Principal{Name: t.Name, Groups: make(map[string]Access, len(t.Groups))}
+		for group, s := range t.Groups {
+			access, err := ParseAccess(s)
+			if err != nil {
+				return nil, fmt.Errorf("auth token %s, group %s: %w", t.Name, group, err)
+			}
+			p.Groups[group] = access
+		}
+		tokens[t.Token] = p
+	}
+
+	var peer *PeerAuthenticator
+	if ac.PeerSecret != "" {
+		peer = NewPeerAuthenticator(ac.PeerSecret, ac.MaxClockSkew)
+	}
+	return NewAuth(peer, tokens), nil
+}
+
+// authenticate returns the principal of a request, or an error if it has no
+// valid credentials.
+func (a *Auth) authenticate(resource string, header func(string) string) (*Principal, error) {
+	for _, au := range a.authenticators {
+		p, err := au.Authenticate(resource, header)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, errNoCredentials
+}
+
+// Middleware returns a handler serving the requests to next whose principal
+// has the access to the group that target returns for the request. Requests
+// without valid credentials get 401 and those without the access 403.
+// A nil Auth returns next.
+func (a *Auth) Middleware(next http.Handler, target func(r *http.Request) (group string, need Access)) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(httpResource(r.Method, r.URL.RequestURI()), r.Header.Get)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ggcache"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if group, need := target(r); !p.Allowed(group, need) {
+			http.Error(w, fmt.Sprintf("%s may not access group %s", p.Name, group), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpResource is the resource of an HTTP request signed by peers.
+func httpResource(method, requestURI string) string {
+	return method + " " + requestURI
+}
+
+// signHTTP adds the peer credentials of this node to req, if peers are authenticated.
+func (a *Auth) signHTTP(req *http.Request) {
+	if a != nil && a.peer != nil {
+		req.Header.Set(authorizationHeader, a.peer.sign(httpResource(req.Method, req.URL.RequestURI())))
+	}
+}
+
+// grouped is implemented by the gRPC messages naming the group they access.
+type grouped interface {
+	GetGroup() string
+}
+
+// keyed is implemented by the gRPC messages naming the key they access.
+type keyed interface {
+	GetKey() string
+}
+
+// grpcResource is the resource of a gRPC request signed by peers: the method
+// and, for unary calls, the group and key of the request, so that a captured
+// signature cannot be replayed for other keys.
+func grpcResource(fullMethod string, req any) string {
+	g, ok := req.(grouped)
+	if !ok {
+		return fullMethod
+	}
+	resource := fullMethod + " " + strconv.Quote(g.GetGroup())
+	if k, ok := req.(keyed); ok {
+		resource += " " + strconv.Quote(k.GetKey())
+	}
+	return resource
+}
+
+// methodAccess returns the access a gRPC method needs to the group of its messages.
+func methodAccess(fullMethod string) Access {
+	if strings.HasSuffix(fullMethod, "/Get") {
+		return AccessRead
+	}
+	return AccessWrite
+}
+
+// authenticateGRPC returns the principal of the gRPC request of ctx to resource.
+func (a *Auth) authenticateGRPC(ctx context.Context, resource string) (*Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	p, err := a.authenticate(resource, func(name string) string {
+		if v := md.Get(strings.ToLower(name)); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return p, nil
+}
+
+// authorizeGRPC returns an error unless p has the access fullMethod needs to the group of msg.
+func authorizeGRPC(p *Principal, fullMethod string, msg any) error {
+	if g, ok := msg.(grouped); ok && !p.Allowed(g.GetGroup(), methodAccess(fullMethod)) {
+		return status.Errorf(codes.PermissionDenied, "%s may not access group %s", p.Name, g.GetGroup())
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that authenticates each
+// call and authorizes it by the group of its request.
+func (a *Auth) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		p, err := a.authenticateGRPC(ctx, grpcResource(info.FullMethod, req))
+		if err != nil {
+			return nil, err
+		}
+		if err := authorizeGRPC(p, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that authenticates each
+// stream and authorizes each message received by its group. Streams signed
+// by peers are refused over connections without TLS, as their signature
+// covers the method only.
+func (a *Auth) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		p, err := a.authenticateGRPC(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if a.peer != nil && p == a.peer.principal && !overTLS(ss.Context()) {
+			return status.Error(codes.Unauthenticated, "peer streams require TLS")
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, principal: p, fullMethod: info.FullMethod})
+	}
+}
+
+// authorizedStream rejects the messages of a stream whose group its principal may not access.
+type authorizedStream struct {
+	grpc.ServerStream
+	principal  *Principal
+	fullMethod string
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return authorizeGRPC(s.principal, s.fullMethod, m)
+}
+
+// overTLS reports whether the gRPC request of ctx came over TLS.
+func overTLS(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	_, ok = p.AuthInfo.(credentials.TLSInfo)
+	return ok
+}
+
+// dialOptions returns the gRPC dial options signing the calls of this node
+// to its peers, none if peers are not authenticated. Unary calls are signed
+// over their group and key, streams over their method.
+func (a *Auth) dialOptions() []grpc.DialOption {
+	if a == nil || a.peer == nil {
+		return nil
+	}
+	sign := func(ctx context.Context, resource string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, strings.ToLower(authorizationHeader), a.peer.sign(resource))
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(sign(ctx, grpcResource(method, req)), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(sign(ctx, method), desc, cc, method, opts...)
+		}),
+	}
+}
+
+// serverOptions returns the gRPC server options enforcing a, none if a is nil.
+func (a *Auth) serverOptions() []grpc.ServerOption {
+	if a == nil {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(a.StreamServerInterceptor()),
+	}
+}
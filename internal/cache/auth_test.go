@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"github.com/1055373165/ggcache/config"
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testAuth authenticates peers sharing "secret" and the tokens "reader",
+// which may read group "scores", and "admin", which may read and write any group.
+func testAuth(t *testing.T) *Auth {
+	t.Helper()
+	a, err := AuthFromConf(&config.Auth{
+		Enabled:    true,
+		PeerSecret: "secret",
+		Tokens: []*config.AuthToken{
+			{Name: "reader", Token: "reader", Groups: map[string]string{"scores": "read"}},
+			{Name: "admin", Token: "admin", Groups: map[string]string{"*": "read-write"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("AuthFromConf returned error: %v", err)
+	}
+	return a
+}
+
+func TestPeerAuthenticator(t *testing.T) {
+	pa := NewPeerAuthenticator("secret", time.Minute)
+	header := func(v string) func(string) string {
+		return func(string) string { return v }
+	}
+
+	if p, err := pa.Authenticate("GET /x", header(pa.sign("GET /x"))); err != nil || p == nil {
+		t.Errorf("Authenticate of a signed request = %v, %v, want the peer", p, err)
+	}
+	if _, err := pa.Authenticate("GET /y", header(pa.sign("GET /x"))); err == nil {
+		t.Error("a signature of another resource should be rejected")
+	}
+	if _, err := NewPeerAuthenticator("other", time.Minute).Authenticate("GET /x", header(pa.sign("GET /x"))); err == nil {
+		t.Error("a signature with another secret should be rejected")
+	}
+
+	old := time.Now().Add(-time.Hour).Unix()
+	stale := peerScheme + strconv.FormatInt(old, 10) + ":" + hex.EncodeToString(pa.mac(old, "GET /x"))
+	if _, err := pa.Authenticate("GET /x", header(stale)); err == nil {
+		t.Error("a signature older than the clock skew should be rejected")
+	}
+
+	if p, err := pa.Authenticate("GET /x", header("Bearer token")); p != nil || err != nil {
+		t.Errorf("Authenticate of other credentials = %v, %v, want neither", p, err)
+	}
+}
+
+func TestAuth_Middleware(t *testing.T) {
+	NewGroupWithConfig("scores", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			return []byte("db-" + key), nil
+		}))
+	t.Cleanup(func() { DestroyGroup("scores") })
+
+	auth := testAuth(t)
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(auth.Middleware(pool, pool.access))
+	defer srv.Close()
+
+	signed := newHTTPFetcher(srv.URL+defaultBasePath, DefaultClientConfig.httpClient(), ClientConfig{Auth: auth}.withDefaults())
+	if _, err := signed.Fetch("scores", "k"); err != nil {
+		t.Errorf("Fetch signed by a peer returned error: %v", err)
+	}
+	if err := signed.Set("scores", "k", []byte("v")); err != nil {
+		t.Errorf("Set signed by a peer returned error: %v", err)
+	}
+
+	unsigned := newHTTPFetcher(srv.URL+defaultBasePath, DefaultClientConfig.httpClient(), DefaultClientConfig)
+	if _, err := unsigned.Fetch("scores", "k"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unsigned Fetch = %v, want 401", err)
+	}
+
+	tests := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"reader", http.MethodGet, "/_ggcache/scores/k", http.StatusOK},
+		{"reader", http.MethodGet, "/_ggcache/website/k", http.StatusForbidden},
+		{"reader", http.MethodPut, "/_ggcache/scores/k", http.StatusForbidden},
+		{"wrong", http.MethodGet, "/_ggcache/scores/k", http.StatusUnauthorized},
+		{"admin", http.MethodPut, "/_ggcache/scores/k", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.want {
+			t.Errorf("%s %s with token %s = %d, want %d", tt.method, tt.path, tt.token, res.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestAuth_GRPC(t *testing.T) {
+	auth := testAuth(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcServer := grpc.NewServer(auth.serverOptions()...)
+	pb.RegisterGroupCacheServer(grpcServer, &addrServer{addr: lis.Addr().String()})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	peer, err := NewClient(lis.Addr().String(), ClientConfig{Auth: auth})
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	defer peer.Close()
+	if _, err := peer.Fetch("website", "k"); err != nil {
+		t.Errorf("Fetch signed by a peer returned error: %v", err)
+	}
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient returned error: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewGroupCacheClient(conn)
+
+	tests := []struct {
+		authorization, group string
+		want                 codes.Code
+	}{
+		{"", "scores", codes.Unauthenticated},
+		{"Bearer reader", "scores", codes.OK},
+		{"Bearer reader", "website", codes.PermissionDenied},
+		{peerScheme + "0:00", "scores", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+		}
+		_, err := client.Get(ctx, &pb.GetRequest{Group: tt.group, Key: "k"})
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("Get of %s with %q = %v, want %v", tt.group, tt.authorization, got, tt.want)
+		}
+	}
+
+	// A peer signature covers the group and key, so it cannot be replayed for another key.
+	req := &pb.GetRequest{Group: "website", Key: "k"}
+	signed := auth.peer.sign(grpcResource("/groupcachepb.GroupCache/Get", req))
+	for key, want := range map[string]codes.Code{"k": codes.OK, "other": codes.Unauthenticated} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", signed)
+		_, err := client.Get(ctx, &pb.GetRequest{Group: "website", Key: key})
+		if got := status.Code(err); got != want {
+			t.Errorf("Get of key %s signed for k = %v, want %v", key, got, want)
+		}
+	}
+
+	// Streams are signed by method only, so peers may not open them without TLS.
+	stream, err := peer.handoff(context.Background())
+	if err == nil {
+		_, err = stream.CloseAndRecv()
+	}
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("Handoff signed by a peer without TLS = %v, want %v", err, codes.Unauthenticated)
+	}
+}
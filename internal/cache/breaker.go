@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/metrics"
+	"github.com/1055373165/ggcache/pkg/common/logger"
+	"gorm.io/gorm"
+)
+
+var (
+	_ Fetcher     = breakerFetcher{}
+	_ Setter      = breakerFetcher{}
+	_ viewFetcher = breakerFetcher{}
+
+	_ breakerReporter = (*Server)(nil)
+	_ breakerReporter = (*HTTPPool)(nil)
+
+	_ writeReplicaPicker = (*Server)(nil)
+	_ writeReplicaPicker = (*HTTPPool)(nil)
+)
+
+// breakerReporter is implemented by Pickers that guard their peers with circuit breakers.
+type breakerReporter interface {
+	// breakerStats returns the state of the breakers, nil if they are disabled.
+	breakerStats() []BreakerStatus
+}
+
+// errPeerEjected is returned for requests to a peer whose circuit breaker is open.
+var errPeerEjected = errors.New("peer ejected by its circuit breaker")
+
+// BreakerConfig configures the circuit breakers that eject failing peers
+// from routing.
+//
+// A breaker starts closed. After FailureThreshold consecutive failed requests
+// it opens: the peer is ejected and its keys are loaded locally without
+// waiting for it. Once the ejection ends the breaker is half-open and lets
+// HalfOpenRequests probes through. A successful probe closes it, a failed one
+// ejects the peer again for twice as long, up to MaxOpenTimeout.
+// A peer reporting that a key does not exist has not failed.
+type BreakerConfig struct {
+	Enabled          bool
+	FailureThreshold int           // consecutive failures that open the breaker, 5 if zero
+	OpenTimeout      time.Duration // first ejection of a peer, 5s if zero
+	MaxOpenTimeout   time.Duration // longest ejection, 1m if zero
+	HalfOpenRequests int           // probes let through at once while half-open, 1 if zero
+}
+
+// withDefaults returns c with its zero fields set to their defaults.
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 5 * time.Second
+	}
+	if c.MaxOpenTimeout <= 0 {
+		c.MaxOpenTimeout = time.Minute
+	}
+	c.MaxOpenTimeout = max(c.MaxOpenTimeout, c.OpenTimeout)
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	return c
+}
+
+// BreakerStatus is the state of the circuit breaker of a peer.
+type BreakerStatus struct {
+	Peer      string     `json:"peer"`
+	State     string     `json:"state"`               // "closed", "half-open" or "open"
+	Failures  int        `json:"failures"`            // consecutive failures while closed
+	Ejections int        `json:"ejections"`           // consecutive ejections since the breaker last closed
+	OpenUntil *time.Time `json:"openUntil,omitempty"` // end of the ejection while open
+}
+
+// breakerState is the state of a circuit breaker.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is the circuit breaker of a peer. A nil breaker lets every request through.
+type breaker struct {
+	peer string
+	cfg  BreakerConfig
+
+	mu         sync.Mutex
+	state      breakerState
+	generation uint64 // incremented on every state change
+	failures   int
+	ejections  int
+	openUntil  time.Time
+	probes     int // probes in flight while half-open
+}
+
+// available reports whether requests may be routed to the peer, without
+// reserving a probe.
+func (b *breaker) available() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return !time.Now().Before(b.openUntil)
+	case breakerHalfOpen:
+		return b.probes < b.cfg.HalfOpenRequests
+	}
+	return true
+}
+
+// allow returns an error wrapping errPeerEjected if a request to the peer
+// must fail fast. Otherwise the request must be reported to done with the
+// returned generation, which tells whether it was a probe.
+func (b *breaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if wait := time.Until(b.openUntil); wait > 0 {
+			return 0, fmt.Errorf("%w: %s for another %v", errPeerEjected, b.peer, wait.Round(time.Millisecond))
+		}
+		b.setState(breakerHalfOpen)
+		b.probes = 0
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return 0, fmt.Errorf("%w: %s is being probed", errPeerEjected, b.peer)
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// done records the outcome of a request allowed by allow in generation.
+// Only requests allowed in the current state change it: a request allowed
+// while closed that ends after the breaker opened is not a probe.
+func (b *breaker) done(generation uint64, err error) {
+	if b == nil {
+		return
+	}
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case breakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.open(err)
+		}
+	case breakerHalfOpen:
+		b.probes = max(b.probes-1, 0)
+		if failed {
+			b.open(err)
+			return
+		}
+		b.failures, b.ejections = 0, 0
+		b.setState(breakerClosed)
+		logger.LogrusObj.Infof("peer %s recovered, closing its circuit breaker", b.peer)
+	}
+}
+
+// open ejects the peer, for twice as long as last time if it has not
+// recovered since. Caller must hold the lock.
+func (b *breaker) open(err error) {
+	timeout := b.cfg.OpenTimeout
+	for i := 0; i < b.ejections && timeout < b.cfg.MaxOpenTimeout; i++ {
+		timeout *= 2
+	}
+	timeout = min(timeout, b.cfg.MaxOpenTimeout)
+
+	b.ejections++
+	b.failures = 0
+	b.openUntil = time.Now().Add(timeout)
+	b.setState(breakerOpen)
+	logger.LogrusObj.Warnf("ejecting peer %s for %v: %v", b.peer, timeout, err)
+}
+
+// setState moves the breaker to state. Caller must hold the lock.
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	b.generation++
+	metrics.RecordBreakerState(b.peer, state.String(), int(state))
+}
+
+// status returns the state of the breaker.
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{
+		Peer:      b.peer,
+		State:     b.state.String(),
+		Failures:  b.failures,
+		Ejections: b.ejections,
+	}
+	if b.state == breakerOpen {
+		openUntil := b.openUntil
+		s.OpenUntil = &openUntil
+	}
+	return s
+}
+
+// wrap returns f with its requests guarded by the breaker.
+func (b *breaker) wrap(f Fetcher) Fetcher {
+	if b == nil {
+		return f
+	}
+	return breakerFetcher{Fetcher: f, breaker: b}
+}
+
+// breakerSet holds the circuit breakers of the peers of a Picker.
+// A nil breakerSet disables them.
+type breakerSet struct {
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// newBreakerSet returns the breakers configured by cfg, or nil if they are disabled.
+func newBreakerSet(cfg BreakerConfig) *breakerSet {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &breakerSet{cfg: cfg.withDefaults(), breakers: make(map[string]*breaker)}
+}
+
+// get returns the breaker of peer, creating it closed if needed.
+func (s *breakerSet) get(peer string) *breaker {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[peer]
+	if !ok {
+		b = &breaker{peer: peer, cfg: s.cfg}
+		s.breakers[peer] = b
+		metrics.RecordBreakerState(peer, breakerClosed.String(), int(breakerClosed))
+	}
+	return b
+}
+
+// retain forgets the breakers of the peers not in peers.
+func (s *breakerSet) retain(peers map[string]int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for peer := range s.breakers {
+		if _, ok := peers[peer]; !ok {
+			delete(s.breakers, peer)
+			metrics.DeleteBreakerState(peer)
+		}
+	}
+}
+
+// stats returns the state of the breakers in order of peer, or nil if they are disabled.
+func (s *breakerSet) stats() []BreakerStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	breakers := make([]*breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	stats := make([]BreakerStatus, len(breakers))
+	for i, b := range breakers {
+		stats[i] = b.status()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Peer < stats[j].Peer })
+	return stats
+}
+
+// breakerFetcher fails requests to an ejected peer fast and reports the
+// outcome of the others to the peer's breaker.
+type breakerFetcher struct {
+	Fetcher
+	breaker *breaker
+}
+
+// Fetch fetches from the peer unless it is ejected.
+func (f breakerFetcher) Fetch(group string, key string) ([]byte, error) {
+	generation, err := f.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.Fetcher.Fetch(group, key)
+	f.breaker.done(generation, err)
+	return b, err
+}
+
+// Set stores the value on the peer unless it is ejected.
+func (f breakerFetcher) Set(group string, key string, value []byte) error {
+	setter, ok := f.Fetcher.(Setter)
+	if !ok {
+		return fmt.Errorf("peer does not support set")
+	}
+	generation, err := f.breaker.allow()
+	if err != nil {
+		return err
+	}
+	err = setter.Set(group, key, value)
+	f.breaker.done(generation, err)
+	return err
+}
+
+// fetchView fetches from the peer with the expiration time if it reports it,
+// unless the peer is ejected.
+func (f breakerFetcher) fetchView(group string, key string) (ByteView, error) {
+	vf, ok := f.Fetcher.(viewFetcher)
+	if !ok {
+		b, err := f.Fetch(group, key)
+		return ByteView{b: b}, err
+	}
+	generation, err := f.breaker.allow()
+	if err != nil {
+		return ByteView{}, err
+	}
+	view, err := vf.fetchView(group, key)
+	f.breaker.done(generation, err)
+	return view, err
+}
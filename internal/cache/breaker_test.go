@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"gorm.io/gorm"
+)
+
+func TestBreaker(t *testing.T) {
+	set := newBreakerSet(BreakerConfig{Enabled: true, FailureThreshold: 2, OpenTimeout: 10 * time.Millisecond, MaxOpenTimeout: 15 * time.Millisecond})
+	b := set.get("peer")
+	fail := errors.New("timeout")
+	request := func(err error) error {
+		generation, allowErr := b.allow()
+		if allowErr != nil {
+			return allowErr
+		}
+		b.done(generation, err)
+		return nil
+	}
+
+	// Missing keys and isolated failures keep the breaker closed.
+	request(fail)
+	request(gorm.ErrRecordNotFound)
+	request(fail)
+	if got := b.status().State; got != "closed" {
+		t.Fatalf("state after non-consecutive failures = %s, want closed", got)
+	}
+
+	// A request allowed while closed that fails after the breaker opened is not a probe.
+	late, _ := b.allow()
+	request(fail)
+	if got := b.status(); got.State != "open" || got.OpenUntil == nil {
+		t.Fatalf("status after %d consecutive failures = %+v, want open", 2, got)
+	}
+	if b.available() {
+		t.Error("an open breaker should not be available")
+	}
+	if err := request(nil); !errors.Is(err, errPeerEjected) {
+		t.Errorf("request to an ejected peer = %v, want errPeerEjected", err)
+	}
+
+	// Once the ejection ends a single probe goes through; its failure ejects the peer for longer.
+	time.Sleep(15 * time.Millisecond)
+	if !b.available() {
+		t.Fatal("breaker should be available once the ejection ends")
+	}
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("probe returned error: %v", err)
+	}
+	if _, err := b.allow(); !errors.Is(err, errPeerEjected) {
+		t.Errorf("second probe = %v, want errPeerEjected", err)
+	}
+	b.done(late, nil)
+	if got := b.status().State; got != "half-open" {
+		t.Fatalf("state after a request from before the ejection = %s, want half-open", got)
+	}
+	failed := time.Now()
+	b.done(probe, fail)
+	if got := b.status(); got.State != "open" || got.Ejections != 2 || got.OpenUntil.Sub(failed) <= 10*time.Millisecond {
+		t.Errorf("status after a failed probe = %+v, want open for 15ms", got)
+	}
+
+	// A successful probe closes the breaker.
+	time.Sleep(20 * time.Millisecond)
+	if err := request(nil); err != nil {
+		t.Fatalf("probe returned error: %v", err)
+	}
+	if got := b.status(); got.State != "closed" || got.Ejections != 0 {
+		t.Errorf("status after a successful probe = %+v, want closed", got)
+	}
+
+	set.retain(map[string]int{"other": 1})
+	if got := set.stats(); len(got) != 0 {
+		t.Errorf("stats after the peer left = %+v, want none", got)
+	}
+}
+
+func TestHTTPPool_Breaker(t *testing.T) {
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer sick.Close()
+
+	pool := NewHTTPPool("self")
+	pool.SetBreaker(BreakerConfig{Enabled: true, FailureThreshold: 1, OpenTimeout: time.Minute})
+	pool.UpdatePeers("self", sick.URL)
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.Pick(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+
+	peer, _ := pool.Pick(key)
+	if _, err := peer.Fetch("group", key); err == nil {
+		t.Fatal("Fetch from a failing peer should fail")
+	}
+	if _, ok := pool.Pick(key); ok {
+		t.Error("Pick should handle the keys of an ejected peer locally")
+	}
+	if replicas := pool.PickReplicas(key, 2); len(replicas) != 1 || replicas[0] != nil {
+		t.Errorf("PickReplicas = %v, want the current node only", replicas)
+	}
+
+	// Writes are not routed around the ejected peer: they fail on it.
+	g := NewGroupWithConfig("breaker-set", eviction.CacheConfig{MaxBytes: 1 << 10, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) { return nil, gorm.ErrRecordNotFound }))
+	defer DestroyGroup("breaker-set")
+	g.RegisterServer(pool)
+	g.SetReplicas(2)
+	if err := g.Set(key, []byte("v")); !errors.Is(err, errPeerEjected) {
+		t.Errorf("Set with an ejected replica = %v, want errPeerEjected", err)
+	}
+
+	stats := pool.breakerStats()
+	if len(stats) != 1 || stats[0].Peer != sick.URL || stats[0].State != "open" {
+		t.Errorf("breakerStats = %+v, want %s open", stats, sick.URL)
+	}
+}
@@ -1,33 +1,64 @@
 // Package cache implements a distributed cache system with various features.
 package cache
 
-import "time"
+import (
+	"time"
+
+	"github.com/1055373165/ggcache/pkg/common/logger"
+)
 
 // ByteView holds an immutable view of bytes.
+// The bytes may be stored compressed, in which case they are decompressed
+// by ByteSlice, String and Bytes.
 type ByteView struct {
 	b        []byte    // Actual bytes stored
 	expireAt time.Time // 过期时间，零值表示永不过期
+	codec    codec     // codec b is compressed with, nil if it is not
 }
 
-// Len returns the view's length.
+// Len returns the view's length as stored, compressed or not.
 func (v ByteView) Len() int {
 	return len(v.b)
 }
 
 // ByteSlice returns a copy of the data as a byte slice.
 func (v ByteView) ByteSlice() []byte {
+	if v.codec != nil {
+		return v.Bytes()
+	}
 	return cloneBytes(v.b)
 }
 
 // String returns the data as a string, making a copy if necessary.
 func (v ByteView) String() string {
-	return string(v.b)
+	return string(v.Bytes())
 }
 
-// Bytes returns the underlying byte slice.
+// Bytes returns the underlying byte slice, or the decompressed bytes if the
+// view is compressed. Bytes that cannot be decompressed read as nil; values
+// received from other nodes are checked with decode before they are cached.
 // Note: The returned slice should not be modified.
 func (v ByteView) Bytes() []byte {
-	return v.b
+	b, err := v.decode()
+	if err != nil {
+		logger.LogrusObj.Errorf("failed to decompress %s value: %v", v.codec.Name(), err)
+		return nil
+	}
+	return b
+}
+
+// decode returns the underlying byte slice, or the decompressed bytes if the
+// view is compressed, and an error if they cannot be decompressed.
+func (v ByteView) decode() ([]byte, error) {
+	if v.codec == nil {
+		return v.b, nil
+	}
+	return v.codec.Decode(v.b)
+}
+
+// ExpireAt returns when the value expires, the zero time if it never does.
+func (v ByteView) ExpireAt() time.Time {
+	return v.expireAt
 }
 
 // IsExpired 检查值是否已过期
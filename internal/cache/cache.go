@@ -2,9 +2,11 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/1055373165/ggcache/internal/cache/eviction"
 	"github.com/1055373165/ggcache/internal/metrics"
@@ -14,34 +16,81 @@ import (
 // cache represents a concurrent-safe cache that supports different eviction strategies.
 // The zero value for cache is not usable; use NewCache to create a cache.
 type cache struct {
-	mu       sync.RWMutex // protects strategy
-	strategy eviction.CacheStrategy
-	maxBytes int64
+	mu        sync.RWMutex // protects strategy, cfg and the fields of a strategy switch
+	strategy  eviction.CacheStrategy
+	cfg       eviction.CacheConfig
+	onEvicted func(key string, val eviction.Value)
+	maxBytes  int64
+
+	// While entries are moved to a new strategy, puts go to both strategies
+	// and their keys are recorded so that older copies are not moved over them.
+	next  eviction.CacheStrategy
+	dirty map[string]struct{}
+
+	shadows *shadowSet // nil unless shadow caches are enabled
 }
 
+// migrateBatchSize is the number of entries moved to a new strategy per lock acquisition.
+const migrateBatchSize = 256
+
+// errSwitchInProgress is returned when a strategy switch is requested during another one.
+var errSwitchInProgress = errors.New("strategy switch already in progress")
+
 // NewCache creates a new cache with the specified eviction strategy and maximum size in bytes.
 // It returns an error if the strategy is invalid or if maxBytes is not positive.
 func NewCache(strategy string, maxBytes int64) (*cache, error) {
-	if maxBytes <= 0 {
-		return nil, fmt.Errorf("cache size must be positive, got %d", maxBytes)
+	evictionType, err := eviction.StringToEvictionType(strategy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache strategy: %w", err)
+	}
+	return NewCacheWithConfig(eviction.CacheConfig{MaxBytes: maxBytes, EvictionType: evictionType})
+}
+
+// NewCacheWithConfig creates a new cache from the given strategy configuration.
+// It returns an error if the strategy is invalid or if cfg.MaxBytes is not positive.
+func NewCacheWithConfig(cfg eviction.CacheConfig) (*cache, error) {
+	if cfg.MaxBytes <= 0 {
+		return nil, fmt.Errorf("cache size must be positive, got %d", cfg.MaxBytes)
 	}
 
 	onEvicted := func(key string, val eviction.Value) {
 		logger.LogrusObj.Infof("Cache entry evicted: key=%s", key)
 	}
 
-	s, err := eviction.New(strategy, maxBytes, onEvicted)
+	s, err := eviction.NewWithConfig(cfg, onEvicted)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cache strategy: %w", err)
 	}
 
 	return &cache{
-		maxBytes: maxBytes,
-		strategy: s,
+		maxBytes:  cfg.MaxBytes,
+		strategy:  s,
+		cfg:       cfg,
+		onEvicted: onEvicted,
 	}, nil
 }
 
-// It returns the value and whether the key was found.
+// byteViewOverhead is the per-entry cost of boxing a ByteView header in an interface value.
+var byteViewOverhead = int64(unsafe.Sizeof(ByteView{}))
+
+// NewSizer returns the size estimator registered under name.
+// "payload" counts key and value bytes only, while "heap" also charges the
+// per-entry bookkeeping and ByteView header so that maxBytes tracks heap usage.
+// An empty name selects "payload".
+func NewSizer(name string) (eviction.Sizer, error) {
+	switch name {
+	case "", "payload":
+		return eviction.PayloadSizer, nil
+	case "heap":
+		return eviction.OverheadSizer(eviction.EntryOverhead + byteViewOverhead), nil
+	default:
+		return nil, fmt.Errorf("invalid size estimator: %s", name)
+	}
+}
+
+// get returns the value of key and whether it was found. The value expires
+// at its own expiration time or, if it has none, at the end of the TTL the
+// cache was configured with.
 func (c *cache) get(key string) (ByteView, bool) {
 	if c == nil {
 		return ByteView{}, false
@@ -55,20 +104,74 @@ func (c *cache) get(key string) (ByteView, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if v, _, exists := c.strategy.Get(key); exists {
-		if bv, ok := v.(ByteView); ok {
-			metrics.RecordCacheHit()
-			return bv, true
+	view, ok := c.lookup(key)
+	if c.shadows != nil {
+		c.shadows.get(key, view.Len(), ok)
+	}
+	if ok {
+		metrics.RecordCacheHit()
+	} else {
+		metrics.RecordCacheMiss()
+	}
+	return view, ok
+}
+
+// expiryGetter is implemented by strategies that copy values into their own
+// storage and keep their expiration times apart from them.
+type expiryGetter interface {
+	GetWithExpiry(key string) (value eviction.Value, updateAt, expireAt time.Time, found bool)
+}
+
+var _ expiryGetter = (*eviction.CacheUseArena)(nil)
+
+// lookup returns the unexpired value of key in the strategy.
+// Caller must hold the lock.
+func (c *cache) lookup(key string) (ByteView, bool) {
+	if eg, ok := c.strategy.(expiryGetter); ok {
+		// Such strategies only return unexpired entries.
+		if v, _, expireAt, exists := eg.GetWithExpiry(key); exists {
+			if bv, ok := v.(eviction.ByteValue); ok {
+				return ByteView{b: bv.Bytes(), expireAt: expireAt}, true
+			}
+			logger.LogrusObj.Warnf("Invalid cache value type for key=%s", key)
+		}
+		return ByteView{}, false
+	}
+
+	if v, updateAt, exists := c.strategy.Get(key); exists {
+		switch bv := v.(type) {
+		case ByteView:
+			// An expired value is a miss even if the strategy has not removed it yet.
+			if !bv.IsExpired() {
+				if bv.expireAt.IsZero() && c.cfg.TTL > 0 && !updateAt.IsZero() {
+					// Report when the configured TTL expires the entry.
+					bv.expireAt = updateAt.Add(c.cfg.TTL)
+				}
+				return bv, true
+			}
+		case eviction.ByteValue:
+			// Strategies that copy values into their own storage return the bytes only.
+			if c.cfg.TTL > 0 && !updateAt.IsZero() && !time.Now().Before(updateAt.Add(c.cfg.TTL)) {
+				break
+			}
+			return ByteView{b: bv.Bytes()}, true
+		default:
+			logger.LogrusObj.Warnf("Invalid cache value type for key=%s", key)
 		}
-		logger.LogrusObj.Warnf("Invalid cache value type for key=%s", key)
 	}
-	metrics.RecordCacheMiss()
 	return ByteView{}, false
 }
 
 // put adds a key-value pair to the cache.
 // If the key already exists, its value will be updated.
 func (c *cache) put(key string, value ByteView) {
+	c.putWithCost(key, value, 0)
+}
+
+// putWithCost adds a key-value pair that took cost to load to the cache.
+// Strategies that are not cost-aware ignore the cost, and a non-positive
+// cost lets cost-aware strategies assume their default.
+func (c *cache) putWithCost(key string, value ByteView, cost time.Duration) {
 	if c == nil {
 		return
 	}
@@ -82,5 +185,220 @@ func (c *cache) put(key string, value ByteView) {
 	defer c.mu.Unlock()
 
 	logger.LogrusObj.Infof("Update to cache: key=%s, value=%v", key, value)
-	c.strategy.Put(key, value)
+	store(c.strategy, key, value, value.expireAt, cost)
+	if c.next != nil {
+		store(c.next, key, value, value.expireAt, cost)
+		c.dirty[key] = struct{}{}
+	}
+	if c.shadows != nil {
+		c.shadows.put(key, value.Len())
+	}
+}
+
+// add puts a value into the cache unless the key is already cached, so that
+// it never replaces a value loaded or set since. It reports whether it did.
+func (c *cache) add(key string, value ByteView) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, _, exists := c.strategy.Get(key); exists {
+		if bv, ok := v.(ByteView); !ok || !bv.IsExpired() {
+			return false
+		}
+	}
+	store(c.strategy, key, value, value.expireAt, 0)
+	if c.next != nil {
+		store(c.next, key, value, value.expireAt, 0)
+		c.dirty[key] = struct{}{}
+	}
+	if c.shadows != nil {
+		c.shadows.put(key, value.Len())
+	}
+	return true
+}
+
+// store puts a value into s, passing on its expiration time and load cost
+// if s supports them.
+func store(s eviction.CacheStrategy, key string, value eviction.Value, expireAt time.Time, cost time.Duration) {
+	if es, ok := s.(eviction.ExpiringStrategy); ok && !expireAt.IsZero() {
+		es.PutWithExpiry(key, value, expireAt)
+		return
+	}
+	if cs, ok := s.(eviction.CostAwareStrategy); ok && cost > 0 {
+		cs.PutWithCost(key, value, cost)
+		return
+	}
+	s.Put(key, value)
+}
+
+// setShadows replaces the shadow caches of the cache with the ones described
+// by sc. A zero sample rate disables them.
+func (c *cache) setShadows(group string, sc ShadowConfig) error {
+	var shadows *shadowSet
+	if sc.SampleRate != 0 {
+		c.mu.RLock()
+		cfg := c.cfg
+		c.mu.RUnlock()
+
+		var err error
+		if shadows, err = newShadowSet(group, cfg, sc); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	old := c.shadows
+	c.shadows = shadows
+	c.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+// shadowStats returns the estimates of the shadow caches, or nil if they are disabled.
+func (c *cache) shadowStats() []ShadowStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.shadows == nil {
+		return nil
+	}
+	return c.shadows.stats()
+}
+
+// strategyType returns the type of the current eviction strategy.
+func (c *cache) strategyType() eviction.EvictionType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.EvictionType
+}
+
+// len returns the number of cached entries.
+func (c *cache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.strategy.Len()
+}
+
+// hottest returns a snapshot of the unexpired entries, most recently used
+// first as far as the strategy tracks recency, with their expiration times.
+// It returns nil if the strategy cannot list its entries.
+func (c *cache) hottest() []eviction.Entry {
+	c.mu.RLock()
+	e, ok := c.strategy.(eviction.Enumerable)
+	c.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	entries := e.Entries()
+	hottest := make([]eviction.Entry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if bv, ok := entry.Value.(ByteView); ok {
+			if bv.IsExpired() {
+				continue
+			}
+			if entry.ExpireAt.IsZero() {
+				entry.ExpireAt = bv.expireAt
+			}
+		}
+		if !entry.ExpireAt.IsZero() && entry.ExpireAt.Before(time.Now()) {
+			continue
+		}
+		hottest = append(hottest, entry)
+	}
+	return hottest
+}
+
+// setStrategy replaces the eviction strategy with a new one of type t built
+// from the same configuration, and returns the number of entries moved to it.
+//
+// The entries are moved in order of recency, least recently used first, in
+// batches so that the current strategy keeps serving gets and puts meanwhile.
+// Puts made during the move also go to the new strategy and take precedence
+// over the moved copies, which keep their load costs if the old strategy
+// tracked them and their expiry, unless the new strategy has no per-entry
+// expiry; expired entries are dropped. Strategies that cannot list their
+// entries start empty.
+func (c *cache) setStrategy(t eviction.EvictionType) (moved int, err error) {
+	c.mu.Lock()
+	if c.next != nil {
+		c.mu.Unlock()
+		return 0, errSwitchInProgress
+	}
+	cfg := c.cfg
+	cfg.EvictionType = t
+	next, err := eviction.NewWithConfig(cfg, c.onEvicted)
+	if err != nil {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("failed to create cache strategy: %w", err)
+	}
+	old := c.strategy
+	c.next, c.dirty = next, make(map[string]struct{})
+	c.mu.Unlock()
+
+	var entries []eviction.Entry
+	if e, ok := old.(eviction.Enumerable); ok {
+		entries = e.Entries()
+	}
+	for start := 0; start < len(entries); start += migrateBatchSize {
+		end := min(start+migrateBatchSize, len(entries))
+		c.mu.RLock()
+		for _, e := range entries[start:end] {
+			if _, ok := c.dirty[e.Key]; ok {
+				continue
+			}
+			// The new strategy stamps the entry afresh, so carry its
+			// deadline over rather than let it restart the TTL.
+			expireAt := e.ExpireAt
+			if bv, ok := e.Value.(ByteView); ok && expireAt.IsZero() {
+				expireAt = bv.expireAt
+			}
+			if expireAt.IsZero() && cfg.TTL > 0 && !e.UpdateAt.IsZero() {
+				expireAt = e.UpdateAt.Add(cfg.TTL)
+			}
+			if !expireAt.IsZero() && expireAt.Before(time.Now()) {
+				continue
+			}
+			store(next, e.Key, e.Value, expireAt, e.Cost)
+			moved++
+		}
+		c.mu.RUnlock()
+	}
+
+	c.mu.Lock()
+	c.strategy, c.cfg = next, cfg
+	c.next, c.dirty = nil, nil
+	c.mu.Unlock()
+
+	if stopper, ok := old.(eviction.Stopper); ok {
+		stopper.Stop()
+	}
+	return moved, nil
+}
+
+// close releases the background resources held by the eviction strategy.
+func (c *cache) close() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stopper, ok := c.strategy.(eviction.Stopper); ok {
+		stopper.Stop()
+	}
+	if stopper, ok := c.next.(eviction.Stopper); ok {
+		stopper.Stop()
+	}
+	if c.shadows != nil {
+		c.shadows.stop()
+	}
 }
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ClientConfig configures the clients that reach peers, over gRPC or HTTP.
+// Zero fields take the value of DefaultClientConfig.
+type ClientConfig struct {
+	DialTimeout      time.Duration // limit on establishing a connection
+	RequestTimeout   time.Duration // limit on each request
+	KeepaliveTime    time.Duration // idle time after which a connection is probed, negative disables probes
+	KeepaliveTimeout time.Duration // wait for a probe to be answered before closing the connection
+	MaxMessageSize   int           // largest value sent or received, in bytes
+	BackoffBaseDelay time.Duration // wait before reconnecting after the first failure
+	BackoffMaxDelay  time.Duration // longest wait between reconnection attempts
+
+	// Connection pool of the HTTP clients. gRPC clients keep a single connection per peer.
+	MaxIdleConnsPerHost int           // most idle connections kept per peer
+	MaxConnsPerHost     int           // most connections per peer, negative means unlimited
+	IdleConnTimeout     time.Duration // time an idle connection is kept
+
+	TLS  *tls.Config // TLS of the connections, nil for plaintext; set by SetTLSConfig
+	Auth *Auth       // signs the requests to peers, nil sends them unsigned; set by SetAuth
+}
+
+// DefaultClientConfig is the peer client configuration used when none is set.
+var DefaultClientConfig = ClientConfig{
+	DialTimeout:      5 * time.Second,
+	RequestTimeout:   1 * time.Second,
+	KeepaliveTime:    30 * time.Second,
+	KeepaliveTimeout: 10 * time.Second,
+	MaxMessageSize:   4 << 20,
+	BackoffBaseDelay: 1 * time.Second,
+	BackoffMaxDelay:  30 * time.Second,
+
+	MaxIdleConnsPerHost: 32,
+	MaxConnsPerHost:     128,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// backoffMultiplier and backoffJitter shape the reconnection backoff, as in gRPC.
+const (
+	backoffMultiplier = 1.6
+	backoffJitter     = 0.2
+)
+
+// withDefaults returns c with its zero fields set from DefaultClientConfig.
+func (c ClientConfig) withDefaults() ClientConfig {
+	d := DefaultClientConfig
+	if c.DialTimeout > 0 {
+		d.DialTimeout = c.DialTimeout
+	}
+	if c.RequestTimeout > 0 {
+		d.RequestTimeout = c.RequestTimeout
+	}
+	if c.KeepaliveTime != 0 {
+		d.KeepaliveTime = c.KeepaliveTime
+	}
+	if c.KeepaliveTimeout > 0 {
+		d.KeepaliveTimeout = c.KeepaliveTimeout
+	}
+	if c.MaxMessageSize > 0 {
+		d.MaxMessageSize = c.MaxMessageSize
+	}
+	if c.BackoffBaseDelay > 0 {
+		d.BackoffBaseDelay = c.BackoffBaseDelay
+	}
+	if c.BackoffMaxDelay > 0 {
+		d.BackoffMaxDelay = c.BackoffMaxDelay
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		d.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost != 0 {
+		d.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		d.IdleConnTimeout = c.IdleConnTimeout
+	}
+	d.TLS, d.Auth = c.TLS, c.Auth
+	d.BackoffMaxDelay = max(d.BackoffMaxDelay, d.BackoffBaseDelay)
+	return d
+}
+
+// dialOptions returns the gRPC dial options of the configuration.
+func (c ClientConfig) dialOptions() []grpc.DialOption {
+	creds := insecure.NewCredentials()
+	if c.TLS != nil {
+		creds = credentials.NewTLS(c.TLS)
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  c.BackoffBaseDelay,
+				Multiplier: backoffMultiplier,
+				Jitter:     backoffJitter,
+				MaxDelay:   c.BackoffMaxDelay,
+			},
+			MinConnectTimeout: c.DialTimeout,
+		}),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(c.MaxMessageSize),
+			grpc.MaxCallSendMsgSize(c.MaxMessageSize),
+		),
+	}
+	opts = append(opts, c.Auth.dialOptions()...)
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.KeepaliveTime,
+			Timeout:             c.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// serverOptions returns the gRPC server options that accept clients of the
+// configuration: their message size and the keepalive probes they send.
+func (c ClientConfig) serverOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(c.MaxMessageSize),
+		grpc.MaxSendMsgSize(c.MaxMessageSize),
+	}
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.KeepaliveTime / 2,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// httpClient returns an HTTP client with the timeouts, keepalive and
+// connection pool of the configuration, meant to be shared by the fetchers
+// of all peers.
+func (c ClientConfig) httpClient() *http.Client {
+	dialer := &net.Dialer{Timeout: c.DialTimeout, KeepAlive: c.KeepaliveTime}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // peers are reached directly
+	transport.DialContext = dialer.DialContext
+	transport.MaxIdleConns = 0 // limited per peer only
+	transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = max(c.MaxConnsPerHost, 0)
+	transport.IdleConnTimeout = c.IdleConnTimeout
+	transport.TLSHandshakeTimeout = c.DialTimeout
+	transport.ResponseHeaderTimeout = c.RequestTimeout
+	transport.TLSClientConfig = c.TLS
+	return &http.Client{Transport: transport, Timeout: c.RequestTimeout}
+}
+
+// dialBackoff makes an HTTP fetcher fail fast after its peer could not be
+// reached, waiting longer after each consecutive failure before trying it
+// again, as gRPC does while reconnecting.
+type dialBackoff struct {
+	mu       sync.Mutex
+	base     time.Duration
+	max      time.Duration
+	failures int
+	retryAt  time.Time
+}
+
+// newDialBackoff returns a backoff with the delays of cfg.
+func newDialBackoff(cfg ClientConfig) *dialBackoff {
+	return &dialBackoff{base: cfg.BackoffBaseDelay, max: cfg.BackoffMaxDelay}
+}
+
+// allow returns an error if the peer should not be tried before the backoff ends.
+func (b *dialBackoff) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := time.Until(b.retryAt); wait > 0 {
+		return fmt.Errorf("peer unreachable, retrying in %v", wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// done records the outcome of a request to the peer: a failure to connect
+// starts or extends the backoff, anything else ends it.
+func (b *dialBackoff) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		b.failures, b.retryAt = 0, time.Time{}
+		return
+	}
+	delay := float64(b.base) * math.Pow(backoffMultiplier, float64(b.failures))
+	b.failures++
+	b.retryAt = time.Now().Add(time.Duration(min(delay, float64(b.max))))
+}
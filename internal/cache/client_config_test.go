@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClientConfig_WithDefaults(t *testing.T) {
+	cfg := ClientConfig{RequestTimeout: 3 * time.Second, KeepaliveTime: -1, BackoffBaseDelay: time.Minute}.withDefaults()
+	if cfg.RequestTimeout != 3*time.Second || cfg.DialTimeout != DefaultClientConfig.DialTimeout {
+		t.Errorf("timeouts = %v, %v, want the set one and the default", cfg.RequestTimeout, cfg.DialTimeout)
+	}
+	if cfg.KeepaliveTime >= 0 {
+		t.Errorf("a negative keepalive time should be kept to disable probes, got %v", cfg.KeepaliveTime)
+	}
+	if cfg.BackoffMaxDelay != time.Minute {
+		t.Errorf("backoff max delay = %v, want it raised to the base delay", cfg.BackoffMaxDelay)
+	}
+}
+
+// slowServer answers Get after a delay.
+type slowServer struct {
+	pb.UnimplementedGroupCacheServer
+	delay time.Duration
+}
+
+func (s *slowServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	time.Sleep(s.delay)
+	return &pb.GetResponse{Value: []byte("value")}, nil
+}
+
+func TestClient_RequestTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterGroupCacheServer(grpcServer, &slowServer{delay: 200 * time.Millisecond})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	fast, _ := NewClient(lis.Addr().String(), ClientConfig{RequestTimeout: 50 * time.Millisecond})
+	defer fast.Close()
+	if _, err := fast.Fetch("group", "key"); err == nil {
+		t.Error("Fetch slower than the request timeout should fail")
+	}
+
+	patient, _ := NewClient(lis.Addr().String(), ClientConfig{RequestTimeout: time.Second})
+	defer patient.Close()
+	if _, err := patient.Fetch("group", "key"); err != nil {
+		t.Errorf("Fetch within the request timeout returned error: %v", err)
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := proto.Marshal(&pb.GetResponse{Value: []byte(strings.Repeat("x", len(r.URL.Path)))})
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	cfg := ClientConfig{MaxMessageSize: 20}.withDefaults()
+	f := newHTTPFetcher(srv.URL+"/", cfg.httpClient(), cfg)
+	if _, err := f.Fetch("g", "k"); err != nil {
+		t.Errorf("Fetch of a small value returned error: %v", err)
+	}
+	if _, err := f.Fetch("group", strings.Repeat("k", 30)); err == nil {
+		t.Error("Fetch of a value larger than the max message size should fail")
+	}
+}
+
+func TestHTTPFetcher_Backoff(t *testing.T) {
+	// A listener closed right away leaves a port that refuses connections.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	cfg := ClientConfig{BackoffBaseDelay: 100 * time.Millisecond}.withDefaults()
+	f := newHTTPFetcher("http://"+addr+"/", cfg.httpClient(), cfg)
+	if _, err := f.Fetch("g", "k"); err == nil {
+		t.Fatal("Fetch from an unreachable peer should fail")
+	}
+	if _, err := f.Fetch("g", "k"); err == nil || !strings.Contains(err.Error(), "retrying in") {
+		t.Errorf("Fetch during the backoff = %v, want it to fail fast", err)
+	}
+
+	// After the backoff the peer is tried again, and success ends the backoff.
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	lis, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port %s was reused: %v", addr, err)
+	}
+	go srv.Serve(lis)
+	defer srv.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := f.Fetch("g", "k"); err != nil {
+		t.Errorf("Fetch after the backoff returned error: %v", err)
+	}
+	if err := f.backoff.allow(); err != nil {
+		t.Errorf("a successful request should end the backoff, got %v", err)
+	}
+}
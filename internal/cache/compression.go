@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/1055373165/ggcache/internal/metrics"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressionMinSize is the smallest value compressed when
+// CompressionConfig.MinSize is zero. Smaller values rarely shrink enough to
+// pay for the decompression on every hit.
+const DefaultCompressionMinSize = 1 << 10
+
+// maxDecodedSize is the largest value a codec decompresses, so that a corrupt
+// or hostile payload cannot claim unbounded memory. Larger values are stored
+// uncompressed.
+const maxDecodedSize = 64 << 20
+
+// errDecodedTooLarge is returned for compressed values that decompress to
+// more than maxDecodedSize bytes.
+var errDecodedTooLarge = fmt.Errorf("decompressed value larger than %d bytes", maxDecodedSize)
+
+// CompressionConfig configures the compression of the values cached by a group.
+//
+// Values of at least MinSize bytes are stored compressed with Codec and
+// decompressed when read. They stay compressed when sent to peers, which
+// decompress them only when they are read there, after checking on receipt
+// that they decompress. A value that does not shrink, or that is larger than
+// 64 MiB, is stored as is. The arena strategy copies the decompressed bytes
+// into its buffers, so compression saves no memory with it.
+type CompressionConfig struct {
+	Codec   string // "snappy", "zstd" or "gzip", compression is disabled if empty
+	MinSize int    // Smallest value compressed in bytes, DefaultCompressionMinSize if zero
+}
+
+// codec compresses values. Decode must accept anything Encode returned,
+// on any node, so the encoding of a codec must not change once it is
+// registered.
+type codec interface {
+	// Name identifies the encoding, on the wire too.
+	Name() string
+	Encode(src []byte) []byte
+	Decode(src []byte) ([]byte, error)
+}
+
+// codecs maps encoding names to their codecs.
+var codecs = map[string]codec{
+	"snappy": snappyCodec{},
+	"zstd":   &zstdCodec{},
+	"gzip":   &gzipCodec{},
+}
+
+// codecByName returns the codec of the named encoding, nil for the empty
+// name of uncompressed values.
+func codecByName(name string) (codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid compression codec: %s", name)
+	}
+	return c, nil
+}
+
+// codecName returns the name of c, empty for uncompressed values.
+func codecName(c codec) string {
+	if c == nil {
+		return ""
+	}
+	return c.Name()
+}
+
+// compressor compresses the values of a group.
+type compressor struct {
+	group   string
+	codec   codec
+	minSize int
+}
+
+// newCompressor returns the compressor of the values of group configured by
+// cc, or nil if compression is disabled.
+func newCompressor(group string, cc CompressionConfig) (*compressor, error) {
+	c, err := codecByName(cc.Codec)
+	if err != nil || c == nil {
+		return nil, err
+	}
+	if cc.MinSize < 0 {
+		return nil, fmt.Errorf("compression min size must not be negative, got %d", cc.MinSize)
+	}
+	minSize := cc.MinSize
+	if minSize == 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	return &compressor{group: group, codec: c, minSize: minSize}, nil
+}
+
+// compress returns v with its bytes compressed, or v itself if it is
+// already compressed, smaller than the minimum size, or does not shrink.
+func (c *compressor) compress(v ByteView) ByteView {
+	if c == nil || v.codec != nil || len(v.b) < c.minSize || len(v.b) > maxDecodedSize {
+		return v
+	}
+	b := c.codec.Encode(v.b)
+	if len(b) >= len(v.b) {
+		metrics.ObserveCompression(c.group, c.codec.Name(), len(v.b), len(v.b))
+		return v
+	}
+	metrics.ObserveCompression(c.group, c.codec.Name(), len(v.b), len(b))
+	return ByteView{b: b, expireAt: v.expireAt, codec: c.codec}
+}
+
+// snappyCodec favours speed over ratio.
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return "snappy" }
+
+func (snappyCodec) Encode(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
+
+func (snappyCodec) Decode(src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecodedSize {
+		return nil, errDecodedTooLarge
+	}
+	return snappy.Decode(nil, src)
+}
+
+// zstdCodec compresses better than snappy at a small cost in speed.
+// Its encoder and decoder are created on first use and shared, as both
+// are safe for concurrent EncodeAll and DecodeAll calls.
+type zstdCodec struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (*zstdCodec) Name() string { return "zstd" }
+
+func (z *zstdCodec) init() {
+	z.once.Do(func() {
+		// Neither can fail with valid options.
+		z.encoder, _ = zstd.NewWriter(nil)
+		z.decoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize))
+	})
+}
+
+func (z *zstdCodec) Encode(src []byte) []byte {
+	z.init()
+	return z.encoder.EncodeAll(src, nil)
+}
+
+func (z *zstdCodec) Decode(src []byte) ([]byte, error) {
+	z.init()
+	return z.decoder.DecodeAll(src, nil)
+}
+
+// gzipCodec is the slowest, for values read rarely. Writers are pooled
+// since each holds large compression tables.
+type gzipCodec struct {
+	writers sync.Pool
+}
+
+func (*gzipCodec) Name() string { return "gzip" }
+
+func (g *gzipCodec) Encode(src []byte) []byte {
+	var buf bytes.Buffer
+	w, ok := g.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	// Writes to a bytes.Buffer do not fail.
+	w.Write(src)
+	w.Close()
+	g.writers.Put(w)
+	return buf.Bytes()
+}
+
+func (*gzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDecodedSize {
+		return nil, errDecodedTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+)
+
+func TestCodecs(t *testing.T) {
+	value := bytes.Repeat([]byte("student record "), 200)
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			encoded := c.Encode(value)
+			if len(encoded) >= len(value) {
+				t.Errorf("Encode did not shrink %d bytes, got %d", len(value), len(encoded))
+			}
+			decoded, err := c.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode returned error: %v", err)
+			}
+			if !bytes.Equal(decoded, value) {
+				t.Error("Decode did not return the encoded value")
+			}
+			if _, err := c.Decode([]byte("not compressed")); err == nil {
+				t.Error("Decode of garbage should fail")
+			}
+			if _, err := c.Decode(c.Encode(make([]byte, maxDecodedSize+1))); err == nil {
+				t.Errorf("Decode of more than %d bytes should fail", maxDecodedSize)
+			}
+		})
+	}
+
+	if _, err := newCompressor("g", CompressionConfig{Codec: "lz4"}); err == nil {
+		t.Error("newCompressor should reject an unknown codec")
+	}
+}
+
+func TestGroup_Compression(t *testing.T) {
+	g := NewGroupWithConfig("compressed", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			return bytes.Repeat([]byte(key), 1000), nil
+		}))
+	t.Cleanup(func() { DestroyGroup("compressed") })
+	if err := g.SetCompression(CompressionConfig{Codec: "snappy", MinSize: 100}); err != nil {
+		t.Fatalf("SetCompression returned error: %v", err)
+	}
+
+	g.setLocally("small", []byte("tiny"))
+	if v, _ := g.cache.get("small"); v.codec != nil {
+		t.Error("values smaller than MinSize should not be compressed")
+	}
+
+	want := bytes.Repeat([]byte("k"), 1000)
+	if _, err := g.Get("k"); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	stored, ok := g.cache.get("k")
+	if !ok || stored.codec == nil || stored.Len() >= len(want) {
+		t.Fatalf("cached value = %d bytes with codec %q, want fewer than %d compressed", stored.Len(), codecName(stored.codec), len(want))
+	}
+	if !bytes.Equal(stored.ByteSlice(), want) || stored.String() != string(want) {
+		t.Error("compressed value does not read back as the loaded value")
+	}
+
+	// Peers receive the compressed bytes and decompress them on read.
+	resp, err := getResponse(g, "k")
+	if err != nil {
+		t.Fatalf("getResponse returned error: %v", err)
+	}
+	if resp.GetEncoding() != "snappy" || !bytes.Equal(resp.GetValue(), stored.b) {
+		t.Errorf("response has encoding %q and %d bytes, want the %d stored snappy bytes", resp.GetEncoding(), len(resp.GetValue()), stored.Len())
+	}
+	view, err := viewFromResponse(resp, g.name, "k", "peer")
+	if err != nil {
+		t.Fatalf("viewFromResponse returned error: %v", err)
+	}
+	if !bytes.Equal(view.Bytes(), want) {
+		t.Error("value sent to a peer does not read back as the loaded value")
+	}
+
+	resp.Encoding = "unknown"
+	if _, err := viewFromResponse(resp, g.name, "k", "peer"); err == nil {
+		t.Error("viewFromResponse should reject an unknown encoding")
+	}
+
+	// Handed off values keep their encoding.
+	if !g.acceptHandoff("handed", stored.b, "snappy", stored.expireAt) {
+		t.Fatal("acceptHandoff did not cache the value")
+	}
+	if v, _ := g.cache.get("handed"); v.codec == nil || !bytes.Equal(v.Bytes(), want) {
+		t.Error("handed off value does not read back as the sent value")
+	}
+
+	// Values that do not decompress are not cached.
+	corrupt := ByteView{b: []byte("not snappy"), codec: codecs["snappy"]}
+	if g.acceptHandoff("corrupt", corrupt.b, "snappy", time.Time{}) {
+		t.Error("acceptHandoff cached a value that does not decompress")
+	}
+	if _, err := g.fetchFromPeer(viewPeer{corrupt}, "corrupt"); err == nil {
+		t.Error("fetchFromPeer returned a value that does not decompress")
+	}
+	if _, ok := g.cache.get("corrupt"); ok {
+		t.Error("a value that does not decompress was cached")
+	}
+}
+
+// viewPeer answers every key with its view.
+type viewPeer struct {
+	view ByteView
+}
+
+func (p viewPeer) Fetch(group string, key string) ([]byte, error) {
+	return p.view.decode()
+}
+
+func (p viewPeer) fetchView(group string, key string) (ByteView, error) {
+	return p.view, nil
+}
@@ -3,22 +3,41 @@ package cache
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+
+	"github.com/1055373165/ggcache/pkg/etcd/discovery"
 )
 
+// DefaultWeight is the weight of nodes added without one, the weight peers
+// register in etcd by default.
+// A node of weight w gets replicas*w/DefaultWeight virtual nodes.
+const DefaultWeight = discovery.DefaultWeight
+
 // Hash defines a function that generates a hash value for the given data.
 type Hash func(data []byte) uint32
 
 // ConsistentMap implements consistent hashing to distribute keys across nodes.
 // It maintains a ring of virtual nodes to ensure even distribution.
+//
+// It can also bound the load of each node (consistent hashing with bounded
+// loads, Mirrokni et al.): requests picked with Acquire are counted as in
+// flight until Release, and a node already carrying (1+ε) times the average
+// in-flight load is passed over for the next node clockwise on the ring, so
+// a few hot keys cannot overload the node that owns them.
 type ConsistentMap struct {
 	mu       sync.RWMutex
-	hash     Hash           // hash function to use
-	replicas int            // number of virtual nodes per real node
-	keys     []int          // sorted list of hash keys
-	hashMap  map[int]string // maps virtual nodes to real nodes
+	hash     Hash                     // hash function to use
+	replicas int                      // number of virtual nodes per real node of DefaultWeight
+	keys     []int                    // sorted list of hash keys
+	hashMap  map[int]string           // maps virtual nodes to real nodes
+	virtuals map[string]int           // number of virtual nodes of each real node
+	epsilon  float64                  // load bound factor ε, 0 disables bounded loads
+	loads    map[string]*atomic.Int64 // in-flight requests of each real node, kept while it has any after its removal
+	inflight atomic.Int64             // in-flight requests of all nodes
 }
 
 // NewConsistentHash creates a ConsistentMap with the specified number of replicas
@@ -32,6 +51,8 @@ func NewConsistentHash(replicas int, fn Hash) *ConsistentMap {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		virtuals: make(map[string]int),
+		loads:    make(map[string]*atomic.Int64),
 	}
 
 	if m.hash == nil {
@@ -40,7 +61,7 @@ func NewConsistentHash(replicas int, fn Hash) *ConsistentMap {
 	return m
 }
 
-// AddNodes adds the specified nodes to the hash ring.
+// AddNodes adds the specified nodes to the hash ring with DefaultWeight.
 // Each node is replicated multiple times for better distribution.
 func (m *ConsistentMap) AddNodes(nodes ...string) {
 	if len(nodes) == 0 {
@@ -51,15 +72,134 @@ func (m *ConsistentMap) AddNodes(nodes ...string) {
 	defer m.mu.Unlock()
 
 	for _, node := range nodes {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + node)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = node
+		m.addNode(node, DefaultWeight)
+	}
+	sort.Ints(m.keys)
+}
+
+// AddWeightedNodes adds the specified nodes to the hash ring, giving each
+// node a number of virtual nodes in proportion to its weight, and so about
+// that share of the keys. Nodes with a non-positive weight get DefaultWeight.
+func (m *ConsistentMap) AddWeightedNodes(weights map[string]int) {
+	if len(weights) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for node, weight := range weights {
+		if weight <= 0 {
+			weight = DefaultWeight
 		}
+		m.addNode(node, weight)
 	}
 	sort.Ints(m.keys)
 }
 
+// addNode places the virtual nodes of a node of the given weight on the ring.
+// Caller must hold the lock and sort the keys afterwards.
+func (m *ConsistentMap) addNode(node string, weight int) {
+	n := m.replicas * weight / DefaultWeight
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + node)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = node
+	}
+	m.virtuals[node] = n
+	if m.loads[node] == nil {
+		m.loads[node] = new(atomic.Int64)
+	}
+}
+
+// clone returns a copy of the ring. The copy shares the in-flight loads of
+// the nodes, so it must only be used for lookups with GetNode.
+func (m *ConsistentMap) clone() Placement {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c := &ConsistentMap{
+		hash:     m.hash,
+		replicas: m.replicas,
+		keys:     append([]int(nil), m.keys...),
+		hashMap:  make(map[int]string, len(m.hashMap)),
+		virtuals: make(map[string]int, len(m.virtuals)),
+		epsilon:  m.epsilon,
+		loads:    make(map[string]*atomic.Int64, len(m.loads)),
+	}
+	for hash, node := range m.hashMap {
+		c.hashMap[hash] = node
+	}
+	for node, n := range m.virtuals {
+		c.virtuals[node] = n
+	}
+	for node, load := range m.loads {
+		c.loads[node] = load
+	}
+	return c
+}
+
+// SetLoadBound caps the in-flight load of each node at (1+epsilon) times the
+// average, rounded up, for requests picked with Acquire. Smaller values
+// spread the load more evenly but move more keys away from their owner.
+// A non-positive epsilon disables the bound.
+func (m *ConsistentMap) SetLoadBound(epsilon float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.epsilon = max(epsilon, 0)
+}
+
+// Acquire returns the node that should handle key and counts a request to
+// it as in flight until Release is called with that node. Without a load
+// bound it returns the same node as GetNode.
+func (m *ConsistentMap) Acquire(key string) string {
+	if key == "" || m == nil {
+		return ""
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return ""
+	}
+
+	idx := m.search(key)
+	node := m.hashMap[m.keys[idx]]
+	if m.epsilon > 0 {
+		// Some node is always below the bound, since not every node can be above the average.
+		bound := int64(math.Ceil((1 + m.epsilon) * float64(m.inflight.Load()+1) / float64(len(m.virtuals))))
+		for i := 0; i < len(m.keys); i++ {
+			if n := m.hashMap[m.keys[(idx+i)%len(m.keys)]]; m.loads[n].Load() < bound {
+				node = n
+				break
+			}
+		}
+	}
+
+	m.loads[node].Add(1)
+	m.inflight.Add(1)
+	return node
+}
+
+// Release ends a request to node counted by Acquire.
+func (m *ConsistentMap) Release(node string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if load, ok := m.loads[node]; ok {
+		load.Add(-1)
+	}
+	m.inflight.Add(-1)
+}
+
 // GetNode returns the node responsible for the given key.
 // Returns empty string if the hash ring is empty or key is invalid.
 func (m *ConsistentMap) GetNode(key string) string {
@@ -74,6 +214,37 @@ func (m *ConsistentMap) GetNode(key string) string {
 		return ""
 	}
 
+	return m.hashMap[m.keys[m.search(key)]]
+}
+
+// GetNodes returns the first n distinct nodes clockwise from key on the ring.
+func (m *ConsistentMap) GetNodes(key string, n int) []string {
+	if key == "" || m == nil || n <= 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return nil
+	}
+
+	n = min(n, len(m.virtuals))
+	nodes := make([]string, 0, n)
+	idx := m.search(key)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !containsString(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// search returns the index of the first virtual node clockwise from key.
+// Caller must hold the lock and the ring must not be empty.
+func (m *ConsistentMap) search(key string) int {
 	hash := int(m.hash([]byte(key)))
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
@@ -83,8 +254,7 @@ func (m *ConsistentMap) GetNode(key string) string {
 	if idx == len(m.keys) {
 		idx = 0
 	}
-
-	return m.hashMap[m.keys[idx]]
+	return idx
 }
 
 // RemoveNode removes a node and its replicas from the hash ring.
@@ -98,8 +268,13 @@ func (m *ConsistentMap) RemoveNode(node string) {
 	defer m.mu.Unlock()
 
 	// Find all hashes for this node's replicas
-	hashesToRemove := make([]int, 0, m.replicas)
-	for i := 0; i < m.replicas; i++ {
+	n := m.virtuals[node]
+	delete(m.virtuals, node)
+	// The load of a node re-added with another weight must carry over, so
+	// that the requests still in flight to it are released from it.
+	m.pruneLoads()
+	hashesToRemove := make([]int, 0, n)
+	for i := 0; i < n; i++ {
 		hash := int(m.hash([]byte(strconv.Itoa(i) + node)))
 		if _, exists := m.hashMap[hash]; exists {
 			hashesToRemove = append(hashesToRemove, hash)
@@ -122,7 +297,27 @@ func (m *ConsistentMap) RemoveNode(node string) {
 	m.keys = newKeys
 }
 
-// containsInt returns true if x is present in the sorted slice nums.
+// pruneLoads forgets the loads of the nodes no longer on the ring once no
+// requests to them are in flight. Caller must hold the lock.
+func (m *ConsistentMap) pruneLoads() {
+	for node, load := range m.loads {
+		if _, ok := m.virtuals[node]; !ok && load.Load() == 0 {
+			delete(m.loads, node)
+		}
+	}
+}
+
+// containsString returns true if s is present in the slice strs.
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsInt returns true if x is present in the slice nums.
 func containsInt(nums []int, x int) bool {
 	for _, n := range nums {
 		if n == x {
@@ -204,3 +204,144 @@ func TestConsistentHash(t *testing.T) {
 		})
 	}
 }
+
+func TestConsistentHash_AddWeightedNodes(t *testing.T) {
+	ch := NewConsistentHash(50, nil)
+	ch.AddWeightedNodes(map[string]int{"small": 10, "large": 30, "unset": 0})
+
+	if got := ch.virtuals["large"]; got != 150 {
+		t.Errorf("node of weight 30 got %d virtual nodes, want 150", got)
+	}
+	if got := ch.virtuals["unset"]; got != 50 {
+		t.Errorf("node without weight got %d virtual nodes, want 50", got)
+	}
+
+	// Keys are spread in proportion to the weights.
+	counts := make(map[string]int)
+	for i := 0; i < 50000; i++ {
+		counts[ch.GetNode("key-"+strconv.Itoa(i))]++
+	}
+	if ratio := float64(counts["large"]) / float64(counts["small"]); ratio < 2 || ratio > 4 {
+		t.Errorf("node of weight 30 got %.2f times the keys of a node of weight 10, want about 3", ratio)
+	}
+
+	ch.RemoveNode("large")
+	if len(ch.keys) != 100 {
+		t.Errorf("after removing the large node got %d keys, want 100", len(ch.keys))
+	}
+}
+
+func TestConsistentHash_BoundedLoads(t *testing.T) {
+	ch := NewConsistentHash(50, nil)
+	ch.AddNodes("node1", "node2", "node3", "node4")
+	owner := ch.GetNode("hot")
+
+	// Without a bound every request for the hot key goes to its owner.
+	for i := 0; i < 10; i++ {
+		if node := ch.Acquire("hot"); node != owner {
+			t.Fatalf("Acquire without a load bound = %s, want %s", node, owner)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		ch.Release(owner)
+	}
+
+	// With ε = 0.25, no node carries more than ceil(1.25 * average) requests.
+	ch.SetLoadBound(0.25)
+	var picked []string
+	for i := 0; i < 100; i++ {
+		picked = append(picked, ch.Acquire("hot"))
+	}
+	for node, load := range ch.loads {
+		if load.Load() > 32 {
+			t.Errorf("node %s carries %d of 100 requests, want at most 32", node, load.Load())
+		}
+	}
+	if ch.loads[owner].Load() < 25 {
+		t.Errorf("owner carries %d requests, want the hot key to stay on it up to the bound", ch.loads[owner].Load())
+	}
+
+	// Released load returns the hot key to its owner.
+	for _, node := range picked {
+		ch.Release(node)
+	}
+	if ch.inflight.Load() != 0 {
+		t.Errorf("%d requests in flight after releasing all of them", ch.inflight.Load())
+	}
+	if node := ch.Acquire("hot"); node != owner {
+		t.Errorf("Acquire after releasing = %s, want %s", node, owner)
+	}
+}
+
+func TestConsistentHash_ReweightKeepsLoad(t *testing.T) {
+	ch := NewConsistentHash(50, nil)
+	ch.AddNodes("node1", "node2")
+	node := ch.Acquire("key")
+
+	// Reweighting removes the node and adds it again while the request is in flight.
+	ch.RemoveNode(node)
+	ch.AddWeightedNodes(map[string]int{node: 2 * DefaultWeight})
+	if got := ch.loads[node].Load(); got != 1 {
+		t.Errorf("load after reweighting = %d, want the 1 request in flight", got)
+	}
+	ch.Release(node)
+	if got := ch.loads[node].Load(); got != 0 {
+		t.Errorf("load after releasing = %d, want 0", got)
+	}
+
+	// Loads of removed nodes are forgotten once they have no requests in flight.
+	ch.RemoveNode(node)
+	if _, ok := ch.loads[node]; ok {
+		t.Errorf("load of removed node %s is still kept", node)
+	}
+}
+
+func TestConsistentHash_Inspect(t *testing.T) {
+	// Virtual node i of node n hashes to the number "<i><n>".
+	ch := NewConsistentHash(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	ch.AddNodes("2", "4", "6")
+
+	ring := ch.Ring()
+	wantHashes := []uint32{2, 4, 6, 12, 14, 16, 22, 24, 26}
+	if len(ring) != len(wantHashes) {
+		t.Fatalf("Ring() returned %d virtual nodes, want %d", len(ring), len(wantHashes))
+	}
+	for i, v := range ring {
+		if v.Hash != wantHashes[i] {
+			t.Errorf("virtual node %d has hash %d, want %d", i, v.Hash, wantHashes[i])
+		}
+		if hash := ch.hash([]byte(strconv.Itoa(v.Replica) + v.Node)); hash != v.Hash {
+			t.Errorf("virtual node %d is replica %d of %s, want it to hash to %d", i, v.Replica, v.Node, v.Hash)
+		}
+	}
+
+	// Node "4" owns (2, 4], (12, 14] and (22, 24]; node "2" also owns the wrapped arc.
+	var total float64
+	for _, o := range ch.Ownership() {
+		total += o.Share
+		if o.VirtualNodes != 3 {
+			t.Errorf("node %s has %d virtual nodes, want 3", o.Node, o.VirtualNodes)
+		}
+		if o.Node == "4" && o.Share != 6.0/(1<<32) {
+			t.Errorf("node 4 owns %g of the ring, want %g", o.Share, 6.0/(1<<32))
+		}
+	}
+	if total < 0.999999 || total > 1.000001 {
+		t.Errorf("shares sum to %f, want 1", total)
+	}
+
+	p, ok := ch.Explain("23")
+	if !ok || p.Hash != 23 || p.Index != 7 || p.Owner != "4" || p.VirtualNode.Replica != 2 || p.Wrapped {
+		t.Errorf("Explain(23) = %+v, want hash 23 on replica 2 of node 4 at index 7", p)
+	}
+	p, ok = ch.Explain("27")
+	if !ok || p.Index != 0 || p.Owner != "2" || p.VirtualNode.Replica != 0 || !p.Wrapped {
+		t.Errorf("Explain(27) = %+v, want it to wrap to replica 0 of node 2", p)
+	}
+	if _, ok := NewConsistentHash(3, nil).Explain("key"); ok {
+		t.Error("Explain on an empty ring should fail")
+	}
+}
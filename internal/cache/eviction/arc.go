@@ -10,6 +10,12 @@ import (
 	"github.com/1055373165/ggcache/pkg/common/logger"
 )
 
+var (
+	_ limiter          = (*CacheUseARC)(nil)
+	_ ExpiringStrategy = (*CacheUseARC)(nil)
+	_ Enumerable       = (*CacheUseARC)(nil)
+)
+
 // CacheUseARC implements the Adaptive Replacement Cache (ARC) algorithm.
 // ARC maintains four lists:
 // - T1: Contains pages that have been accessed exactly once recently (recency)
@@ -20,8 +26,7 @@ type CacheUseARC struct {
 	mu sync.RWMutex
 
 	// Cache capacity
-	maxBytes int64
-	nbytes   int64
+	limits
 
 	// Target size for T1 (p)
 	p int64
@@ -42,14 +47,14 @@ type CacheUseARC struct {
 	// TTL related fields
 	cleanupInterval time.Duration
 	ttl             time.Duration
+	wheel           *timingWheel
 	stopCleanup     chan struct{}
 }
 
 // NewCacheUseARC creates a new ARC cache.
 func NewCacheUseARC(maxBytes int64, onEvicted func(string, Value)) *CacheUseARC {
 	c := &CacheUseARC{
-		maxBytes:        maxBytes,
-		nbytes:          0,
+		limits:          limits{maxBytes: maxBytes},
 		p:               0,
 		t1:              list.New(),
 		t2:              list.New(),
@@ -59,7 +64,6 @@ func NewCacheUseARC(maxBytes int64, onEvicted func(string, Value)) *CacheUseARC
 		ghost:           make(map[string]*list.Element),
 		OnEvicted:       onEvicted,
 		cleanupInterval: time.Minute,
-		stopCleanup:     make(chan struct{}),
 	}
 	metrics.UpdateCacheSize(0)      // Initialize cache size to 0
 	metrics.UpdateCacheItemCount(0) // Initialize item count to 0
@@ -67,7 +71,7 @@ func NewCacheUseARC(maxBytes int64, onEvicted func(string, Value)) *CacheUseARC
 
 	logger.LogrusObj.Warnf("NewCacheUseARC: maxBytes=%d", maxBytes)
 
-	go c.cleanupRoutine()
+	c.startLocked()
 	return c
 }
 
@@ -90,6 +94,10 @@ func (c *CacheUseARC) Get(key string) (value Value, updateAt time.Time, ok bool)
 
 	if ele, hit := c.cache[key]; hit {
 		entry := ele.Value.(*arcEntry)
+		if !entry.ExpireAt.IsZero() && entry.ExpireAt.Before(time.Now()) {
+			c.removeEntry(ele, entry, !entry.inT2)
+			return nil, time.Time{}, false
+		}
 		if !entry.inT2 {
 			// Move from T1 to T2
 			c.t1.Remove(ele)
@@ -109,21 +117,29 @@ func (c *CacheUseARC) Get(key string) (value Value, updateAt time.Time, ok bool)
 
 // Put adds a value to the cache
 func (c *CacheUseARC) Put(key string, value Value) {
+	c.PutWithExpiry(key, value, time.Time{})
+}
+
+// PutWithExpiry adds a value to the cache that expires at expireAt.
+// A zero expireAt applies the cache-wide TTL.
+func (c *CacheUseARC) PutWithExpiry(key string, value Value, expireAt time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	newSize := int64(len(key)) + int64(value.Len())
+	newSize := c.sizeOf(key, value)
 	if newSize > c.maxBytes {
 		return // Value too large
 	}
 
 	if ele, exists := c.cache[key]; exists {
 		entry := ele.Value.(*arcEntry)
-		oldSize := int64(len(key)) + int64(entry.Value.Len())
+		oldSize := c.sizeOf(key, entry.Value)
 		c.nbytes = c.nbytes - oldSize + newSize
 
 		entry.Value = value
+		entry.ExpireAt = expireAt
 		entry.Touch()
+		c.wheel.track(&entry.Entry, c.ttl)
 
 		// Move from T1 to T2 if needed
 		if !entry.inT2 {
@@ -134,6 +150,7 @@ func (c *CacheUseARC) Put(key string, value Value) {
 		} else {
 			c.t2.MoveToFront(ele)
 		}
+		c.evictOverflow()
 		metrics.UpdateCacheSize(c.nbytes)
 		metrics.UpdateCacheItemCount(int64(len(c.cache)))
 		c.updateARCMetrics()
@@ -157,7 +174,7 @@ func (c *CacheUseARC) Put(key string, value Value) {
 	}
 
 	// Make space if needed
-	for c.nbytes+newSize > c.maxBytes {
+	for c.nbytes+newSize > c.maxBytes || (c.maxEntries > 0 && len(c.cache) >= c.maxEntries) {
 		c.evict()
 		metrics.RecordEviction()
 	}
@@ -168,11 +185,13 @@ func (c *CacheUseARC) Put(key string, value Value) {
 			Key:      key,
 			Value:    value,
 			UpdateAt: time.Now(),
+			ExpireAt: expireAt,
 		},
 		inT2: false,
 	}
 	ele := c.t1.PushFront(entry)
 	c.cache[key] = ele
+	c.wheel.track(&entry.Entry, c.ttl)
 	c.nbytes += newSize
 	metrics.UpdateCacheSize(c.nbytes)
 	metrics.UpdateCacheItemCount(int64(len(c.cache)))
@@ -195,13 +214,19 @@ func (c *CacheUseARC) evict() {
 		ele := c.t2.Back()
 		entry := ele.Value.(*arcEntry)
 		c.removeEntry(ele, entry, false)
+	} else {
+		// T2 is empty but its ghosts keep T1 from qualifying; T1 must still make room
+		ele := c.t1.Back()
+		entry := ele.Value.(*arcEntry)
+		c.removeEntry(ele, entry, true)
 	}
 }
 
 // removeEntry handles the removal of an entry from the cache
 func (c *CacheUseARC) removeEntry(ele *list.Element, entry *arcEntry, fromT1 bool) {
-	c.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
+	c.nbytes -= c.sizeOf(entry.Key, entry.Value)
 	delete(c.cache, entry.Key)
+	c.wheel.cancel(entry.Key)
 	metrics.UpdateCacheSize(c.nbytes)
 	metrics.UpdateCacheItemCount(int64(len(c.cache)))
 
@@ -246,26 +271,91 @@ func (c *CacheUseARC) removeEntry(ele *list.Element, entry *arcEntry, fromT1 boo
 	c.updateARCMetrics()
 }
 
+// evictOverflow evicts entries until the cache is within its limits.
+// Caller must hold the lock.
+func (c *CacheUseARC) evictOverflow() {
+	for len(c.cache) > 0 && c.overLimit(len(c.cache)) {
+		c.evict()
+		metrics.RecordEviction()
+	}
+}
+
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (c *CacheUseARC) SetSizer(sizer Sizer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sizer = sizer
+	c.nbytes = 0
+	for _, ele := range c.cache {
+		entry := ele.Value.(*arcEntry)
+		c.nbytes += c.sizeOf(entry.Key, entry.Value)
+	}
+	c.evictOverflow()
+	metrics.UpdateCacheSize(c.nbytes)
+	metrics.UpdateCacheItemCount(int64(len(c.cache)))
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (c *CacheUseARC) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evictOverflow()
+}
+
 // updateARCMetrics updates ARC-specific metrics
 func (c *CacheUseARC) updateARCMetrics() {
 	metrics.UpdateARCMetrics(c.t1.Len(), c.t2.Len(), c.b1.Len(), c.b2.Len(), int(c.p))
 }
 
-// cleanupRoutine periodically removes expired entries
-func (c *CacheUseARC) cleanupRoutine() {
-	ticker := time.NewTicker(c.cleanupInterval)
+// cleanupRoutine advances the timing wheel every tick until stop is closed
+func (c *CacheUseARC) cleanupRoutine(stop chan struct{}, tick time.Duration) {
+	ticker := time.NewTicker(tick)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			c.CleanUp(c.ttl)
-		case <-c.stopCleanup:
+			c.expire(time.Now())
+		case <-stop:
 			return
 		}
 	}
 }
 
+// expire removes the entries whose timers have fired
+func (c *CacheUseARC) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.wheel.expire(now, c.ttl, c.entry, c.remove)
+}
+
+// entry returns the entry stored under key, or nil if there is none
+func (c *CacheUseARC) entry(key string) *Entry {
+	if ele, ok := c.cache[key]; ok {
+		return &ele.Value.(*arcEntry).Entry
+	}
+	return nil
+}
+
+// remove removes the entry stored under key, if any
+func (c *CacheUseARC) remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		entry := ele.Value.(*arcEntry)
+		c.removeEntry(ele, entry, !entry.inT2)
+	}
+}
+
+// trackAll schedules the expiration of every cached entry.
+// Caller must hold the lock.
+func (c *CacheUseARC) trackAll() {
+	for _, ele := range c.cache {
+		c.wheel.track(&ele.Value.(*arcEntry).Entry, c.ttl)
+	}
+}
+
 // CleanUp removes expired entries from the cache
 func (c *CacheUseARC) CleanUp(ttl time.Duration) {
 	c.mu.Lock()
@@ -290,9 +380,13 @@ func (c *CacheUseARC) CleanUp(ttl time.Duration) {
 	}
 }
 
-// SetTTL sets the time-to-live for cache entries
+// SetTTL sets the time-to-live for cache entries and reschedules their expiration.
+// A non-positive TTL disables expiration of entries without their own expiry time.
 func (c *CacheUseARC) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.ttl = ttl
+	c.trackAll()
 }
 
 // SetCleanupInterval sets the interval between cleanup runs
@@ -300,27 +394,55 @@ func (c *CacheUseARC) SetCleanupInterval(interval time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.stopCleanup != nil {
-		close(c.stopCleanup)
-	}
-
+	c.stopLocked()
 	c.cleanupInterval = interval
-	c.stopCleanup = make(chan struct{})
-
-	go c.cleanupRoutine()
+	c.startLocked()
 }
 
 // Stop stops the cleanup routine
 func (c *CacheUseARC) Stop() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.stopLocked()
+}
 
+// startLocked rebuilds the timing wheel and starts the cleanup routine.
+// The wheel ticks with the routine every cleanup interval, capped at
+// defaultWheelTick, so entries are removed at most one such tick after they
+// expire. Caller must hold the lock.
+func (c *CacheUseARC) startLocked() {
+	tick := c.cleanupInterval
+	if tick <= 0 || tick > defaultWheelTick {
+		tick = defaultWheelTick
+	}
+	c.wheel = newTimingWheel(tick, time.Now())
+	c.trackAll()
+
+	c.stopCleanup = make(chan struct{})
+	go c.cleanupRoutine(c.stopCleanup, tick)
+}
+
+// stopLocked stops the cleanup routine if it is running.
+// Caller must hold the lock.
+func (c *CacheUseARC) stopLocked() {
 	if c.stopCleanup != nil {
 		close(c.stopCleanup)
 		c.stopCleanup = nil
 	}
 }
 
+// Entries returns a snapshot of the cached entries ordered from least to most recently used
+func (c *CacheUseARC) Entries() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(c.cache))
+	for _, ele := range c.cache {
+		entries = append(entries, ele.Value.(*arcEntry).Entry)
+	}
+	return sortByRecency(entries)
+}
+
 // Len returns the number of items in the cache
 func (c *CacheUseARC) Len() int {
 	c.mu.RLock()
@@ -211,3 +211,30 @@ func TestCacheUseARC_GhostCache(t *testing.T) {
 		t.Errorf("Ghost cache not working effectively: only %d hits", hits)
 	}
 }
+
+func TestCacheUseARC_EvictWithOnlyT1(t *testing.T) {
+	arc := NewCacheUseARC(4, nil) // room for two entries of 2 bytes
+
+	done := make(chan struct{})
+	go func() {
+		arc.Put("a", String("1"))
+		arc.Get("a")
+		arc.Put("b", String("1"))
+		arc.Get("b")              // T1 empty, T2 holds b and a
+		arc.Put("c", String("1")) // evicts a from T2 into B2
+		arc.Put("a", String("1")) // B2 hit raises p and evicts b, leaving T2 empty
+		arc.Put("d", String("1")) // must still evict from T1
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Put did not return, eviction made no progress")
+	}
+	defer arc.Stop()
+
+	if arc.Len() != 2 {
+		t.Errorf("arc.Len() = %d, want 2", arc.Len())
+	}
+}
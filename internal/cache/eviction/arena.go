@@ -0,0 +1,538 @@
+package eviction
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ limiter          = (*CacheUseArena)(nil)
+	_ Enumerable       = (*CacheUseArena)(nil)
+	_ ExpiringStrategy = (*CacheUseArena)(nil)
+	_ expirable        = (*CacheUseArena)(nil)
+)
+
+const (
+	defaultArenaSize    = 64 << 20 // Default total capacity when maxBytes is not positive
+	initialArenaBufSize = 64 << 10 // Initial buffer size of each shard, grown on demand
+	arenaHeaderSize     = 32       // hash(8) + updateAt(8) + expireAt(8) + keyLen(4) + valLen(4)
+	arenaPaddingMark    = ^uint32(0)
+)
+
+// ByteValue is a Value that exposes its contents.
+// The arena strategy only stores values that implement it.
+type ByteValue interface {
+	Value
+	// Bytes returns the value's contents. The slice must not be modified.
+	Bytes() []byte
+}
+
+// BytesValue is the Value returned by the arena strategy.
+// It holds a private copy of the stored bytes.
+type BytesValue []byte
+
+// Len implements Value.
+func (b BytesValue) Len() int {
+	return len(b)
+}
+
+// Bytes implements ByteValue.
+func (b BytesValue) Bytes() []byte {
+	return b
+}
+
+// CacheUseArena stores entries in large per-shard byte ring buffers indexed
+// by maps of hash to offset, in the style of freecache and bigcache.
+// Neither the buffers nor the index contain pointers, so the garbage collector
+// does not scan the cached entries however many there are.
+//
+// Entries are evicted in insertion order (FIFO): when a shard's buffer is full,
+// the oldest entries are overwritten. Updating a key appends a new copy and the
+// old bytes are reclaimed when the ring wraps around. Get returns a BytesValue
+// holding a copy of the stored bytes.
+//
+// Each entry's expiration time is kept in its header. Expired entries are
+// misses from the moment they expire and their bytes are reclaimed when the
+// ring wraps around or CleanUp runs.
+type CacheUseArena struct {
+	shards     []*arenaShard
+	numShards  int
+	count      atomic.Int64 // Entries of all shards
+	maxEntries atomic.Int64 // Limit on count when it is too small to split across shards, 0 otherwise
+	OnEvicted  func(key string, value Value)
+}
+
+// arenaShard is one ring buffer with its own lock and index.
+type arenaShard struct {
+	mu         sync.RWMutex
+	buf        []byte
+	capacity   int               // Size the buffer may grow to
+	head       int               // Offset of the oldest entry
+	tail       int               // Offset where the next entry is written
+	used       int               // Bytes in use between head and tail, including padding
+	maxEntries int               // Maximum number of entries (0 means unlimited)
+	count      *atomic.Int64     // Entries of all shards, shared with the cache
+	ttl        time.Duration     // Lifetime of entries without their own expiration time (0 means forever)
+	index      map[uint64]uint32 // Key hash to entry offset
+	onEvicted  func(key string, value Value)
+}
+
+// NewCacheUseArena creates a new arena cache with the specified maximum size and eviction callback.
+// A non-positive maxBytes uses a 64 MiB capacity. Buffers are grown on demand up to that capacity.
+func NewCacheUseArena(maxBytes int64, onEvicted func(string, Value)) *CacheUseArena {
+	if maxBytes <= 0 {
+		maxBytes = defaultArenaSize
+	}
+
+	c := &CacheUseArena{
+		shards:    make([]*arenaShard, defaultNumSegments),
+		numShards: defaultNumSegments,
+		OnEvicted: onEvicted,
+	}
+
+	// Offsets are stored as uint32, which bounds the size of each shard.
+	shardCapacity := int(min(maxBytes/int64(defaultNumSegments), math.MaxUint32))
+	if shardCapacity < arenaHeaderSize {
+		shardCapacity = arenaHeaderSize
+	}
+	for i := range c.shards {
+		c.shards[i] = &arenaShard{
+			buf:       make([]byte, min(int64(initialArenaBufSize), int64(shardCapacity))),
+			capacity:  shardCapacity,
+			index:     make(map[uint64]uint32),
+			count:     &c.count,
+			onEvicted: onEvicted,
+		}
+	}
+	return c
+}
+
+// hashKey returns the 64-bit FNV-1a hash of key without allocating.
+func hashKey(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
+
+// getShard returns the shard that owns the given key hash.
+func (c *CacheUseArena) getShard(h uint64) *arenaShard {
+	return c.shards[h%uint64(c.numShards)]
+}
+
+// Get retrieves a copy of a value from the cache.
+// Accessing an item does not affect its position in the eviction order.
+func (c *CacheUseArena) Get(key string) (value Value, updateAt time.Time, ok bool) {
+	value, updateAt, _, ok = c.GetWithExpiry(key)
+	return value, updateAt, ok
+}
+
+// GetWithExpiry retrieves a copy of a value from the cache along with its
+// expiration time, zero if it never expires. Expired entries are not found.
+func (c *CacheUseArena) GetWithExpiry(key string) (value Value, updateAt, expireAt time.Time, ok bool) {
+	h := hashKey(key)
+	shard := c.getShard(h)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	off, ok := shard.lookup(h, key)
+	if !ok {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	hdr := shard.readHeader(off)
+	if hdr.expired(time.Now().UnixNano()) {
+		return nil, time.Time{}, time.Time{}, false
+	}
+	start := off + arenaHeaderSize + hdr.keyLen
+	v := make(BytesValue, hdr.valLen)
+	copy(v, shard.buf[start:start+hdr.valLen])
+	return v, time.Unix(0, hdr.updateAt), hdr.expireTime(), true
+}
+
+// Put copies a value into the cache.
+// Values that do not implement ByteValue, or that are larger than a shard, are not stored.
+func (c *CacheUseArena) Put(key string, value Value) {
+	c.PutWithExpiry(key, value, time.Time{})
+}
+
+// PutWithExpiry copies a value that expires at expireAt into the cache.
+// A zero expireAt applies the cache-wide TTL, like Put.
+func (c *CacheUseArena) PutWithExpiry(key string, value Value, expireAt time.Time) {
+	bv, ok := value.(ByteValue)
+	if !ok {
+		return
+	}
+
+	h := hashKey(key)
+	shard := c.getShard(h)
+	shard.mu.Lock()
+	shard.put(h, key, bv.Bytes(), time.Now(), expireAt)
+	shard.mu.Unlock()
+
+	c.evictGlobalOverflow(shard)
+}
+
+// CleanUp removes expired entries from the cache: those written more than
+// ttl ago and those past their own expiration time.
+// Entries are written in time order, so the ttl scan of each shard stops at
+// its first live entry. Entries that expire on their own are dropped from the
+// index, and their bytes reclaimed when the ring reaches them.
+func (c *CacheUseArena) CleanUp(ttl time.Duration) {
+	now := time.Now()
+	deadline := now.Add(-ttl).UnixNano()
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for shard.used > 0 {
+			off := shard.normalizedHead()
+			if shard.used == 0 {
+				break
+			}
+			if hdr := shard.readHeader(off); !hdr.padding() && hdr.updateAt >= deadline {
+				break
+			}
+			shard.evictHead()
+		}
+		shard.removeExpired(now.UnixNano())
+		shard.mu.Unlock()
+	}
+}
+
+// SetTTL sets the lifetime of the entries put without their own expiration
+// time. It applies to entries put from now on.
+func (c *CacheUseArena) SetTTL(ttl time.Duration) {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.ttl = ttl
+		shard.mu.Unlock()
+	}
+}
+
+// SetCleanupInterval is a no-op: the arena runs no cleanup routine. Expired
+// entries are misses as soon as they expire and their bytes are reclaimed as
+// the ring wraps around.
+func (c *CacheUseArena) SetCleanupInterval(time.Duration) {}
+
+// Entries returns a snapshot of the cached entries ordered from least to most recently written.
+// Values are copied out of the arena as BytesValue.
+func (c *CacheUseArena) Entries() []Entry {
+	var entries []Entry
+	now := time.Now().UnixNano()
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		for _, off32 := range shard.index {
+			off := int(off32)
+			hdr := shard.readHeader(off)
+			if hdr.expired(now) {
+				continue
+			}
+			start := off + arenaHeaderSize
+			value := make(BytesValue, hdr.valLen)
+			copy(value, shard.buf[start+hdr.keyLen:start+hdr.keyLen+hdr.valLen])
+			entries = append(entries, Entry{
+				Key:      string(shard.buf[start : start+hdr.keyLen]),
+				Value:    value,
+				UpdateAt: time.Unix(0, hdr.updateAt),
+				ExpireAt: hdr.expireTime(),
+			})
+		}
+		shard.mu.RUnlock()
+	}
+	return sortByRecency(entries)
+}
+
+// Len returns the number of items in the cache.
+func (c *CacheUseArena) Len() int {
+	total := 0
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		total += len(shard.index)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// SetSizer is a no-op: the arena always accounts the bytes it actually uses,
+// including a fixed header per entry and the space of overwritten values.
+func (c *CacheUseArena) SetSizer(Sizer) {}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+// Like maxBytes, the limit is split across shards, the first n%numShards of
+// which hold one entry more. A limit smaller than the number of shards cannot
+// be split, so it bounds the total count instead, evicting from the shard
+// being written first.
+func (c *CacheUseArena) SetMaxEntries(n int) {
+	split := n >= c.numShards
+	if split || n <= 0 {
+		c.maxEntries.Store(0)
+	} else {
+		c.maxEntries.Store(int64(n))
+	}
+
+	for i, shard := range c.shards {
+		shard.mu.Lock()
+		shard.maxEntries = 0
+		if split {
+			shard.maxEntries = n / c.numShards
+			if i < n%c.numShards {
+				shard.maxEntries++
+			}
+		}
+		shard.evictOverflow()
+		shard.mu.Unlock()
+	}
+	c.evictGlobalOverflow(nil)
+}
+
+// evictGlobalOverflow removes the oldest entries while the cache holds more
+// entries than the global limit, from first before the other shards. The
+// newest entry of first, just written, is kept.
+func (c *CacheUseArena) evictGlobalOverflow(first *arenaShard) {
+	limit := c.maxEntries.Load()
+	if limit == 0 || c.count.Load() <= limit {
+		return
+	}
+
+	shards := c.shards
+	if first != nil {
+		shards = append([]*arenaShard{first}, c.shards...)
+	}
+	for _, shard := range shards {
+		keep := 0
+		if shard == first {
+			keep = 1
+		}
+		shard.mu.Lock()
+		for c.count.Load() > limit && len(shard.index) > keep && shard.used > 0 {
+			shard.evictHead()
+		}
+		shard.mu.Unlock()
+		if c.count.Load() <= limit {
+			return
+		}
+	}
+}
+
+// lookup returns the offset of key's entry. Caller must hold the lock.
+func (s *arenaShard) lookup(h uint64, key string) (int, bool) {
+	off32, ok := s.index[h]
+	if !ok {
+		return 0, false
+	}
+	off := int(off32)
+	keyLen := s.readHeader(off).keyLen
+	start := off + arenaHeaderSize
+	if keyLen != len(key) || string(s.buf[start:start+keyLen]) != key {
+		return 0, false // hash collision with another key
+	}
+	return off, true
+}
+
+// put appends an entry that expires at expireAt, or after the shard's TTL if
+// it is zero, to the ring. Caller must hold the lock.
+func (s *arenaShard) put(h uint64, key string, value []byte, now time.Time, expireAt time.Time) {
+	size := arenaHeaderSize + len(key) + len(value)
+	if size > s.capacity {
+		return
+	}
+
+	// An existing entry, or a colliding key, is superseded by the new copy.
+	if _, ok := s.index[h]; ok {
+		delete(s.index, h)
+		s.count.Add(-1)
+	}
+
+	if expireAt.IsZero() && s.ttl > 0 {
+		expireAt = now.Add(s.ttl)
+	}
+	var expireNanos int64 // zero for entries that never expire
+	if !expireAt.IsZero() {
+		expireNanos = expireAt.UnixNano()
+	}
+
+	off := s.alloc(size)
+	binary.LittleEndian.PutUint64(s.buf[off:], h)
+	binary.LittleEndian.PutUint64(s.buf[off+8:], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint64(s.buf[off+16:], uint64(expireNanos))
+	binary.LittleEndian.PutUint32(s.buf[off+24:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(s.buf[off+28:], uint32(len(value)))
+	copy(s.buf[off+arenaHeaderSize:], key)
+	copy(s.buf[off+arenaHeaderSize+len(key):], value)
+	s.index[h] = uint32(off)
+	s.count.Add(1)
+
+	s.evictOverflow()
+}
+
+// alloc reserves n contiguous bytes at the tail, evicting the oldest entries
+// as needed, and returns their offset. Caller must hold the lock.
+func (s *arenaShard) alloc(n int) int {
+	for {
+		if s.used == 0 {
+			s.head, s.tail = 0, 0
+		}
+
+		wrapped := s.tail < s.head || (s.tail == s.head && s.used > 0)
+		if !wrapped {
+			if len(s.buf)-s.tail >= n {
+				return s.advanceTail(n)
+			}
+			if len(s.buf) < s.capacity {
+				s.grow(s.tail + n)
+				continue
+			}
+			// Not enough room at the end: pad it and continue from the start.
+			if pad := len(s.buf) - s.tail; pad >= arenaHeaderSize {
+				binary.LittleEndian.PutUint32(s.buf[s.tail+24:], uint32(pad-arenaHeaderSize))
+				binary.LittleEndian.PutUint32(s.buf[s.tail+28:], arenaPaddingMark)
+			}
+			s.used += len(s.buf) - s.tail
+			s.tail = 0
+			continue
+		}
+
+		if s.head-s.tail >= n {
+			return s.advanceTail(n)
+		}
+		s.evictHead()
+	}
+}
+
+// advanceTail claims n bytes at the tail and returns their offset.
+func (s *arenaShard) advanceTail(n int) int {
+	off := s.tail
+	s.tail += n
+	s.used += n
+	if s.tail == len(s.buf) {
+		s.tail = 0
+	}
+	return off
+}
+
+// grow enlarges the buffer so that it holds at least n bytes.
+// It is only called while the ring has not wrapped, so offsets stay valid.
+func (s *arenaShard) grow(n int) {
+	size := len(s.buf) * 2
+	if size < n {
+		size = n
+	}
+	if size > s.capacity {
+		size = s.capacity
+	}
+	buf := make([]byte, size)
+	copy(buf, s.buf[:s.tail])
+	s.buf = buf
+}
+
+// normalizedHead moves head to the start of the buffer if the remaining
+// bytes at the end cannot hold a header, and returns it.
+func (s *arenaShard) normalizedHead() int {
+	if len(s.buf)-s.head < arenaHeaderSize {
+		s.used -= len(s.buf) - s.head
+		s.head = 0
+	}
+	return s.head
+}
+
+// evictHead removes the oldest entry or padding from the ring. Caller must hold the lock.
+func (s *arenaShard) evictHead() {
+	off := s.normalizedHead()
+	if s.used == 0 {
+		return
+	}
+
+	// For padding, keyLen holds the number of padding bytes after the header.
+	hdr := s.readHeader(off)
+	size := arenaHeaderSize + hdr.keyLen
+	if !hdr.padding() {
+		size += hdr.valLen
+		if cur, ok := s.index[hdr.hash]; ok && int(cur) == off {
+			s.remove(off, hdr)
+		}
+	}
+
+	s.head += size
+	s.used -= size
+	if s.head == len(s.buf) {
+		s.head = 0
+	}
+}
+
+// removeExpired drops the entries past their expiration time from the index.
+// Their bytes stay in the ring until it reaches them. Caller must hold the lock.
+func (s *arenaShard) removeExpired(now int64) {
+	for _, off32 := range s.index {
+		off := int(off32)
+		if hdr := s.readHeader(off); hdr.expired(now) {
+			s.remove(off, hdr)
+		}
+	}
+}
+
+// remove drops the indexed entry at off and reports it to onEvicted.
+// Caller must hold the lock.
+func (s *arenaShard) remove(off int, hdr arenaHeader) {
+	delete(s.index, hdr.hash)
+	s.count.Add(-1)
+	if s.onEvicted != nil {
+		start := off + arenaHeaderSize
+		key := string(s.buf[start : start+hdr.keyLen])
+		value := make(BytesValue, hdr.valLen)
+		copy(value, s.buf[start+hdr.keyLen:start+hdr.keyLen+hdr.valLen])
+		s.onEvicted(key, value)
+	}
+}
+
+// evictOverflow removes the oldest entries until the shard is within its entry limit.
+func (s *arenaShard) evictOverflow() {
+	for s.maxEntries > 0 && len(s.index) > s.maxEntries && s.used > 0 {
+		s.evictHead()
+	}
+}
+
+// arenaHeader is the decoded header of an entry or of padding.
+type arenaHeader struct {
+	hash     uint64
+	updateAt int64 // Unix nanoseconds
+	expireAt int64 // Unix nanoseconds, zero if the entry never expires
+	keyLen   int
+	valLen   int
+}
+
+// padding reports whether the header marks padding rather than an entry.
+func (h arenaHeader) padding() bool {
+	return h.valLen == int(arenaPaddingMark)
+}
+
+// expired reports whether the entry has expired at now, in Unix nanoseconds.
+func (h arenaHeader) expired(now int64) bool {
+	return h.expireAt != 0 && now >= h.expireAt
+}
+
+// expireTime returns the expiration time of the entry, zero if it never expires.
+func (h arenaHeader) expireTime() time.Time {
+	if h.expireAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, h.expireAt)
+}
+
+// readHeader decodes the entry header at off.
+func (s *arenaShard) readHeader(off int) arenaHeader {
+	b := s.buf[off : off+arenaHeaderSize]
+	return arenaHeader{
+		hash:     binary.LittleEndian.Uint64(b),
+		updateAt: int64(binary.LittleEndian.Uint64(b[8:])),
+		expireAt: int64(binary.LittleEndian.Uint64(b[16:])),
+		keyLen:   int(binary.LittleEndian.Uint32(b[24:])),
+		valLen:   int(binary.LittleEndian.Uint32(b[28:])),
+	}
+}
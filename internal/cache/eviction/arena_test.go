@@ -0,0 +1,269 @@
+package eviction
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheUseArena_Operations(t *testing.T) {
+	t.Run("basic operations", func(t *testing.T) {
+		cache := NewCacheUseArena(1<<20, nil)
+
+		// Test Put and Get
+		cache.Put("key1", BytesValue("value1"))
+		if v, _, ok := cache.Get("key1"); !ok || string(v.(BytesValue)) != "value1" {
+			t.Errorf("Get after Put failed, got %v, want %v", v, "value1")
+		}
+
+		// Test missing key
+		if _, _, ok := cache.Get("missing"); ok {
+			t.Error("Get with missing key should return false")
+		}
+
+		// Test update existing key
+		cache.Put("key1", BytesValue("value2"))
+		if v, _, ok := cache.Get("key1"); !ok || string(v.(BytesValue)) != "value2" {
+			t.Errorf("Get after update failed, got %v, want %v", v, "value2")
+		}
+		if cache.Len() != 1 {
+			t.Errorf("cache.Len() = %d, want 1", cache.Len())
+		}
+	})
+
+	t.Run("returned value is a copy", func(t *testing.T) {
+		cache := NewCacheUseArena(1<<20, nil)
+		cache.Put("key1", BytesValue("value1"))
+
+		v, _, _ := cache.Get("key1")
+		v.(BytesValue)[0] = 'X'
+		if v, _, _ := cache.Get("key1"); string(v.(BytesValue)) != "value1" {
+			t.Errorf("stored value was modified through Get, got %q", v)
+		}
+	})
+
+	t.Run("values without bytes are ignored", func(t *testing.T) {
+		cache := NewCacheUseArena(1<<20, nil)
+		cache.Put("key1", String("value1"))
+		if cache.Len() != 0 {
+			t.Errorf("cache.Len() = %d, want 0", cache.Len())
+		}
+	})
+}
+
+func TestCacheUseArena_Eviction(t *testing.T) {
+	var mu sync.Mutex
+	evicted := make(map[string]Value)
+	onEvicted := func(key string, value Value) {
+		mu.Lock()
+		evicted[key] = value
+		mu.Unlock()
+	}
+
+	// Each shard holds 1024 bytes: 16 entries of 64 bytes.
+	cache := NewCacheUseArena(16*1024, onEvicted)
+	value := BytesValue(make([]byte, 64-arenaHeaderSize-len("key-000")))
+
+	for i := 0; i < 1000; i++ {
+		cache.Put(fmt.Sprintf("key-%03d", i), value)
+	}
+
+	if got := cache.Len(); got == 0 || got > 256 {
+		t.Errorf("cache.Len() = %d, want between 1 and 256", got)
+	}
+	if got := len(evicted) + cache.Len(); got != 1000 {
+		t.Errorf("evicted + cached = %d, want 1000", got)
+	}
+	// The most recent entry always survives.
+	if _, _, ok := cache.Get("key-999"); !ok {
+		t.Error("most recently added key should be present")
+	}
+	if _, _, ok := cache.Get("key-000"); ok {
+		t.Error("oldest key should have been evicted")
+	}
+	if v, ok := evicted["key-000"]; !ok || v.Len() != len(value) {
+		t.Errorf("eviction callback got %v for key-000", v)
+	}
+}
+
+func TestCacheUseArena_Wraparound(t *testing.T) {
+	// Entries of varying size force padding at the end of each ring.
+	cache := NewCacheUseArena(16*1000, nil)
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("k%d", i)
+		cache.Put(key, BytesValue(make([]byte, i%97)))
+		if v, _, ok := cache.Get(key); !ok || v.Len() != i%97 {
+			t.Fatalf("Get(%s) after Put = %v, %v", key, v, ok)
+		}
+	}
+}
+
+func TestCacheUseArena_CleanUp(t *testing.T) {
+	cache := NewCacheUseArena(1<<20, nil)
+
+	cache.Put("k1", BytesValue("v1"))
+	cache.Put("k2", BytesValue("v2"))
+	time.Sleep(10 * time.Millisecond)
+	cache.Put("k3", BytesValue("v3"))
+
+	cache.CleanUp(5 * time.Millisecond)
+
+	if cache.Len() != 1 {
+		t.Errorf("CleanUp failed, got len = %d, want 1", cache.Len())
+	}
+	if _, _, ok := cache.Get("k3"); !ok {
+		t.Error("k3 should not have expired")
+	}
+}
+
+func TestCacheUseArena_Expiry(t *testing.T) {
+	var evicted []string
+	cache := NewCacheUseArena(1<<20, func(key string, _ Value) { evicted = append(evicted, key) })
+	cache.SetTTL(20 * time.Millisecond)
+
+	cache.Put("ttl", BytesValue("v"))
+	cache.PutWithExpiry("short", BytesValue("v"), time.Now().Add(5*time.Millisecond))
+	cache.PutWithExpiry("long", BytesValue("v"), time.Now().Add(time.Hour))
+
+	if _, _, expireAt, ok := cache.GetWithExpiry("long"); !ok || expireAt.IsZero() {
+		t.Errorf("GetWithExpiry(long) = %v, %v, want its expiration time", expireAt, ok)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, _, ok := cache.Get("short"); ok {
+		t.Error("short should have expired")
+	}
+	if _, _, ok := cache.Get("ttl"); !ok {
+		t.Error("ttl should not have expired yet")
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if _, _, ok := cache.Get("ttl"); ok {
+		t.Error("ttl should have expired with the cache-wide TTL")
+	}
+
+	// Long TTL so that only the expiration times remove entries.
+	cache.CleanUp(time.Hour)
+	if got := cache.Len(); got != 1 {
+		t.Errorf("cache.Len() after CleanUp = %d, want 1", got)
+	}
+	if len(evicted) != 2 {
+		t.Errorf("evicted %v, want the two expired entries", evicted)
+	}
+	if entries := cache.Entries(); len(entries) != 1 || entries[0].Key != "long" || entries[0].ExpireAt.IsZero() {
+		t.Errorf("Entries() = %+v, want long with its expiration time", entries)
+	}
+}
+
+func TestCacheUseArena_MaxEntries(t *testing.T) {
+	for _, n := range []int{1, 5, 32, 40} {
+		cache := NewCacheUseArena(1<<20, nil)
+		cache.SetMaxEntries(n)
+
+		for i := 0; i < 1000; i++ {
+			cache.Put(fmt.Sprintf("key-%d", i), BytesValue("v"))
+		}
+		if got := cache.Len(); got == 0 || got > n {
+			t.Errorf("cache.Len() with a limit of %d = %d, want between 1 and %d", n, got, n)
+		}
+		// The last entry put is never evicted to make room for itself.
+		if _, _, ok := cache.Get("key-999"); !ok {
+			t.Errorf("the last entry put is missing with a limit of %d", n)
+		}
+	}
+}
+
+func TestCacheUseArena_Concurrent(t *testing.T) {
+	cache := NewCacheUseArena(64*1024, nil)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("w%d-%d", id, j%100)
+				cache.Put(key, BytesValue(key))
+				if v, _, ok := cache.Get(key); ok && string(v.(BytesValue)) != key {
+					t.Errorf("Get(%s) = %s", key, v)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// benchmarkEntries is the number of small entries held in the cache while measuring GC.
+const benchmarkEntries = 1_000_000
+
+// fillForGC fills s with benchmarkEntries score-sized entries.
+func fillForGC(s CacheStrategy) {
+	for i := 0; i < benchmarkEntries; i++ {
+		s.Put(fmt.Sprintf("student-%d", i), BytesValue("98.50"))
+	}
+}
+
+// BenchmarkGCPause reports the time a forced collection takes while
+// a million small entries are cached by each storage layout.
+func BenchmarkGCPause(b *testing.B) {
+	strategies := map[string]func() CacheStrategy{
+		"lru":   func() CacheStrategy { return NewCacheUseLRU(0, nil) },
+		"fifo":  func() CacheStrategy { return NewCacheUseFIFO(0, nil) },
+		"arena": func() CacheStrategy { return NewCacheUseArena(256<<20, nil) },
+	}
+
+	for _, name := range []string{"lru", "fifo", "arena"} {
+		b.Run(name, func(b *testing.B) {
+			s := strategies[name]()
+			if stopper, ok := s.(Stopper); ok {
+				defer stopper.Stop()
+			}
+			fillForGC(s)
+			runtime.GC()
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+
+			pause := after.PauseTotalNs - before.PauseTotalNs
+			b.ReportMetric(float64(pause)/float64(b.N), "pause-ns/gc")
+			b.ReportMetric(float64(after.HeapObjects), "heap-objects")
+			runtime.KeepAlive(s)
+		})
+	}
+}
+
+// BenchmarkPut reports allocations per Put for each storage layout.
+func BenchmarkPut(b *testing.B) {
+	strategies := map[string]func() CacheStrategy{
+		"lru":   func() CacheStrategy { return NewCacheUseLRU(64<<20, nil) },
+		"fifo":  func() CacheStrategy { return NewCacheUseFIFO(64<<20, nil) },
+		"arena": func() CacheStrategy { return NewCacheUseArena(64<<20, nil) },
+	}
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("student-%d", i)
+	}
+
+	for _, name := range []string{"lru", "fifo", "arena"} {
+		b.Run(name, func(b *testing.B) {
+			s := strategies[name]()
+			if stopper, ok := s.(Stopper); ok {
+				defer stopper.Stop()
+			}
+			value := BytesValue("98.50")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Put(keys[i&(len(keys)-1)], value)
+			}
+		})
+	}
+}
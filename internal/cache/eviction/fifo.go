@@ -6,12 +6,16 @@ import (
 	"time"
 )
 
+var (
+	_ limiter    = (*CacheUseFIFO)(nil)
+	_ Enumerable = (*CacheUseFIFO)(nil)
+)
+
 // CacheUseFIFO implements a First-In-First-Out (FIFO) cache.
 // It maintains both a hash table for O(1) lookups and a doubly linked list
 // for efficient removal of the oldest items.
 type CacheUseFIFO struct {
-	maxBytes  int64                         // Maximum allowed size in bytes (0 means unlimited)
-	nbytes    int64                         // Current size in bytes
+	limits
 	ll        *list.List                    // Doubly linked list for FIFO ordering
 	cache     map[string]*list.Element      // Hash table for O(1) lookups
 	mu        sync.RWMutex                  // Protects shared resources
@@ -21,7 +25,7 @@ type CacheUseFIFO struct {
 // NewCacheUseFIFO creates a new FIFO cache with the specified maximum size and eviction callback.
 func NewCacheUseFIFO(maxBytes int64, onEvicted func(string, Value)) *CacheUseFIFO {
 	return &CacheUseFIFO{
-		maxBytes:  maxBytes,
+		limits:    limits{maxBytes: maxBytes},
 		ll:        list.New(),
 		cache:     make(map[string]*list.Element),
 		OnEvicted: onEvicted,
@@ -53,9 +57,10 @@ func (cuf *CacheUseFIFO) Put(key string, value Value) {
 
 	if ele, ok := cuf.cache[key]; ok {
 		entry := ele.Value.(*Entry)
-		cuf.nbytes += int64(value.Len()) - int64(entry.Value.Len())
+		cuf.nbytes += cuf.sizeOf(key, value) - cuf.sizeOf(key, entry.Value)
 		entry.Value = value
 		entry.Touch()
+		cuf.evictOverflow()
 		return
 	}
 
@@ -67,15 +72,42 @@ func (cuf *CacheUseFIFO) Put(key string, value Value) {
 	}
 	ele := cuf.ll.PushBack(newEntry)
 	cuf.cache[key] = ele
-	cuf.nbytes += int64(len(newEntry.Key)) +
-		int64(newEntry.Value.Len())
+	cuf.nbytes += cuf.sizeOf(newEntry.Key, newEntry.Value)
+
+	cuf.evictOverflow()
+}
 
-	// Remove oldest entries if cache exceeds size limit
-	for cuf.maxBytes != 0 && cuf.maxBytes < cuf.nbytes {
+// evictOverflow removes oldest entries until the cache is within its limits.
+// Caller must hold the lock.
+func (cuf *CacheUseFIFO) evictOverflow() {
+	for cuf.ll.Len() > 0 && cuf.overLimit(cuf.ll.Len()) {
 		cuf.removeFront()
 	}
 }
 
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (cuf *CacheUseFIFO) SetSizer(sizer Sizer) {
+	cuf.mu.Lock()
+	defer cuf.mu.Unlock()
+
+	cuf.sizer = sizer
+	cuf.nbytes = 0
+	for e := cuf.ll.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*Entry)
+		cuf.nbytes += cuf.sizeOf(entry.Key, entry.Value)
+	}
+	cuf.evictOverflow()
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (cuf *CacheUseFIFO) SetMaxEntries(n int) {
+	cuf.mu.Lock()
+	defer cuf.mu.Unlock()
+	cuf.maxEntries = n
+	cuf.evictOverflow()
+}
+
 // removeFront removes the oldest item from the cache.
 // Caller must hold the lock.
 func (cuf *CacheUseFIFO) removeFront() {
@@ -108,6 +140,19 @@ func (cuf *CacheUseFIFO) CleanUp(ttl time.Duration) {
 	}
 }
 
+// Entries returns a snapshot of the cached entries in insertion order,
+// which is the order in which FIFO evicts them.
+func (cuf *CacheUseFIFO) Entries() []Entry {
+	cuf.mu.RLock()
+	defer cuf.mu.RUnlock()
+
+	entries := make([]Entry, 0, cuf.ll.Len())
+	for e := cuf.ll.Front(); e != nil; e = e.Next() {
+		entries = append(entries, *e.Value.(*Entry))
+	}
+	return entries
+}
+
 // Len returns the number of items in the cache.
 func (cuf *CacheUseFIFO) Len() int {
 	cuf.mu.RLock()
@@ -121,7 +166,7 @@ func (cuf *CacheUseFIFO) Len() int {
 func (cuf *CacheUseFIFO) removeElement(e *list.Element) {
 	entry := cuf.ll.Remove(e).(*Entry)
 	delete(cuf.cache, entry.Key)
-	cuf.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
+	cuf.nbytes -= cuf.sizeOf(entry.Key, entry.Value)
 	if cuf.OnEvicted != nil {
 		cuf.OnEvicted(entry.Key, entry.Value)
 	}
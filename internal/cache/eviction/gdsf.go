@@ -0,0 +1,253 @@
+package eviction
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+var (
+	_ limiter           = (*CacheUseGDSF)(nil)
+	_ CostAwareStrategy = (*CacheUseGDSF)(nil)
+	_ Enumerable        = (*CacheUseGDSF)(nil)
+)
+
+// DefaultLoadCost is the cost assumed for entries put without a measured cost.
+const DefaultLoadCost = 10 * time.Millisecond
+
+// gdsfEntry represents an entry in the GDSF cache.
+type gdsfEntry struct {
+	entry    Entry
+	index    int           // The index of the entry in the heap
+	freq     int           // Number of times this entry has been accessed
+	cost     time.Duration // Time it took to load the value
+	priority float64       // Inflation value when last accessed plus freq * cost / size
+}
+
+// gdsfHeap implements a min-heap of gdsfEntry items ordered by priority.
+type gdsfHeap []*gdsfEntry
+
+func (h gdsfHeap) Len() int { return len(h) }
+
+// Less orders entries by priority, then by update time for equal priorities.
+func (h gdsfHeap) Less(i, j int) bool {
+	if h[i].priority == h[j].priority {
+		return h[i].entry.UpdateAt.Before(h[j].entry.UpdateAt)
+	}
+	return h[i].priority < h[j].priority
+}
+
+func (h gdsfHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *gdsfHeap) Push(x interface{}) {
+	e := x.(*gdsfEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *gdsfHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil // Avoid memory leak
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// CacheUseGDSF implements the Greedy-Dual-Size-Frequency (GDSF) algorithm.
+// Each entry has the priority
+//
+//	L + frequency * cost / size
+//
+// where cost is the time it took to load the value and L is an inflation value
+// set to the priority of the last evicted entry. The entry with the lowest
+// priority is evicted, so small entries that are accessed often and are
+// expensive to reload stay longest, while the growing L ages out entries
+// that are no longer accessed.
+type CacheUseGDSF struct {
+	limits
+	mu          sync.Mutex
+	cache       map[string]*gdsfEntry
+	heap        gdsfHeap
+	inflation   float64       // L, the priority of the last evicted entry
+	defaultCost time.Duration // Cost of entries put without a measured cost
+	OnEvicted   func(key string, value Value)
+}
+
+// NewCacheUseGDSF creates a new GDSF cache with the specified maximum size and eviction callback.
+func NewCacheUseGDSF(maxBytes int64, onEvicted func(string, Value)) *CacheUseGDSF {
+	return &CacheUseGDSF{
+		limits:      limits{maxBytes: maxBytes},
+		cache:       make(map[string]*gdsfEntry),
+		defaultCost: DefaultLoadCost,
+		OnEvicted:   onEvicted,
+	}
+}
+
+// SetDefaultCost sets the cost assumed for entries put without a measured cost.
+// Non-positive costs are ignored.
+func (c *CacheUseGDSF) SetDefaultCost(cost time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cost > 0 {
+		c.defaultCost = cost
+	}
+}
+
+// Get retrieves a value from the cache and records the access.
+func (c *CacheUseGDSF) Get(key string) (Value, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.cache[key]; ok {
+		e.freq++
+		e.entry.Touch()
+		c.prioritize(e)
+		return e.entry.Value, e.entry.UpdateAt, true
+	}
+	return nil, time.Time{}, false
+}
+
+// Put adds or updates a value in the cache with the default cost.
+// Updating an entry keeps the cost measured for it, if any.
+func (c *CacheUseGDSF) Put(key string, value Value) {
+	c.PutWithCost(key, value, 0)
+}
+
+// PutWithCost adds or updates a value that took cost to load.
+// A non-positive cost keeps the entry's current cost, or uses the default cost for new entries.
+func (c *CacheUseGDSF) PutWithCost(key string, value Value, cost time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += c.sizeOf(key, value) - c.sizeOf(key, e.entry.Value)
+		e.entry.Value = value
+		e.entry.Touch()
+		e.freq++
+		if cost > 0 {
+			e.cost = cost
+		}
+		c.prioritize(e)
+		c.evictOverflow()
+		return
+	}
+
+	if cost <= 0 {
+		cost = c.defaultCost
+	}
+	e := &gdsfEntry{
+		entry: Entry{
+			Key:      key,
+			Value:    value,
+			UpdateAt: time.Now(),
+		},
+		freq: 1,
+		cost: cost,
+	}
+	e.priority = c.priorityOf(e)
+	heap.Push(&c.heap, e)
+	c.cache[key] = e
+	c.nbytes += c.sizeOf(key, value)
+
+	c.evictOverflow()
+}
+
+// priorityOf returns the GDSF priority of e at the current inflation value.
+func (c *CacheUseGDSF) priorityOf(e *gdsfEntry) float64 {
+	size := c.sizeOf(e.entry.Key, e.entry.Value)
+	if size < 1 {
+		size = 1
+	}
+	return c.inflation + float64(e.freq)*e.cost.Seconds()/float64(size)
+}
+
+// prioritize recomputes the priority of e and restores the heap order.
+func (c *CacheUseGDSF) prioritize(e *gdsfEntry) {
+	e.priority = c.priorityOf(e)
+	heap.Fix(&c.heap, e.index)
+}
+
+// evictOverflow evicts the lowest priority entries until the cache is within its limits.
+// Caller must hold the lock.
+func (c *CacheUseGDSF) evictOverflow() {
+	for len(c.heap) > 0 && c.overLimit(len(c.heap)) {
+		e := heap.Pop(&c.heap).(*gdsfEntry)
+		c.inflation = e.priority
+		c.remove(e)
+	}
+}
+
+// remove deletes an entry that is no longer in the heap.
+// Caller must hold the lock.
+func (c *CacheUseGDSF) remove(e *gdsfEntry) {
+	delete(c.cache, e.entry.Key)
+	c.nbytes -= c.sizeOf(e.entry.Key, e.entry.Value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.entry.Key, e.entry.Value)
+	}
+}
+
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size and priority of the entries already cached.
+func (c *CacheUseGDSF) SetSizer(sizer Sizer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sizer = sizer
+	c.nbytes = 0
+	for _, e := range c.heap {
+		c.nbytes += c.sizeOf(e.entry.Key, e.entry.Value)
+		e.priority = c.priorityOf(e)
+	}
+	heap.Init(&c.heap)
+	c.evictOverflow()
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (c *CacheUseGDSF) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evictOverflow()
+}
+
+// CleanUp removes all expired entries from the cache.
+// Expiration does not change the inflation value.
+func (c *CacheUseGDSF) CleanUp(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.cache {
+		if e.entry.Expired(ttl) {
+			heap.Remove(&c.heap, e.index)
+			c.remove(e)
+		}
+	}
+}
+
+// Entries returns a snapshot of the cached entries ordered from least to most recently used.
+func (c *CacheUseGDSF) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]Entry, 0, len(c.cache))
+	for _, e := range c.cache {
+		entry := e.entry
+		entry.Cost = e.cost
+		entries = append(entries, entry)
+	}
+	return sortByRecency(entries)
+}
+
+// Len returns the number of items in the cache.
+func (c *CacheUseGDSF) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.cache)
+}
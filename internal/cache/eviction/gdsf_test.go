@@ -0,0 +1,107 @@
+package eviction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheUseGDSF_Basic(t *testing.T) {
+	gdsf := NewCacheUseGDSF(1024, nil)
+
+	gdsf.Put("key1", String("value1"))
+	if v, _, ok := gdsf.Get("key1"); !ok || string(v.(String)) != "value1" {
+		t.Errorf("Get after Put failed, got %v, want %v", v, "value1")
+	}
+	if _, _, ok := gdsf.Get("missing"); ok {
+		t.Error("Get with missing key should return false")
+	}
+
+	gdsf.Put("key1", String("value2"))
+	if v, _, ok := gdsf.Get("key1"); !ok || string(v.(String)) != "value2" {
+		t.Errorf("Get after update failed, got %v, want %v", v, "value2")
+	}
+	if e := gdsf.cache["key1"]; e.cost != DefaultLoadCost || e.freq != 4 {
+		t.Errorf("entry cost = %v, freq = %d, want %v and 4", e.cost, e.freq, DefaultLoadCost)
+	}
+}
+
+func TestCacheUseGDSF_Eviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		puts        func(c *CacheUseGDSF)
+		wantEvicted string
+	}{
+		{
+			name: "cheap entry is evicted before expensive one",
+			puts: func(c *CacheUseGDSF) {
+				c.PutWithCost("slow", String("v"), 200*time.Millisecond)
+				c.PutWithCost("fast", String("v"), 2*time.Millisecond)
+			},
+			wantEvicted: "fast",
+		},
+		{
+			name: "large entry is evicted before small one of equal cost",
+			puts: func(c *CacheUseGDSF) {
+				c.PutWithCost("small", String("v"), 10*time.Millisecond)
+				c.PutWithCost("large", String("vvvv"), 10*time.Millisecond)
+			},
+			wantEvicted: "large",
+		},
+		{
+			name: "frequent entry is evicted after infrequent one",
+			puts: func(c *CacheUseGDSF) {
+				c.PutWithCost("hot", String("v"), 10*time.Millisecond)
+				c.PutWithCost("cold", String("v"), 10*time.Millisecond)
+				c.Get("hot")
+			},
+			wantEvicted: "cold",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evicted []string
+			c := NewCacheUseGDSF(0, func(key string, _ Value) { evicted = append(evicted, key) })
+			tt.puts(c)
+
+			c.SetMaxEntries(1)
+			if len(evicted) != 1 || evicted[0] != tt.wantEvicted {
+				t.Errorf("evicted = %v, want [%s]", evicted, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestCacheUseGDSF_Inflation(t *testing.T) {
+	c := NewCacheUseGDSF(0, nil)
+	c.SetMaxEntries(2)
+
+	// An expensive entry that is never accessed again must eventually age out.
+	c.PutWithCost("old", String("v"), 100*time.Millisecond)
+	for i := 0; i < 200; i++ {
+		key := string(rune('a' + i%26))
+		c.PutWithCost(key, String("v"), 10*time.Millisecond)
+		c.Get(key)
+	}
+
+	if _, _, ok := c.Get("old"); ok {
+		t.Error("old should have been evicted once the inflation value exceeded its priority")
+	}
+	if c.inflation <= 0 {
+		t.Errorf("inflation = %v, want > 0 after evictions", c.inflation)
+	}
+}
+
+func TestCacheUseGDSF_CleanUp(t *testing.T) {
+	c := NewCacheUseGDSF(1024, nil)
+	c.Put("k1", String("v1"))
+	c.Put("k2", String("v2"))
+	c.Put("k3", String("v3"))
+
+	time.Sleep(10 * time.Millisecond)
+	c.CleanUp(5 * time.Millisecond)
+
+	if c.Len() != 0 || len(c.heap) != 0 || c.nbytes != 0 {
+		t.Errorf("CleanUp left len = %d, heap = %d, nbytes = %d", c.Len(), len(c.heap), c.nbytes)
+	}
+}
@@ -1,39 +1,88 @@
 package eviction
 
 import (
-	"container/heap"
+	"container/list"
+	"math"
+	"sync"
 	"time"
 )
 
+var (
+	_ limiter    = (*CacheUseLFU)(nil)
+	_ ager       = (*CacheUseLFU)(nil)
+	_ Enumerable = (*CacheUseLFU)(nil)
+)
+
+// lfuBucket holds the entries that share an access count.
+type lfuBucket struct {
+	count   int
+	entries *list.List // *lfuEntry, least recently used first
+}
+
+// lfuEntry represents an entry in the LFU cache.
+type lfuEntry struct {
+	entry  Entry         // The actual cache entry containing key, value and update time
+	bucket *list.Element // Element of CacheUseLFU.buckets holding the entry's access count
+	elem   *list.Element // Element of the bucket's entries list
+}
+
 // CacheUseLFU implements a Least Frequently Used (LFU) cache.
-// It maintains both a hash table for O(1) lookups and a priority queue
-// for efficient removal of least frequently used items.
+// It maintains a hash table for O(1) lookups and a list of frequency buckets
+// in increasing order of access count, so that recording an access and
+// evicting the least frequently used entry are both O(1).
+// Entries with the same count are evicted least recently used first.
+//
+// Access counts can age over time so that entries that were popular long
+// ago do not stay in the cache forever; see SetAging.
 type CacheUseLFU struct {
-	nbytes    int64                         // Current size in bytes
-	maxBytes  int64                         // Maximum allowed size in bytes (0 means unlimited)
-	cache     map[string]*lfuEntry          // Hash table for O(1) lookups
-	pq        *priorityQueue                // Priority queue for LFU ordering
-	OnEvicted func(key string, value Value) // Optional callback when an entry is evicted
+	limits
+	mu          sync.Mutex
+	cache       map[string]*lfuEntry          // Hash table for O(1) lookups
+	buckets     *list.List                    // *lfuBucket in increasing order of count
+	agingPeriod time.Duration                 // Interval between count decays, zero disables aging
+	agingFactor float64                       // Factor applied to every count each period
+	agedAt      time.Time                     // Start of the current aging period
+	OnEvicted   func(key string, value Value) // Optional callback when an entry is evicted
 }
 
 // NewCacheUseLFU creates a new LFU cache with the specified maximum size and eviction callback.
 func NewCacheUseLFU(maxBytes int64, onEvicted func(string, Value)) *CacheUseLFU {
-	queue := priorityQueue(make([]*lfuEntry, 0))
 	return &CacheUseLFU{
-		maxBytes:  maxBytes,
-		pq:        &queue,
+		limits:    limits{maxBytes: maxBytes},
 		cache:     make(map[string]*lfuEntry),
+		buckets:   list.New(),
 		OnEvicted: onEvicted,
 	}
 }
 
+// SetAging multiplies every access count by factor once per period, rounding
+// down but keeping each count at least 1. A factor of 0.5 halves the counts.
+// Aging runs lazily on the first Get or Put after a period has elapsed and
+// costs O(number of distinct counts) plus the entries of merged buckets.
+// A non-positive period, or a factor outside (0, 1), disables aging.
+func (p *CacheUseLFU) SetAging(period time.Duration, factor float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if period <= 0 || factor <= 0 || factor >= 1 {
+		p.agingPeriod, p.agingFactor = 0, 0
+		return
+	}
+	p.agingPeriod = period
+	p.agingFactor = factor
+	p.agedAt = time.Now()
+}
+
 // Get retrieves a value from the cache.
 // It returns the value, its last update time, and whether the key was found.
 // If the key exists, its access count is incremented.
 func (p *CacheUseLFU) Get(key string) (Value, time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.age(time.Now())
 	if e, ok := p.cache[key]; ok {
-		e.referenced()
-		heap.Fix(p.pq, e.index)
+		p.referenced(e)
 		return e.entry.Value, e.entry.UpdateAt, ok
 	}
 	return nil, time.Time{}, false
@@ -41,19 +90,23 @@ func (p *CacheUseLFU) Get(key string) (Value, time.Time, bool) {
 
 // Put adds or updates a value in the cache.
 // If the key already exists, its value is updated and access count is incremented.
-// If the key is new, it is added to both the hash table and priority queue.
+// If the key is new, it is added with an access count of 1.
 // If adding the new entry would exceed maxBytes, least frequently used entries
 // are removed until the cache size is within bounds.
 func (p *CacheUseLFU) Put(key string, value Value) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.age(time.Now())
 	if e, ok := p.cache[key]; ok {
-		p.nbytes += int64(value.Len()) - int64(e.entry.Value.Len())
+		p.nbytes += p.sizeOf(key, value) - p.sizeOf(key, e.entry.Value)
 		e.entry.Value = value
-		e.referenced()
-		heap.Fix(p.pq, e.index)
+		p.referenced(e)
+		p.evictOverflow()
 		return
 	}
 
-	// Add new entry
+	// Add new entry to the bucket for count 1, creating it if needed
 	e := &lfuEntry{
 		entry: Entry{
 			Key:      key,
@@ -61,58 +114,164 @@ func (p *CacheUseLFU) Put(key string, value Value) {
 			UpdateAt: time.Now(),
 		},
 	}
-	e.referenced()
-	heap.Push(p.pq, e)
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).count != 1 {
+		front = p.buckets.PushFront(&lfuBucket{count: 1, entries: list.New()})
+	}
+	e.bucket = front
+	e.elem = front.Value.(*lfuBucket).entries.PushBack(e)
 	p.cache[key] = e
-	p.nbytes += int64(len(e.entry.Key)) + int64(e.entry.Value.Len())
+	p.nbytes += p.sizeOf(e.entry.Key, e.entry.Value)
+
+	p.evictOverflow()
+}
 
-	// Remove least frequently used entries if cache exceeds size limit
-	for p.maxBytes != 0 && p.maxBytes < p.nbytes {
-		p.Remove()
+// referenced moves the entry to the bucket for the next access count and updates its timestamp.
+func (p *CacheUseLFU) referenced(e *lfuEntry) {
+	cur := e.bucket
+	b := cur.Value.(*lfuBucket)
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).count != b.count+1 {
+		next = p.buckets.InsertAfter(&lfuBucket{count: b.count + 1, entries: list.New()}, cur)
 	}
+
+	b.entries.Remove(e.elem)
+	if b.entries.Len() == 0 {
+		p.buckets.Remove(cur)
+	}
+	e.bucket = next
+	e.elem = next.Value.(*lfuBucket).entries.PushBack(e)
+	e.entry.Touch()
+}
+
+// age applies the decay for every aging period that has elapsed by now.
+// Buckets whose counts become equal are merged, keeping the entries that
+// had the higher count as the more recently used ones.
+func (p *CacheUseLFU) age(now time.Time) {
+	if p.agingPeriod <= 0 {
+		return
+	}
+	periods := now.Sub(p.agedAt) / p.agingPeriod
+	if periods <= 0 {
+		return
+	}
+	p.agedAt = p.agedAt.Add(periods * p.agingPeriod)
+	scale := math.Pow(p.agingFactor, float64(periods))
+
+	var prev *lfuBucket
+	for ele := p.buckets.Front(); ele != nil; {
+		next := ele.Next()
+		b := ele.Value.(*lfuBucket)
+		b.count = int(float64(b.count) * scale)
+		if b.count < 1 {
+			b.count = 1
+		}
+
+		if prev != nil && prev.count == b.count {
+			// prev is held by the element before ele, which every moved entry must point to.
+			prevEle := ele.Prev()
+			for el := b.entries.Front(); el != nil; el = b.entries.Front() {
+				e := b.entries.Remove(el).(*lfuEntry)
+				e.bucket = prevEle
+				e.elem = prev.entries.PushBack(e)
+			}
+			p.buckets.Remove(ele)
+		} else {
+			prev = b
+		}
+		ele = next
+	}
+}
+
+// evictOverflow removes least frequently used entries until the cache is within its limits.
+func (p *CacheUseLFU) evictOverflow() {
+	for len(p.cache) > 0 && p.overLimit(len(p.cache)) {
+		p.removeOldest()
+	}
+}
+
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (p *CacheUseLFU) SetSizer(sizer Sizer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sizer = sizer
+	p.nbytes = 0
+	for _, e := range p.cache {
+		p.nbytes += p.sizeOf(e.entry.Key, e.entry.Value)
+	}
+	p.evictOverflow()
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (p *CacheUseLFU) SetMaxEntries(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxEntries = n
+	p.evictOverflow()
 }
 
 // CleanUp removes all expired entries from the cache.
 // An entry is considered expired if its last update time plus the TTL
 // is before the current time.
 func (p *CacheUseLFU) CleanUp(ttl time.Duration) {
-	if p.pq == nil {
-		return
-	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Create a list of indices to remove
-	var toRemove []int
-	for i, e := range *p.pq {
+	for _, e := range p.cache {
 		if e.entry.Expired(ttl) {
-			toRemove = append(toRemove, i)
+			p.removeEntry(e)
 		}
 	}
+}
 
-	// Remove entries in reverse order to maintain heap indices
-	for i := len(toRemove) - 1; i >= 0; i-- {
-		idx := toRemove[i]
-		if idx < len(*p.pq) { // Safety check
-			expiredEntry := heap.Remove(p.pq, idx).(*lfuEntry)
-			delete(p.cache, expiredEntry.entry.Key)
-			p.nbytes -= int64(len(expiredEntry.entry.Key)) + int64(expiredEntry.entry.Value.Len())
-			if p.OnEvicted != nil {
-				p.OnEvicted(expiredEntry.entry.Key, expiredEntry.entry.Value)
-			}
-		}
+// Entries returns a snapshot of the cached entries ordered from least to most recently used.
+func (p *CacheUseLFU) Entries() []Entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := make([]Entry, 0, len(p.cache))
+	for _, e := range p.cache {
+		entries = append(entries, e.entry)
 	}
+	return sortByRecency(entries)
 }
 
 // Len returns the number of items in the cache.
 func (p *CacheUseLFU) Len() int {
-	return p.pq.Len()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cache)
 }
 
-// Remove removes and returns the least frequently used item from the cache.
+// Remove removes the least frequently used item from the cache.
 // If there are multiple items with the same frequency, the least recently used one is removed.
 func (p *CacheUseLFU) Remove() {
-	e := heap.Pop(p.pq).(*lfuEntry)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeOldest()
+}
+
+// removeOldest removes the least recently used entry of the lowest count.
+// Caller must hold the lock.
+func (p *CacheUseLFU) removeOldest() {
+	if front := p.buckets.Front(); front != nil {
+		p.removeEntry(front.Value.(*lfuBucket).entries.Front().Value.(*lfuEntry))
+	}
+}
+
+// removeEntry removes an entry from the cache, updating the size
+// and calling the eviction callback if set.
+// Caller must hold the lock.
+func (p *CacheUseLFU) removeEntry(e *lfuEntry) {
+	b := e.bucket.Value.(*lfuBucket)
+	b.entries.Remove(e.elem)
+	if b.entries.Len() == 0 {
+		p.buckets.Remove(e.bucket)
+	}
 	delete(p.cache, e.entry.Key)
-	p.nbytes -= int64(len(e.entry.Key)) + int64(e.entry.Value.Len())
+	p.nbytes -= p.sizeOf(e.entry.Key, e.entry.Value)
 	if p.OnEvicted != nil {
 		p.OnEvicted(e.entry.Key, e.entry.Value)
 	}
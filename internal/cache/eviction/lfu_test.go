@@ -175,3 +175,91 @@ func TestCacheUseLFU_ZeroSize(t *testing.T) {
 		t.Errorf("Expected 100 entries in unlimited cache, got %d", lfu.Len())
 	}
 }
+
+func TestCacheUseLFU_Buckets(t *testing.T) {
+	lfu := NewCacheUseLFU(0, nil)
+	lfu.Put("k1", String("v1"))
+	lfu.Put("k2", String("v2"))
+	lfu.Put("k3", String("v3"))
+	lfu.Get("k2")
+	lfu.Get("k3")
+	lfu.Get("k3")
+
+	// Buckets are kept in increasing order of count, without empty buckets.
+	var counts []int
+	for ele := lfu.buckets.Front(); ele != nil; ele = ele.Next() {
+		b := ele.Value.(*lfuBucket)
+		if b.entries.Len() == 0 {
+			t.Errorf("bucket for count %d is empty", b.count)
+		}
+		counts = append(counts, b.count)
+	}
+	if len(counts) != 3 || counts[0] != 1 || counts[1] != 2 || counts[2] != 3 {
+		t.Errorf("bucket counts = %v, want [1 2 3]", counts)
+	}
+
+	lfu.Remove()
+	if _, _, ok := lfu.Get("k1"); ok {
+		t.Error("Remove should have evicted k1, the least frequently used key")
+	}
+}
+
+func TestCacheUseLFU_Aging(t *testing.T) {
+	lfu := NewCacheUseLFU(0, nil)
+	lfu.SetAging(time.Hour, 0.5)
+
+	// Yesterday's hot key.
+	lfu.Put("old", String("v"))
+	for i := 0; i < 7; i++ {
+		lfu.Get("old")
+	}
+
+	// Two aging periods pass: the count of 8 decays to 2.
+	lfu.agedAt = lfu.agedAt.Add(-2 * time.Hour)
+	lfu.Put("new", String("v"))
+	lfu.Get("new")
+	lfu.Get("new")
+	if got := lfu.cache["old"].bucket.Value.(*lfuBucket).count; got != 2 {
+		t.Fatalf("count of old after aging = %d, want 2", got)
+	}
+
+	// new now has a higher count, so old is evicted first.
+	lfu.Remove()
+	if _, _, ok := lfu.Get("new"); !ok {
+		t.Error("new should be present")
+	}
+	if _, _, ok := lfu.Get("old"); ok {
+		t.Error("old should have aged out")
+	}
+}
+
+func TestCacheUseLFU_AgingMergesBuckets(t *testing.T) {
+	lfu := NewCacheUseLFU(0, nil)
+	lfu.SetAging(time.Hour, 0.5)
+	lfu.Put("k1", String("v")) // count 1
+	lfu.Put("k2", String("v"))
+	lfu.Get("k2") // count 2
+	lfu.Put("k3", String("v"))
+	lfu.Get("k3")
+	lfu.Get("k3") // count 3
+
+	lfu.agedAt = lfu.agedAt.Add(-time.Hour)
+	lfu.age(time.Now())
+
+	// Counts 1, 2 and 3 become 1, 1 and 1, and ties keep the higher count last.
+	if lfu.buckets.Len() != 1 {
+		t.Fatalf("got %d buckets after aging, want 1", lfu.buckets.Len())
+	}
+	b := lfu.buckets.Front()
+	var keys []string
+	for el := b.Value.(*lfuBucket).entries.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lfuEntry)
+		if e.bucket != b {
+			t.Errorf("entry %s points to a removed bucket", e.entry.Key)
+		}
+		keys = append(keys, e.entry.Key)
+	}
+	if len(keys) != 3 || keys[0] != "k1" || keys[1] != "k2" || keys[2] != "k3" {
+		t.Errorf("entries after aging = %v, want [k1 k2 k3]", keys)
+	}
+}
@@ -4,9 +4,16 @@ import (
 	"container/list"
 	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	_ limiter          = (*CacheUseLRU)(nil)
+	_ ExpiringStrategy = (*CacheUseLRU)(nil)
+	_ Enumerable       = (*CacheUseLRU)(nil)
+)
+
 const (
 	defaultCleanupInterval = 2 * time.Minute  // Default interval for cleanup routine
 	defaultTTL             = 10 * time.Minute // Default TTL for cache entries
@@ -15,16 +22,20 @@ const (
 
 // segment represents a portion of the cache with its own lock
 type segment struct {
+	limits
 	mu        sync.RWMutex
-	maxBytes  int64
-	nbytes    int64
 	ll        *list.List
 	cache     map[string]*list.Element
+	ttl       time.Duration
+	wheel     *timingWheel
+	count     *atomic.Int64 // Entries of all segments, shared with the cache
 	OnEvicted func(key string, value Value)
 }
 
 // CacheUseLRU implements a segmented Least Recently Used (LRU) cache.
 // It maintains multiple segments, each with its own lock, to reduce lock contention.
+// Expired entries are found through a timing wheel per segment, so the cleanup
+// routine only visits entries that are due instead of scanning every segment.
 type CacheUseLRU struct {
 	segments        []*segment
 	numSegments     int
@@ -32,6 +43,8 @@ type CacheUseLRU struct {
 	ttl             time.Duration
 	stopCleanup     chan struct{}
 	mu              sync.RWMutex
+	count           atomic.Int64 // Entries of all segments
+	maxEntries      atomic.Int64 // Limit on count when it is too small to split across segments, 0 otherwise
 }
 
 // NewCacheUseLRU creates a new segmented LRU cache with the specified maximum size and eviction callback.
@@ -41,22 +54,23 @@ func NewCacheUseLRU(maxBytes int64, onEvicted func(string, Value)) *CacheUseLRU
 		numSegments:     defaultNumSegments,
 		cleanupInterval: defaultCleanupInterval,
 		ttl:             defaultTTL,
-		stopCleanup:     make(chan struct{}),
 	}
 
 	// Initialize segments
 	segmentMaxBytes := maxBytes / int64(defaultNumSegments)
 	for i := 0; i < defaultNumSegments; i++ {
 		c.segments[i] = &segment{
-			maxBytes:  segmentMaxBytes,
+			limits:    limits{maxBytes: segmentMaxBytes},
 			ll:        list.New(),
 			cache:     make(map[string]*list.Element),
+			ttl:       defaultTTL,
+			count:     &c.count,
 			OnEvicted: onEvicted,
 		}
 	}
 
 	// Start cleanup routine
-	go c.cleanupRoutine()
+	c.startLocked()
 
 	return c
 }
@@ -69,51 +83,91 @@ func (c *CacheUseLRU) getSegment(key string) *segment {
 	return c.segments[h.Sum32()%uint32(c.numSegments)]
 }
 
-// SetTTL sets the time-to-live for cache entries.
+// SetTTL sets the time-to-live for cache entries
+// and reschedules the expiration of the entries already cached.
 func (c *CacheUseLRU) SetTTL(ttl time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.ttl = ttl
+	for _, seg := range c.segments {
+		seg.mu.Lock()
+		seg.ttl = ttl
+		seg.trackAll()
+		seg.mu.Unlock()
+	}
 }
 
 // SetCleanupInterval sets the interval between cleanup runs.
+// Entries are removed at most one interval, capped at one second, after they expire.
 func (c *CacheUseLRU) SetCleanupInterval(interval time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	// Stop existing cleanup routine
-	close(c.stopCleanup)
-
-	// Create new stop channel and set new interval
-	c.stopCleanup = make(chan struct{})
+	c.stopLocked()
 	c.cleanupInterval = interval
-
-	// Start new cleanup routine
-	go c.cleanupRoutine()
+	c.startLocked()
 }
 
-// Stop stops the cleanup routine.
+// Stop stops the cleanup routine. It is safe to call more than once.
 func (c *CacheUseLRU) Stop() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	close(c.stopCleanup)
+	c.stopLocked()
 }
 
-// cleanupRoutine periodically cleans up expired entries across all segments.
-func (c *CacheUseLRU) cleanupRoutine() {
-	ticker := time.NewTicker(c.cleanupInterval)
+// startLocked rebuilds the segments' timing wheels and starts the cleanup routine.
+// The wheels tick with the routine, so they are recreated whenever it restarts.
+// Caller must hold c.mu.
+func (c *CacheUseLRU) startLocked() {
+	tick := c.cleanupInterval
+	if tick <= 0 || tick > defaultWheelTick {
+		tick = defaultWheelTick
+	}
+
+	now := time.Now()
+	for _, seg := range c.segments {
+		seg.mu.Lock()
+		seg.wheel = newTimingWheel(tick, now)
+		seg.trackAll()
+		seg.mu.Unlock()
+	}
+
+	c.stopCleanup = make(chan struct{})
+	go c.cleanupRoutine(c.stopCleanup, tick)
+}
+
+// stopLocked stops the cleanup routine if it is running.
+// Caller must hold c.mu.
+func (c *CacheUseLRU) stopLocked() {
+	if c.stopCleanup != nil {
+		close(c.stopCleanup)
+		c.stopCleanup = nil
+	}
+}
+
+// cleanupRoutine advances the timing wheels every tick until stop is closed.
+func (c *CacheUseLRU) cleanupRoutine(stop chan struct{}, tick time.Duration) {
+	ticker := time.NewTicker(tick)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			currentTTL := c.ttl // capture current TTL value
-			c.CleanUp(currentTTL)
-		case <-c.stopCleanup:
+			c.expire(time.Now())
+		case <-stop:
 			return
 		}
 	}
 }
 
+// expire removes the entries whose timers have fired from every segment.
+func (c *CacheUseLRU) expire(now time.Time) {
+	for _, seg := range c.segments {
+		seg.mu.Lock()
+		seg.wheel.expire(now, seg.ttl, seg.entry, seg.remove)
+		seg.mu.Unlock()
+	}
+}
+
 // cleanupSegment removes expired entries from a single segment
 func (c *CacheUseLRU) cleanupSegment(seg *segment, ttl time.Duration) {
 	seg.mu.Lock()
@@ -134,12 +188,17 @@ func (c *CacheUseLRU) cleanupSegment(seg *segment, ttl time.Duration) {
 // Get retrieves a value from the cache.
 func (c *CacheUseLRU) Get(key string) (value Value, updateAt time.Time, ok bool) {
 	seg := c.getSegment(key)
-	seg.mu.RLock()
-	defer seg.mu.RUnlock()
+	seg.mu.Lock()
+	defer seg.mu.Unlock()
 
 	if ele, ok := seg.cache[key]; ok {
-		seg.ll.MoveToBack(ele)
 		e := ele.Value.(*Entry)
+		if !e.ExpireAt.IsZero() && e.ExpireAt.Before(time.Now()) {
+			seg.removeElement(ele)
+			return nil, time.Time{}, false
+		}
+		// The timer is not moved here; it is rescheduled when it fires.
+		seg.ll.MoveToBack(ele)
 		e.Touch()
 		return e.Value, e.UpdateAt, true
 	}
@@ -148,36 +207,47 @@ func (c *CacheUseLRU) Get(key string) (value Value, updateAt time.Time, ok bool)
 
 // Put adds or updates a value in the cache.
 func (c *CacheUseLRU) Put(key string, value Value) {
+	c.PutWithExpiry(key, value, time.Time{})
+}
+
+// PutWithExpiry adds or updates a value that expires at expireAt.
+// A zero expireAt applies the cache-wide TTL.
+func (c *CacheUseLRU) PutWithExpiry(key string, value Value, expireAt time.Time) {
 	seg := c.getSegment(key)
 	seg.mu.Lock()
-	defer seg.mu.Unlock()
 
-	newBytes := int64(len(key)) + int64(value.Len())
+	newBytes := seg.sizeOf(key, value)
 
 	if ele, ok := seg.cache[key]; ok {
 		entry := ele.Value.(*Entry)
-		oldBytes := int64(len(entry.Key)) + int64(entry.Value.Len())
+		oldBytes := seg.sizeOf(entry.Key, entry.Value)
 		entry.Value = value
+		entry.ExpireAt = expireAt
 		entry.Touch()
 		seg.nbytes = seg.nbytes - oldBytes + newBytes
 		seg.ll.MoveToBack(ele)
+		seg.wheel.track(entry, seg.ttl)
 	} else {
 		entry := &Entry{
 			Key:      key,
 			Value:    value,
 			UpdateAt: time.Now(),
+			ExpireAt: expireAt,
 		}
 		ele := seg.ll.PushBack(entry)
 		seg.cache[key] = ele
 		seg.nbytes += newBytes
+		seg.count.Add(1)
+		seg.wheel.track(entry, seg.ttl)
 	}
 
-	// Keep removing oldest entries until we're under maxBytes
-	for seg.maxBytes != 0 && seg.maxBytes < seg.nbytes {
-		seg.removeOldest()
-	}
+	seg.evictOverflow()
+	seg.mu.Unlock()
+
+	c.evictGlobalOverflow(seg, key)
 }
 
+// CleanUp scans every segment and removes the entries that expired under ttl.
 func (c *CacheUseLRU) CleanUp(ttl time.Duration) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -186,6 +256,90 @@ func (c *CacheUseLRU) CleanUp(ttl time.Duration) {
 	}
 }
 
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (c *CacheUseLRU) SetSizer(sizer Sizer) {
+	for _, seg := range c.segments {
+		seg.mu.Lock()
+		seg.sizer = sizer
+		seg.nbytes = 0
+		for e := seg.ll.Front(); e != nil; e = e.Next() {
+			entry := e.Value.(*Entry)
+			seg.nbytes += seg.sizeOf(entry.Key, entry.Value)
+		}
+		seg.evictOverflow()
+		seg.mu.Unlock()
+	}
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+// Like maxBytes, the limit is split across segments, the first n%numSegments
+// of which hold one entry more. A limit smaller than the number of segments
+// cannot be split, so it bounds the total count instead, evicting from the
+// segment being written first.
+func (c *CacheUseLRU) SetMaxEntries(n int) {
+	split := n >= c.numSegments
+	if split || n <= 0 {
+		c.maxEntries.Store(0)
+	} else {
+		c.maxEntries.Store(int64(n))
+	}
+
+	for i, seg := range c.segments {
+		seg.mu.Lock()
+		seg.maxEntries = 0
+		if split {
+			seg.maxEntries = n / c.numSegments
+			if i < n%c.numSegments {
+				seg.maxEntries++
+			}
+		}
+		seg.evictOverflow()
+		seg.mu.Unlock()
+	}
+	c.evictGlobalOverflow(nil, "")
+}
+
+// evictGlobalOverflow removes least recently used entries while the cache
+// holds more entries than the global limit, from first before the other
+// segments, and never the entry of keep.
+func (c *CacheUseLRU) evictGlobalOverflow(first *segment, keep string) {
+	limit := c.maxEntries.Load()
+	if limit == 0 || c.count.Load() <= limit {
+		return
+	}
+
+	segments := c.segments
+	if first != nil {
+		segments = append([]*segment{first}, c.segments...)
+	}
+	for _, seg := range segments {
+		seg.mu.Lock()
+		for c.count.Load() > limit {
+			ele := seg.ll.Front()
+			if ele != nil && ele.Value.(*Entry).Key == keep {
+				ele = ele.Next()
+			}
+			if ele == nil {
+				break
+			}
+			seg.removeElement(ele)
+		}
+		seg.mu.Unlock()
+		if c.count.Load() <= limit {
+			return
+		}
+	}
+}
+
+// evictOverflow removes least recently used items until the segment is within its limits.
+// Caller must hold the segment lock.
+func (seg *segment) evictOverflow() {
+	for seg.ll.Len() > 0 && seg.overLimit(len(seg.cache)) {
+		seg.removeOldest()
+	}
+}
+
 // removeOldest removes the least recently used item from a segment.
 func (seg *segment) removeOldest() {
 	if ele := seg.ll.Front(); ele != nil {
@@ -193,17 +347,55 @@ func (seg *segment) removeOldest() {
 	}
 }
 
+// trackAll schedules the expiration of every entry in the segment.
+// Caller must hold the segment lock.
+func (seg *segment) trackAll() {
+	for e := seg.ll.Front(); e != nil; e = e.Next() {
+		seg.wheel.track(e.Value.(*Entry), seg.ttl)
+	}
+}
+
+// entry returns the entry stored under key, or nil if there is none.
+func (seg *segment) entry(key string) *Entry {
+	if ele, ok := seg.cache[key]; ok {
+		return ele.Value.(*Entry)
+	}
+	return nil
+}
+
+// remove removes the entry stored under key, if any.
+func (seg *segment) remove(key string) {
+	if ele, ok := seg.cache[key]; ok {
+		seg.removeElement(ele)
+	}
+}
+
 // removeElement removes an element from a segment.
 func (seg *segment) removeElement(e *list.Element) {
 	seg.ll.Remove(e)
 	entry := e.Value.(*Entry)
 	delete(seg.cache, entry.Key)
-	seg.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
+	seg.count.Add(-1)
+	seg.wheel.cancel(entry.Key)
+	seg.nbytes -= seg.sizeOf(entry.Key, entry.Value)
 	if seg.OnEvicted != nil {
 		seg.OnEvicted(entry.Key, entry.Value)
 	}
 }
 
+// Entries returns a snapshot of the cached entries ordered from least to most recently used.
+func (c *CacheUseLRU) Entries() []Entry {
+	var entries []Entry
+	for _, seg := range c.segments {
+		seg.mu.Lock()
+		for e := seg.ll.Front(); e != nil; e = e.Next() {
+			entries = append(entries, *e.Value.(*Entry))
+		}
+		seg.mu.Unlock()
+	}
+	return sortByRecency(entries)
+}
+
 // Len returns the total number of items in the cache.
 func (c *CacheUseLRU) Len() int {
 	total := 0
@@ -4,6 +4,13 @@ import (
 	"container/list"
 	"sync"
 	"time"
+
+	"github.com/1055373165/ggcache/internal/metrics"
+)
+
+var (
+	_ limiter    = (*CacheUseLRUBatch)(nil)
+	_ Enumerable = (*CacheUseLRUBatch)(nil)
 )
 
 const (
@@ -12,8 +19,7 @@ const (
 
 // CacheUseLRUBatch implements a Least Recently Used (LRU) cache with batch processing.
 type CacheUseLRUBatch struct {
-	maxBytes        int64
-	nbytes          int64
+	limits
 	root            *list.List
 	cache           map[string]*list.Element
 	OnEvicted       func(key string, value Value)
@@ -25,9 +31,10 @@ type CacheUseLRUBatch struct {
 }
 
 // NewCacheUseLRUBatch creates a new LRU cache with batch processing capabilities.
+// The cleanup routine is started immediately; call Stop to release it.
 func NewCacheUseLRUBatch(maxBytes int64, onEvicted func(string, Value)) *CacheUseLRUBatch {
 	c := &CacheUseLRUBatch{
-		maxBytes:        maxBytes,
+		limits:          limits{maxBytes: maxBytes},
 		root:            list.New(),
 		cache:           make(map[string]*list.Element),
 		OnEvicted:       onEvicted,
@@ -35,14 +42,30 @@ func NewCacheUseLRUBatch(maxBytes int64, onEvicted func(string, Value)) *CacheUs
 		ttl:             defaultTTL,
 		batchSize:       defaultBatchSize,
 	}
+	c.Start()
 	return c
 }
 
-// Start starts the cleanup routine.
+// Start starts the cleanup routine if it is not already running.
 func (c *CacheUseLRUBatch) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.startLocked()
+}
+
+// startLocked starts the cleanup routine. Caller must hold the lock.
+func (c *CacheUseLRUBatch) startLocked() {
 	if c.stopCleanup == nil {
 		c.stopCleanup = make(chan struct{})
-		go c.cleanupRoutine()
+		go c.cleanupRoutine(c.stopCleanup, c.cleanupInterval)
+	}
+}
+
+// stopLocked stops the cleanup routine. Caller must hold the lock.
+func (c *CacheUseLRUBatch) stopLocked() {
+	if c.stopCleanup != nil {
+		close(c.stopCleanup)
+		c.stopCleanup = nil
 	}
 }
 
@@ -62,64 +85,41 @@ func (c *CacheUseLRUBatch) SetTTL(ttl time.Duration) {
 	c.ttl = ttl
 }
 
-// SetCleanupInterval sets the interval between cleanup runs.
+// SetCleanupInterval sets the interval between cleanup runs and restarts the cleanup routine.
 func (c *CacheUseLRUBatch) SetCleanupInterval(interval time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.stopCleanup != nil {
-		close(c.stopCleanup)
-	}
+	c.stopLocked()
 	c.cleanupInterval = interval
-	c.Start()
+	c.startLocked()
 }
 
-// Stop stops the cleanup routine.
+// Stop stops the cleanup routine. It is safe to call Stop multiple times.
 func (c *CacheUseLRUBatch) Stop() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-
-	if c.stopCleanup != nil {
-		close(c.stopCleanup)
-		c.stopCleanup = nil
-	}
+	c.stopLocked()
 }
 
-// cleanupRoutine periodically cleans up expired entries.
-func (c *CacheUseLRUBatch) cleanupRoutine() {
-	ticker := time.NewTicker(c.cleanupInterval)
+// cleanupRoutine periodically cleans up expired entries until stop is closed.
+func (c *CacheUseLRUBatch) cleanupRoutine(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if c.ttl <= 0 {
-				continue
-			}
-
 			// Try to acquire lock, skip this round if can't get it
 			if !c.mu.TryLock() {
 				continue
 			}
-
-			now := time.Now()
-			for elem := c.root.Back(); elem != nil; {
-				entry := elem.Value.(*Entry)
-				if now.Sub(entry.UpdateAt) < c.ttl {
-					break
-				}
-				nextElem := elem.Prev()
-				delete(c.cache, entry.Key)
-				c.root.Remove(elem)
-				c.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
-				if c.OnEvicted != nil {
-					c.OnEvicted(entry.Key, entry.Value)
-				}
-				elem = nextElem
+			if c.ttl > 0 {
+				c.removeExpired(c.ttl)
 			}
 			c.mu.Unlock()
 
-		case <-c.stopCleanup:
+		case <-stop:
 			return
 		}
 	}
@@ -146,7 +146,7 @@ func (c *CacheUseLRUBatch) Put(key string, value Value) {
 	if elem, ok := c.cache[key]; ok {
 		c.root.MoveToFront(elem)
 		entry := elem.Value.(*Entry)
-		c.nbytes += int64(value.Len()) - int64(entry.Value.Len())
+		c.nbytes += c.sizeOf(key, value) - c.sizeOf(key, entry.Value)
 		entry.Value = value
 		entry.UpdateAt = time.Now()
 	} else {
@@ -157,14 +157,43 @@ func (c *CacheUseLRUBatch) Put(key string, value Value) {
 		}
 		elem := c.root.PushFront(entry)
 		c.cache[key] = elem
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		c.nbytes += c.sizeOf(key, value)
 	}
 
-	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+	c.evictOverflow()
+}
+
+// evictOverflow removes batches of least recently used items until the cache is within its limits.
+// Caller must hold the lock.
+func (c *CacheUseLRUBatch) evictOverflow() {
+	for c.root.Len() > 0 && c.overLimit(c.root.Len()) {
 		c.removeOldestBatch()
 	}
 }
 
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (c *CacheUseLRUBatch) SetSizer(sizer Sizer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sizer = sizer
+	c.nbytes = 0
+	for elem := c.root.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*Entry)
+		c.nbytes += c.sizeOf(entry.Key, entry.Value)
+	}
+	c.evictOverflow()
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (c *CacheUseLRUBatch) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evictOverflow()
+}
+
 // removeOldestBatch removes a batch of least recently used items.
 func (c *CacheUseLRUBatch) removeOldestBatch() bool {
 	if c.root.Len() == 0 {
@@ -177,16 +206,11 @@ func (c *CacheUseLRUBatch) removeOldestBatch() bool {
 		if elem == nil {
 			break
 		}
-		entry := elem.Value.(*Entry)
-		delete(c.cache, entry.Key)
-		c.root.Remove(elem)
-		c.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(entry.Key, entry.Value)
-		}
+		c.removeElement(elem)
 		removed++
 	}
 
+	metrics.RecordBatchEviction(removed)
 	return removed > 0
 }
 
@@ -198,7 +222,12 @@ func (c *CacheUseLRUBatch) CleanUp(ttl time.Duration) {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.removeExpired(ttl)
+}
 
+// removeExpired removes entries older than ttl, starting from the least recently used one.
+// Caller must hold the lock.
+func (c *CacheUseLRUBatch) removeExpired(ttl time.Duration) {
 	now := time.Now()
 	for elem := c.root.Back(); elem != nil; {
 		entry := elem.Value.(*Entry)
@@ -206,16 +235,35 @@ func (c *CacheUseLRUBatch) CleanUp(ttl time.Duration) {
 			break
 		}
 		nextElem := elem.Prev()
-		delete(c.cache, entry.Key)
-		c.root.Remove(elem)
-		c.nbytes -= int64(len(entry.Key)) + int64(entry.Value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(entry.Key, entry.Value)
-		}
+		c.removeElement(elem)
 		elem = nextElem
 	}
 }
 
+// removeElement removes an element from the cache, updating the size
+// and calling the eviction callback if set.
+// Caller must hold the lock.
+func (c *CacheUseLRUBatch) removeElement(elem *list.Element) {
+	entry := c.root.Remove(elem).(*Entry)
+	delete(c.cache, entry.Key)
+	c.nbytes -= c.sizeOf(entry.Key, entry.Value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(entry.Key, entry.Value)
+	}
+}
+
+// Entries returns a snapshot of the cached entries ordered from least to most recently used.
+func (c *CacheUseLRUBatch) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]Entry, 0, c.root.Len())
+	for elem := c.root.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, *elem.Value.(*Entry))
+	}
+	return entries
+}
+
 // Len returns the number of items in the cache.
 func (c *CacheUseLRUBatch) Len() int {
 	c.mu.RLock()
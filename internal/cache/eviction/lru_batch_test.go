@@ -239,3 +239,53 @@ func TestCacheUseLRUBatch_ConcurrentCleanup(t *testing.T) {
 		t.Errorf("Cache size too large: %d", size)
 	}
 }
+
+func TestCacheUseLRUBatch_Lifecycle(t *testing.T) {
+	t.Run("selectable by name", func(t *testing.T) {
+		s, err := New("lru-batch", 1024, nil)
+		if err != nil {
+			t.Fatalf("New(lru-batch) returned error: %v", err)
+		}
+		lru, ok := s.(*CacheUseLRUBatch)
+		if !ok {
+			t.Fatalf("New(lru-batch) returned %T, want *CacheUseLRUBatch", s)
+		}
+		lru.Stop()
+	})
+
+	t.Run("config applies batch settings", func(t *testing.T) {
+		s, err := NewWithConfig(CacheConfig{
+			MaxBytes:        1024,
+			EvictionType:    EvictionLRUBatch,
+			TTL:             50 * time.Millisecond,
+			CleanupInterval: 20 * time.Millisecond,
+			BatchSize:       7,
+		}, nil)
+		if err != nil {
+			t.Fatalf("NewWithConfig returned error: %v", err)
+		}
+		lru := s.(*CacheUseLRUBatch)
+		defer lru.Stop()
+
+		if lru.batchSize != 7 {
+			t.Errorf("batchSize = %d, want 7", lru.batchSize)
+		}
+
+		// Cleanup runs without an explicit Start call
+		lru.Put("k1", String("v1"))
+		time.Sleep(150 * time.Millisecond)
+		if lru.Len() != 0 {
+			t.Errorf("expired entry not cleaned up, got len = %d", lru.Len())
+		}
+	})
+
+	t.Run("restart and repeated stop", func(t *testing.T) {
+		lru := NewCacheUseLRUBatch(1024, nil)
+		lru.SetCleanupInterval(time.Minute)
+		lru.SetCleanupInterval(time.Second)
+		lru.Stop()
+		lru.Stop()
+		lru.Start()
+		lru.Stop()
+	})
+}
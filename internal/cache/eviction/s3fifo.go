@@ -0,0 +1,272 @@
+package eviction
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ limiter    = (*CacheUseS3FIFO)(nil)
+	_ Enumerable = (*CacheUseS3FIFO)(nil)
+)
+
+const (
+	s3fifoSmallRatio = 10 // The small queue holds 1/10 of the capacity
+	s3fifoMaxFreq    = 3  // Access counts saturate at 3
+)
+
+// s3fifoEntry is an entry of the small or main queue.
+type s3fifoEntry struct {
+	Entry
+	freq   atomic.Int32 // Accesses since insertion or the last reinsertion, capped at s3fifoMaxFreq
+	inMain bool         // true if in the main queue, false if in the small queue
+}
+
+// hit records an access without taking the write lock.
+func (e *s3fifoEntry) hit() {
+	for {
+		f := e.freq.Load()
+		if f >= s3fifoMaxFreq || e.freq.CompareAndSwap(f, f+1) {
+			return
+		}
+	}
+}
+
+// CacheUseS3FIFO implements the S3-FIFO algorithm with three FIFO queues:
+// - Small: new entries, about 10% of the capacity, filters out one-hit wonders
+// - Main: entries that were accessed while in the small queue or recently evicted from it
+// - Ghost: keys recently evicted from the small queue, without their values
+//
+// A hit only increments the entry's access count, so Get needs no list updates
+// and runs under the read lock. Entries leaving the small queue move to the main
+// queue if they were accessed there, and to the ghost queue otherwise. Entries at
+// the head of the main queue are reinserted at its tail while their count is
+// positive, decrementing it each time, and are evicted once it reaches zero.
+type CacheUseS3FIFO struct {
+	limits
+	small      *list.List // Small FIFO queue of *s3fifoEntry
+	main       *list.List // Main FIFO queue of *s3fifoEntry
+	ghost      *list.List // Ghost FIFO queue of keys
+	smallBytes int64      // Size of the entries in the small queue
+	cache      map[string]*list.Element
+	ghosts     map[string]*list.Element
+	mu         sync.RWMutex
+	OnEvicted  func(key string, value Value)
+}
+
+// NewCacheUseS3FIFO creates a new S3-FIFO cache with the specified maximum size and eviction callback.
+func NewCacheUseS3FIFO(maxBytes int64, onEvicted func(string, Value)) *CacheUseS3FIFO {
+	return &CacheUseS3FIFO{
+		limits:    limits{maxBytes: maxBytes},
+		small:     list.New(),
+		main:      list.New(),
+		ghost:     list.New(),
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Get retrieves a value from the cache.
+// Like FIFO, a hit does not move the entry; it only records the access.
+func (c *CacheUseS3FIFO) Get(key string) (Value, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*s3fifoEntry)
+		e.hit()
+		return e.Value, e.UpdateAt, true
+	}
+	return nil, time.Time{}, false
+}
+
+// Put adds or updates a value in the cache.
+// Updating an entry counts as an access. New keys enter the small queue,
+// unless they were recently evicted from it and are still in the ghost queue,
+// in which case they go straight to the main queue.
+func (c *CacheUseS3FIFO) Put(key string, value Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newBytes := c.sizeOf(key, value)
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*s3fifoEntry)
+		oldBytes := c.sizeOf(key, e.Value)
+		c.nbytes += newBytes - oldBytes
+		if !e.inMain {
+			c.smallBytes += newBytes - oldBytes
+		}
+		e.Value = value
+		e.Touch()
+		e.hit()
+		c.evictOverflow()
+		return
+	}
+
+	e := &s3fifoEntry{Entry: Entry{Key: key, Value: value, UpdateAt: time.Now()}}
+	if ghost, ok := c.ghosts[key]; ok {
+		c.ghost.Remove(ghost)
+		delete(c.ghosts, key)
+		e.inMain = true
+		c.cache[key] = c.main.PushBack(e)
+	} else {
+		c.cache[key] = c.small.PushBack(e)
+		c.smallBytes += newBytes
+	}
+	c.nbytes += newBytes
+
+	c.evictOverflow()
+}
+
+// evictOverflow evicts entries until the cache is within its limits.
+// Caller must hold the lock.
+func (c *CacheUseS3FIFO) evictOverflow() {
+	for len(c.cache) > 0 && c.overLimit(len(c.cache)) {
+		if c.smallOverTarget() || c.main.Len() == 0 {
+			c.evictSmall()
+		} else {
+			c.evictMain()
+		}
+	}
+}
+
+// smallOverTarget reports whether the small queue holds more than its share of the capacity.
+func (c *CacheUseS3FIFO) smallOverTarget() bool {
+	if c.small.Len() == 0 {
+		return false
+	}
+	if c.maxBytes > 0 && c.smallBytes > c.maxBytes/s3fifoSmallRatio {
+		return true
+	}
+	return c.maxEntries > 0 && c.small.Len() > c.maxEntries/s3fifoSmallRatio
+}
+
+// evictSmall removes the entry at the head of the small queue. It moves to
+// the main queue if it was accessed, and is evicted to the ghost queue otherwise.
+// Caller must hold the lock.
+func (c *CacheUseS3FIFO) evictSmall() {
+	ele := c.small.Front()
+	e := c.small.Remove(ele).(*s3fifoEntry)
+	c.smallBytes -= c.sizeOf(e.Key, e.Value)
+
+	if e.freq.Load() > 0 {
+		e.freq.Store(0)
+		e.inMain = true
+		c.cache[e.Key] = c.main.PushBack(e)
+		return
+	}
+
+	c.evict(e)
+	c.ghosts[e.Key] = c.ghost.PushBack(e.Key)
+	// The ghost queue remembers about as many keys as the cache holds.
+	for c.ghost.Len() > 1 && c.ghost.Len() > len(c.cache) {
+		delete(c.ghosts, c.ghost.Remove(c.ghost.Front()).(string))
+	}
+}
+
+// evictMain reinserts accessed entries at the tail of the main queue,
+// decrementing their access count, and evicts the first entry that was not accessed.
+// Caller must hold the lock.
+func (c *CacheUseS3FIFO) evictMain() {
+	for {
+		ele := c.main.Front()
+		e := ele.Value.(*s3fifoEntry)
+		if f := e.freq.Load(); f > 0 {
+			e.freq.Store(f - 1)
+			c.main.MoveToBack(ele)
+			continue
+		}
+		c.main.Remove(ele)
+		c.evict(e)
+		return
+	}
+}
+
+// evict drops an entry that has already been unlinked from its queue.
+// Caller must hold the lock.
+func (c *CacheUseS3FIFO) evict(e *s3fifoEntry) {
+	delete(c.cache, e.Key)
+	c.nbytes -= c.sizeOf(e.Key, e.Value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.Key, e.Value)
+	}
+}
+
+// removeElement removes an entry from whichever queue holds it.
+// Caller must hold the lock.
+func (c *CacheUseS3FIFO) removeElement(ele *list.Element) {
+	e := ele.Value.(*s3fifoEntry)
+	if e.inMain {
+		c.main.Remove(ele)
+	} else {
+		c.small.Remove(ele)
+		c.smallBytes -= c.sizeOf(e.Key, e.Value)
+	}
+	c.evict(e)
+}
+
+// SetSizer sets the estimator used to account entry sizes
+// and recomputes the size of the entries already cached.
+func (c *CacheUseS3FIFO) SetSizer(sizer Sizer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sizer = sizer
+	c.nbytes, c.smallBytes = 0, 0
+	for _, ele := range c.cache {
+		e := ele.Value.(*s3fifoEntry)
+		n := c.sizeOf(e.Key, e.Value)
+		c.nbytes += n
+		if !e.inMain {
+			c.smallBytes += n
+		}
+	}
+	c.evictOverflow()
+}
+
+// SetMaxEntries limits the number of cached entries. Zero means unlimited.
+func (c *CacheUseS3FIFO) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evictOverflow()
+}
+
+// CleanUp removes all expired entries from both queues.
+// Expired entries are not remembered in the ghost queue.
+func (c *CacheUseS3FIFO) CleanUp(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range []*list.List{c.small, c.main} {
+		var next *list.Element
+		for ele := l.Front(); ele != nil; ele = next {
+			next = ele.Next()
+			if ele.Value.(*s3fifoEntry).Expired(ttl) {
+				c.removeElement(ele)
+			}
+		}
+	}
+}
+
+// Entries returns a snapshot of the cached entries ordered from least to most recently used.
+func (c *CacheUseS3FIFO) Entries() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(c.cache))
+	for _, ele := range c.cache {
+		entries = append(entries, ele.Value.(*s3fifoEntry).Entry)
+	}
+	return sortByRecency(entries)
+}
+
+// Len returns the number of items in the cache.
+func (c *CacheUseS3FIFO) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
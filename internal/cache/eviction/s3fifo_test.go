@@ -0,0 +1,196 @@
+package eviction
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewCacheUseS3FIFO(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		wantCache bool
+	}{
+		{
+			name:      "valid cache",
+			maxBytes:  100,
+			wantCache: true,
+		},
+		{
+			name:      "zero size cache",
+			maxBytes:  0,
+			wantCache: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCacheUseS3FIFO(tt.maxBytes, nil)
+			if (cache != nil) != tt.wantCache {
+				t.Errorf("NewCacheUseS3FIFO() = %v, want %v", cache != nil, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestCacheUseS3FIFO_Operations(t *testing.T) {
+	t.Run("basic operations", func(t *testing.T) {
+		cache := NewCacheUseS3FIFO(1024, nil)
+
+		// Test Put and Get
+		cache.Put("key1", String("value1"))
+		if v, _, ok := cache.Get("key1"); !ok || string(v.(String)) != "value1" {
+			t.Errorf("Get after Put failed, got %v, want %v", v, "value1")
+		}
+
+		// Test missing key
+		if _, _, ok := cache.Get("missing"); ok {
+			t.Error("Get with missing key should return false")
+		}
+
+		// Test update existing key
+		cache.Put("key1", String("value2"))
+		if v, _, ok := cache.Get("key1"); !ok || string(v.(String)) != "value2" {
+			t.Errorf("Get after update failed, got %v, want %v", v, "value2")
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		evicted := make(map[string]Value)
+		onEvicted := func(key string, value Value) {
+			evicted[key] = value
+		}
+
+		cache := NewCacheUseS3FIFO(10, onEvicted) // Only enough for 2 entries
+
+		cache.Put("k1", String("v1")) // 4 bytes
+		cache.Put("k2", String("v2")) // 4 bytes
+		cache.Put("k3", String("v3")) // Should trigger eviction of k1
+
+		if _, _, ok := cache.Get("k1"); ok {
+			t.Error("k1 should have been evicted")
+		}
+
+		if _, ok := evicted["k1"]; !ok {
+			t.Error("eviction callback should have been called for k1")
+		}
+	})
+
+	t.Run("scan resistance", func(t *testing.T) {
+		cache := NewCacheUseS3FIFO(40, nil) // 10 entries of 4 bytes
+
+		cache.Put("k0", String("v0"))
+		cache.Get("k0")
+
+		// A scan of keys that are accessed once must not evict the accessed entry.
+		for i := 0; i < 50; i++ {
+			cache.Put(fmt.Sprintf("s%d", i), String("v"))
+		}
+
+		if _, _, ok := cache.Get("k0"); !ok {
+			t.Error("k0 was accessed and should have been moved to the main queue")
+		}
+		if _, _, ok := cache.Get("s0"); ok {
+			t.Error("s0 was never accessed and should have been evicted")
+		}
+	})
+
+	t.Run("ghost readmission", func(t *testing.T) {
+		cache := NewCacheUseS3FIFO(40, nil)
+
+		for i := 0; i < 11; i++ {
+			cache.Put(fmt.Sprintf("k%d", i), String("vv"))
+		}
+		if _, _, ok := cache.Get("k0"); ok {
+			t.Fatal("k0 should have been evicted from the small queue")
+		}
+		if _, ok := cache.ghosts["k0"]; !ok {
+			t.Fatal("k0 should be remembered in the ghost queue")
+		}
+
+		// A key seen again shortly after its eviction goes straight to the main queue.
+		cache.Put("k0", String("vv"))
+		if e := cache.cache["k0"].Value.(*s3fifoEntry); !e.inMain {
+			t.Error("k0 should have been inserted into the main queue")
+		}
+		if _, ok := cache.ghosts["k0"]; ok {
+			t.Error("k0 should have been removed from the ghost queue")
+		}
+	})
+}
+
+func TestCacheUseS3FIFO_MainReinsertion(t *testing.T) {
+	cache := NewCacheUseS3FIFO(0, nil)
+	cache.SetMaxEntries(10)
+
+	// Promote m0 and m1 to the main queue, then access only m1 again.
+	cache.Put("m0", String("v"))
+	cache.Put("m1", String("v"))
+	cache.Get("m0")
+	cache.Get("m1")
+	for i := 0; i < 10; i++ {
+		cache.Put(fmt.Sprintf("s%d", i), String("v"))
+	}
+	cache.Get("m1")
+
+	// Filling the small queue forces evictions from the main queue.
+	for i := 10; i < 30; i++ {
+		cache.Put(fmt.Sprintf("s%d", i), String("v"))
+		cache.Get(fmt.Sprintf("s%d", i))
+	}
+
+	if _, _, ok := cache.Get("m0"); ok {
+		t.Error("m0 was not accessed in the main queue and should have been evicted")
+	}
+	if cache.Len() != 10 {
+		t.Errorf("cache.Len() = %d, want 10", cache.Len())
+	}
+}
+
+func TestCacheUseS3FIFO_CleanUp(t *testing.T) {
+	cache := NewCacheUseS3FIFO(1024, nil)
+
+	// Add some entries
+	cache.Put("k1", String("v1"))
+	cache.Put("k2", String("v2"))
+	cache.Put("k3", String("v3"))
+
+	// Wait for entries to expire
+	time.Sleep(10 * time.Millisecond)
+
+	// Clean up with small TTL to force expiration
+	cache.CleanUp(5 * time.Millisecond)
+
+	// All entries should be cleaned up
+	if cache.Len() != 0 {
+		t.Errorf("CleanUp failed, cache should be empty, got len = %d", cache.Len())
+	}
+	if cache.nbytes != 0 || cache.smallBytes != 0 {
+		t.Errorf("CleanUp left nbytes = %d, smallBytes = %d", cache.nbytes, cache.smallBytes)
+	}
+}
+
+func TestCacheUseS3FIFO_Concurrent(t *testing.T) {
+	cache := NewCacheUseS3FIFO(64, nil)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Put(fmt.Sprintf("k%d", (i+j)%20), String("v"))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Get(fmt.Sprintf("k%d", (i+j)%20))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
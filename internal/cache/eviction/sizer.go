@@ -0,0 +1,75 @@
+package eviction
+
+import (
+	"container/list"
+	"unsafe"
+)
+
+// Sizer estimates how many bytes a cache entry occupies.
+// Strategies charge the estimate against their maxBytes limit.
+type Sizer interface {
+	// Size returns the estimated number of bytes used by the entry.
+	Size(key string, value Value) int64
+}
+
+// SizerFunc is an adapter to allow the use of ordinary functions as Sizers.
+type SizerFunc func(key string, value Value) int64
+
+// Size calls f(key, value), implementing the Sizer interface.
+func (f SizerFunc) Size(key string, value Value) int64 {
+	return f(key, value)
+}
+
+// PayloadSizer counts only the key and value bytes.
+// It is the default Sizer of every strategy.
+var PayloadSizer Sizer = SizerFunc(func(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len())
+})
+
+// mapSlotOverhead approximates the bytes used by one slot of a map[string]*T:
+// the string header, the pointer, the control byte and the spare capacity
+// kept by the map's load factor.
+const mapSlotOverhead = 32
+
+// EntryOverhead is the estimated bookkeeping cost of one cache entry on a 64-bit
+// platform: the list element, the Entry header and the map slot that indexes it.
+// It does not include the value's own header, which depends on the value type.
+var EntryOverhead = int64(unsafe.Sizeof(list.Element{})+unsafe.Sizeof(Entry{})) + mapSlotOverhead
+
+// OverheadSizer returns a Sizer that adds a fixed per-entry overhead
+// to the key and value bytes counted by PayloadSizer.
+func OverheadSizer(overhead int64) Sizer {
+	return SizerFunc(func(key string, value Value) int64 {
+		return overhead + PayloadSizer.Size(key, value)
+	})
+}
+
+// limiter is implemented by every strategy so that the size estimator
+// and the entry limit can be configured in the same way for all of them.
+type limiter interface {
+	SetSizer(sizer Sizer)
+	SetMaxEntries(n int)
+}
+
+// limits tracks the memory and entry limits shared by all strategies.
+// It is not safe for concurrent use; the owning strategy must guard it.
+type limits struct {
+	maxBytes   int64 // Maximum allowed size in bytes (0 means unlimited)
+	nbytes     int64 // Current size in bytes as estimated by sizer
+	maxEntries int   // Maximum number of entries (0 means unlimited)
+	sizer      Sizer // Estimates entry sizes, PayloadSizer if nil
+}
+
+// sizeOf returns the estimated size of an entry.
+func (l *limits) sizeOf(key string, value Value) int64 {
+	if l.sizer == nil {
+		return PayloadSizer.Size(key, value)
+	}
+	return l.sizer.Size(key, value)
+}
+
+// overLimit reports whether holding n entries at the current size breaks a limit.
+func (l *limits) overLimit(n int) bool {
+	return (l.maxBytes != 0 && l.nbytes > l.maxBytes) ||
+		(l.maxEntries > 0 && n > l.maxEntries)
+}
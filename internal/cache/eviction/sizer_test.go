@@ -0,0 +1,104 @@
+package eviction
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOverheadSizer(t *testing.T) {
+	sizer := OverheadSizer(100)
+	if got := sizer.Size("key", String("value")); got != 108 {
+		t.Errorf("OverheadSizer(100).Size() = %d, want 108", got)
+	}
+	if got := PayloadSizer.Size("key", String("value")); got != 8 {
+		t.Errorf("PayloadSizer.Size() = %d, want 8", got)
+	}
+	if EntryOverhead <= mapSlotOverhead {
+		t.Errorf("EntryOverhead = %d, want more than the map slot alone", EntryOverhead)
+	}
+}
+
+func TestLimits_AllStrategies(t *testing.T) {
+	names := []string{"lru", "lru-batch", "lfu", "fifo", "arc"}
+
+	t.Run("max entries", func(t *testing.T) {
+		// Limits below, at and above the number of segments of the
+		// segmented strategies, dividing evenly or not.
+		limits := []int{1, 4, defaultNumSegments - 1, defaultNumSegments, defaultNumSegments + 1, 40, 100}
+		for _, name := range Names() {
+			for _, n := range limits {
+				t.Run(fmt.Sprintf("%s/%d", name, n), func(t *testing.T) {
+					evictionType, _ := StringToEvictionType(name)
+					s, err := NewWithConfig(CacheConfig{
+						MaxBytes:     1 << 20,
+						MaxEntries:   n,
+						EvictionType: evictionType,
+						BatchSize:    1,
+					}, nil)
+					if err != nil {
+						t.Fatalf("NewWithConfig(%s) returned error: %v", name, err)
+					}
+					if stopper, ok := s.(Stopper); ok {
+						defer stopper.Stop()
+					}
+
+					for i := 0; i < 1000; i++ {
+						s.Put(fmt.Sprintf("key-%d", i), BytesValue("v"))
+						if got := s.Len(); got > n {
+							t.Fatalf("%s holds %d entries after %d puts, want at most %d", name, got, i+1, n)
+						}
+					}
+					if got := s.Len(); got == 0 {
+						t.Errorf("%s holds no entries", name)
+					}
+				})
+			}
+		}
+	})
+
+	t.Run("sizer overhead", func(t *testing.T) {
+		for _, name := range names {
+			t.Run(name, func(t *testing.T) {
+				evictionType, _ := StringToEvictionType(name)
+				s, err := NewWithConfig(CacheConfig{
+					MaxBytes:     32 * 1000,
+					EvictionType: evictionType,
+					BatchSize:    1,
+					Sizer:        OverheadSizer(1000),
+				}, nil)
+				if err != nil {
+					t.Fatalf("NewWithConfig(%s) returned error: %v", name, err)
+				}
+				if stopper, ok := s.(Stopper); ok {
+					defer stopper.Stop()
+				}
+
+				// Without the overhead all 100 entries would fit easily.
+				for i := 0; i < 100; i++ {
+					s.Put(fmt.Sprintf("key-%d", i), String("v"))
+				}
+				if got := s.Len(); got == 0 || got > 32 {
+					t.Errorf("%s holds %d entries, want between 1 and 32", name, got)
+				}
+			})
+		}
+	})
+
+	t.Run("set sizer recomputes usage", func(t *testing.T) {
+		fifo := NewCacheUseFIFO(100, nil)
+		for i := 0; i < 10; i++ {
+			fifo.Put(fmt.Sprintf("k%d", i), String("v"))
+		}
+		if fifo.Len() != 10 {
+			t.Fatalf("fifo.Len() = %d, want 10", fifo.Len())
+		}
+
+		fifo.SetSizer(OverheadSizer(30))
+		if fifo.Len() != 3 {
+			t.Errorf("after SetSizer fifo.Len() = %d, want 3", fifo.Len())
+		}
+		if fifo.nbytes != 99 {
+			t.Errorf("after SetSizer fifo.nbytes = %d, want 99", fifo.nbytes)
+		}
+	})
+}
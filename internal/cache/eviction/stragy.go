@@ -1,10 +1,12 @@
-// Package eviction provides cache eviction strategies including FIFO, LRU, and LFU.
+// Package eviction provides cache eviction strategies including FIFO, S3-FIFO, LRU, LFU, ARC and GDSF,
+// as well as a GC-friendly arena storage backend.
 // Each strategy implements different algorithms for determining which entries to remove
 // when the cache reaches its capacity.
 package eviction
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -21,6 +23,14 @@ const (
 	EvictionFIFO
 	// EvictionARC represents Adaptive Replacement Cache strategy
 	EvictionARC
+	// EvictionLRUBatch represents Least Recently Used strategy with batch eviction
+	EvictionLRUBatch
+	// EvictionArena represents First In First Out strategy over pointer-free byte arenas
+	EvictionArena
+	// EvictionS3FIFO represents the S3-FIFO strategy with small, main and ghost queues
+	EvictionS3FIFO
+	// EvictionGDSF represents the Greedy-Dual-Size-Frequency strategy weighing load cost, size and frequency
+	EvictionGDSF
 )
 
 // String returns the string representation of EvictionType
@@ -34,6 +44,14 @@ func (e EvictionType) String() string {
 		return "fifo"
 	case EvictionARC:
 		return "arc"
+	case EvictionLRUBatch:
+		return "lru-batch"
+	case EvictionArena:
+		return "arena"
+	case EvictionS3FIFO:
+		return "s3fifo"
+	case EvictionGDSF:
+		return "gdsf"
 	default:
 		return "unknown"
 	}
@@ -50,6 +68,14 @@ func StringToEvictionType(s string) (EvictionType, error) {
 		return EvictionFIFO, nil
 	case "arc":
 		return EvictionARC, nil
+	case "lru-batch":
+		return EvictionLRUBatch, nil
+	case "arena":
+		return EvictionArena, nil
+	case "s3fifo":
+		return EvictionS3FIFO, nil
+	case "gdsf":
+		return EvictionGDSF, nil
 	default:
 		return EvictionLRU, fmt.Errorf("invalid eviction type: %s", s)
 	}
@@ -57,7 +83,16 @@ func StringToEvictionType(s string) (EvictionType, error) {
 
 // IsValid checks if the EvictionType is valid
 func (e EvictionType) IsValid() bool {
-	return e >= EvictionLRU && e <= EvictionARC
+	return e >= EvictionLRU && e <= EvictionGDSF
+}
+
+// Names returns the names of all registered eviction strategies.
+func Names() []string {
+	var names []string
+	for e := EvictionLRU; e.IsValid(); e++ {
+		names = append(names, e.String())
+	}
+	return names
 }
 
 // Value represents a value that can be stored in the cache.
@@ -89,29 +124,110 @@ type CacheStrategy interface {
 
 // Entry represents a cache entry with its metadata.
 type Entry struct {
-	Key      string    // The key used to identify the entry
-	Value    Value     // The stored value
-	UpdateAt time.Time // Last time the entry was accessed or modified
+	Key      string        // The key used to identify the entry
+	Value    Value         // The stored value
+	UpdateAt time.Time     // Last time the entry was accessed or modified
+	ExpireAt time.Time     // Per-entry expiration time, zero means the strategy TTL applies
+	Cost     time.Duration // Time it took to load the value, zero if the strategy does not track it
 }
 
-// Expired checks if the entry has expired based on the given duration.
+// Expired checks if the entry has expired based on the given duration
+// or its own expiration time.
 func (e *Entry) Expired(duration time.Duration) bool {
+	if !e.ExpireAt.IsZero() {
+		return e.ExpireAt.Before(time.Now())
+	}
 	if e.UpdateAt.IsZero() {
 		return false // Never expires if update time is not set
 	}
 	return e.UpdateAt.Add(duration).Before(time.Now())
 }
 
+// deadline returns when the entry expires under the strategy-wide ttl.
+// The zero time means it never expires.
+func (e *Entry) deadline(ttl time.Duration) time.Time {
+	if !e.ExpireAt.IsZero() {
+		return e.ExpireAt
+	}
+	if ttl <= 0 || e.UpdateAt.IsZero() {
+		return time.Time{}
+	}
+	return e.UpdateAt.Add(ttl)
+}
+
 // Touch updates the entry's last access time to now.
 func (e *Entry) Touch() {
 	e.UpdateAt = time.Now()
 }
 
-// CacheConfig represents the configuration for a cache
+// Stopper is implemented by strategies that run background goroutines.
+// Stop must be called once the strategy is no longer used.
+type Stopper interface {
+	Stop()
+}
+
+// ExpiringStrategy is implemented by strategies that support per-entry expiration
+// in addition to their strategy-wide TTL.
+type ExpiringStrategy interface {
+	CacheStrategy
+
+	// PutWithExpiry adds or updates a value that expires at expireAt.
+	// A zero expireAt applies the strategy-wide TTL, like Put.
+	PutWithExpiry(key string, value Value, expireAt time.Time)
+}
+
+// CostAwareStrategy is implemented by strategies that take into account
+// how expensive a value was to load when choosing what to evict.
+type CostAwareStrategy interface {
+	CacheStrategy
+
+	// PutWithCost adds or updates a value that took cost to load.
+	// A non-positive cost means the cost was not measured.
+	PutWithCost(key string, value Value, cost time.Duration)
+}
+
+// Enumerable is implemented by strategies that can list their entries,
+// which lets a cache move its contents to another strategy.
+type Enumerable interface {
+	// Entries returns a snapshot of the cached entries ordered from least to
+	// most recently used, as far as the strategy tracks recency.
+	Entries() []Entry
+}
+
+// sortByRecency orders entries from least to most recently used.
+func sortByRecency(entries []Entry) []Entry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UpdateAt.Before(entries[j].UpdateAt)
+	})
+	return entries
+}
+
+// expirable is implemented by strategies that periodically remove expired entries.
+type expirable interface {
+	SetTTL(ttl time.Duration)
+	SetCleanupInterval(interval time.Duration)
+}
+
+// ager is implemented by strategies whose access counts decay over time.
+type ager interface {
+	SetAging(period time.Duration, factor float64)
+}
+
+// CacheConfig represents the configuration for a cache.
+// Zero values for TTL, CleanupInterval, BatchSize and MaxEntries keep the
+// strategy defaults, and a nil Sizer counts only key and value bytes.
+// A zero AgingPeriod disables the decay of access counts.
+// Every strategy holds at most MaxEntries entries.
 type CacheConfig struct {
 	MaxBytes        int64         `json:"max_bytes"`
+	MaxEntries      int           `json:"max_entries"`
 	EvictionType    EvictionType  `json:"eviction_type"`
 	CleanupInterval time.Duration `json:"cleanup_interval"`
+	TTL             time.Duration `json:"ttl"`
+	BatchSize       int           `json:"batch_size"`
+	AgingPeriod     time.Duration `json:"aging_period"`
+	AgingFactor     float64       `json:"aging_factor"`
+	Sizer           Sizer         `json:"-"`
 }
 
 // New creates a new cache with the specified eviction strategy.
@@ -121,16 +237,56 @@ func New(name string, maxBytes int64, onEvicted func(string, Value)) (CacheStrat
 	if err != nil {
 		return nil, err
 	}
-	switch evictionType {
+	return NewWithConfig(CacheConfig{MaxBytes: maxBytes, EvictionType: evictionType}, onEvicted)
+}
+
+// NewWithConfig creates a new cache from cfg.
+// Returns nil and an error if the eviction type is not supported.
+func NewWithConfig(cfg CacheConfig, onEvicted func(string, Value)) (CacheStrategy, error) {
+	var s CacheStrategy
+	switch cfg.EvictionType {
 	case EvictionLRU:
-		return NewCacheUseLRU(maxBytes, onEvicted), nil
+		s = NewCacheUseLRU(cfg.MaxBytes, onEvicted)
 	case EvictionLFU:
-		return NewCacheUseLFU(maxBytes, onEvicted), nil
+		s = NewCacheUseLFU(cfg.MaxBytes, onEvicted)
 	case EvictionFIFO:
-		return NewCacheUseFIFO(maxBytes, onEvicted), nil
+		s = NewCacheUseFIFO(cfg.MaxBytes, onEvicted)
 	case EvictionARC:
-		return NewCacheUseARC(maxBytes, onEvicted), nil
+		s = NewCacheUseARC(cfg.MaxBytes, onEvicted)
+	case EvictionLRUBatch:
+		c := NewCacheUseLRUBatch(cfg.MaxBytes, onEvicted)
+		c.SetBatchSize(cfg.BatchSize)
+		s = c
+	case EvictionArena:
+		s = NewCacheUseArena(cfg.MaxBytes, onEvicted)
+	case EvictionS3FIFO:
+		s = NewCacheUseS3FIFO(cfg.MaxBytes, onEvicted)
+	case EvictionGDSF:
+		s = NewCacheUseGDSF(cfg.MaxBytes, onEvicted)
 	default:
-		return nil, fmt.Errorf("unsupported cache strategy: %q", name)
+		return nil, fmt.Errorf("unsupported cache strategy: %q", cfg.EvictionType)
+	}
+
+	if l, ok := s.(limiter); ok {
+		if cfg.Sizer != nil {
+			l.SetSizer(cfg.Sizer)
+		}
+		if cfg.MaxEntries > 0 {
+			l.SetMaxEntries(cfg.MaxEntries)
+		}
+	}
+
+	if e, ok := s.(expirable); ok {
+		if cfg.TTL > 0 {
+			e.SetTTL(cfg.TTL)
+		}
+		if cfg.CleanupInterval > 0 {
+			e.SetCleanupInterval(cfg.CleanupInterval)
+		}
+	}
+
+	if a, ok := s.(ager); ok && cfg.AgingPeriod > 0 {
+		a.SetAging(cfg.AgingPeriod, cfg.AgingFactor)
 	}
+	return s, nil
 }
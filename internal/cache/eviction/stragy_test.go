@@ -0,0 +1,46 @@
+package eviction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnumerable_Entries(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(name, 1024, nil)
+			if err != nil {
+				t.Fatalf("New(%q) returned error: %v", name, err)
+			}
+			if stopper, ok := s.(Stopper); ok {
+				defer stopper.Stop()
+			}
+			e, ok := s.(Enumerable)
+			if !ok {
+				t.Fatalf("%s does not implement Enumerable", name)
+			}
+
+			for _, key := range []string{"a", "b", "c"} {
+				s.Put(key, BytesValue("v-"+key))
+				time.Sleep(time.Millisecond)
+			}
+			s.Get("a")
+
+			entries := e.Entries()
+			if len(entries) != 3 {
+				t.Fatalf("Entries() returned %d entries, want 3", len(entries))
+			}
+			for _, entry := range entries {
+				if v, ok := entry.Value.(ByteValue); !ok || string(v.Bytes()) != "v-"+entry.Key {
+					t.Errorf("entry %s has value %v", entry.Key, entry.Value)
+				}
+			}
+
+			// Strategies that do not track accesses on Get keep a in insertion order.
+			keys := entries[0].Key + entries[1].Key + entries[2].Key
+			if keys != "bca" && keys != "abc" {
+				t.Errorf("Entries() returned keys in order %s, want bca or abc", keys)
+			}
+		})
+	}
+}
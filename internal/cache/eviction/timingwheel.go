@@ -0,0 +1,183 @@
+package eviction
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	defaultWheelTick = time.Second // Resolution of expiration timers
+	wheelBits        = 6
+	wheelSize        = 1 << wheelBits // Slots per level
+	wheelMask        = wheelSize - 1
+	wheelLevels      = 4 // 64^4 ticks, about 194 days at the default tick
+)
+
+// wheelTimer is a pending expiration for one key.
+type wheelTimer struct {
+	key      string
+	deadline int64 // Expiration tick
+	slot     *list.List
+	elem     *list.Element
+}
+
+// timingWheel is a hierarchical timing wheel that tracks when keys expire.
+// Scheduling and cancelling a key are O(1), and advancing the wheel costs
+// O(1) per elapsed tick plus O(1) per expired or cascaded timer.
+//
+// Level 0 holds timers due within the current block of 64 ticks, level 1
+// those due within the current block of 64^2 ticks, and so on. Whenever a
+// block of a level begins, the matching slot of the level above is cascaded
+// down. Timers beyond the top level are kept in an overflow list and
+// reinserted each time the top level wraps around.
+//
+// Ticks are counted from the wheel's creation, so a caller that advances the
+// wheel from a ticker started at the same time sees each timer fire on the
+// first tick at or after its deadline.
+//
+// A timingWheel is not safe for concurrent use; the owning strategy must guard it.
+type timingWheel struct {
+	tick     time.Duration
+	origin   time.Time
+	current  int64 // Last tick processed
+	levels   [wheelLevels][wheelSize]*list.List
+	overflow *list.List
+	timers   map[string]*wheelTimer
+}
+
+// newTimingWheel creates a timing wheel with the given tick, starting at now.
+func newTimingWheel(tick time.Duration, now time.Time) *timingWheel {
+	if tick <= 0 {
+		tick = defaultWheelTick
+	}
+	w := &timingWheel{
+		tick:     tick,
+		origin:   now,
+		overflow: list.New(),
+		timers:   make(map[string]*wheelTimer),
+	}
+	for l := range w.levels {
+		for s := range w.levels[l] {
+			w.levels[l][s] = list.New()
+		}
+	}
+	return w
+}
+
+// schedule sets key to expire at deadline, replacing any earlier timer.
+func (w *timingWheel) schedule(key string, deadline time.Time) {
+	t, ok := w.timers[key]
+	if ok {
+		t.slot.Remove(t.elem)
+	} else {
+		t = &wheelTimer{key: key}
+		w.timers[key] = t
+	}
+
+	// Round up so that a timer never fires before its deadline;
+	// timers that are already due fire on the next tick.
+	d := deadline.Sub(w.origin)
+	t.deadline = int64((d + w.tick - 1) / w.tick)
+	if d < 0 || t.deadline <= w.current {
+		t.deadline = w.current + 1
+	}
+	w.insert(t)
+}
+
+// cancel removes key's timer, if any.
+func (w *timingWheel) cancel(key string) {
+	if t, ok := w.timers[key]; ok {
+		t.slot.Remove(t.elem)
+		delete(w.timers, key)
+	}
+}
+
+// insert places t on the lowest level whose current block contains its deadline.
+// The deadline must not be earlier than the current tick.
+func (w *timingWheel) insert(t *wheelTimer) {
+	slot := w.overflow
+	for level := 0; level < wheelLevels; level++ {
+		shift := wheelBits * (level + 1)
+		if t.deadline>>shift == w.current>>shift {
+			slot = w.levels[level][(t.deadline>>(wheelBits*level))&wheelMask]
+			break
+		}
+	}
+	t.slot = slot
+	t.elem = slot.PushBack(t)
+}
+
+// advance moves the wheel forward to now and returns the keys whose timers expired.
+// Expired timers are removed from the wheel.
+func (w *timingWheel) advance(now time.Time) []string {
+	var expired []string
+	target := int64(now.Sub(w.origin) / w.tick)
+	for w.current < target {
+		w.current++
+
+		// Cascade from the top down so that timers moved into a lower
+		// level's current slot are cascaded further in the same tick.
+		if w.current&(1<<(wheelBits*wheelLevels)-1) == 0 {
+			w.cascade(w.overflow)
+		}
+		for level := wheelLevels - 1; level > 0; level-- {
+			if w.current&(1<<(wheelBits*level)-1) == 0 {
+				w.cascade(w.levels[level][(w.current>>(wheelBits*level))&wheelMask])
+			}
+		}
+
+		slot := w.levels[0][w.current&wheelMask]
+		for e := slot.Front(); e != nil; e = slot.Front() {
+			t := slot.Remove(e).(*wheelTimer)
+			delete(w.timers, t.key)
+			expired = append(expired, t.key)
+		}
+	}
+	return expired
+}
+
+// cascade reinserts every timer of slot closer to the current tick.
+func (w *timingWheel) cascade(slot *list.List) {
+	pending := slot.Len()
+	for e := slot.Front(); pending > 0; e = slot.Front() {
+		// Overflow timers that are still out of reach go back to the end of slot.
+		w.insert(slot.Remove(e).(*wheelTimer))
+		pending--
+	}
+}
+
+// len returns the number of scheduled timers.
+func (w *timingWheel) len() int {
+	return len(w.timers)
+}
+
+// track schedules e to expire at its deadline under ttl, or cancels
+// its timer if the entry never expires.
+func (w *timingWheel) track(e *Entry, ttl time.Duration) {
+	if deadline := e.deadline(ttl); !deadline.IsZero() {
+		w.schedule(e.Key, deadline)
+	} else {
+		w.cancel(e.Key)
+	}
+}
+
+// expire advances the wheel to now and calls remove for each key whose entry
+// has expired under ttl. Timers fire lazily: an entry that was touched since it
+// was scheduled has a later deadline, so it is rescheduled instead of removed.
+func (w *timingWheel) expire(now time.Time, ttl time.Duration, entry func(key string) *Entry, remove func(key string)) {
+	for _, key := range w.advance(now) {
+		e := entry(key)
+		if e == nil {
+			continue
+		}
+		deadline := e.deadline(ttl)
+		switch {
+		case deadline.IsZero():
+			// The TTL was disabled after the timer was set.
+		case deadline.After(now):
+			w.schedule(key, deadline)
+		default:
+			remove(key)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package eviction
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimingWheel_Advance(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(time.Second, start)
+
+	// Deadlines cover every level and the overflow list.
+	deadlines := map[string]time.Duration{
+		"now":      0,
+		"level0":   10 * time.Second,
+		"level1":   100 * time.Second,
+		"level2":   5000 * time.Second,
+		"level3":   300000 * time.Second,
+		"overflow": 20000000 * time.Second,
+	}
+	for key, d := range deadlines {
+		w.schedule(key, start.Add(d))
+	}
+	if w.len() != len(deadlines) {
+		t.Fatalf("len = %d, want %d", w.len(), len(deadlines))
+	}
+
+	// Each timer must fire on the first tick at or after its deadline, and not before.
+	for key, d := range deadlines {
+		fireAt := d
+		if fireAt < time.Second {
+			fireAt = time.Second
+		}
+		w2 := newTimingWheel(time.Second, start)
+		w2.schedule(key, start.Add(d))
+		if got := w2.advance(start.Add(fireAt - time.Second)); len(got) != 0 {
+			t.Errorf("%s fired early: %v", key, got)
+		}
+		if got := w2.advance(start.Add(fireAt)); len(got) != 1 || got[0] != key {
+			t.Errorf("%s: advance = %v, want [%s]", key, got, key)
+		}
+	}
+
+	if fired := w.advance(start.Add(20000000 * time.Second)); len(fired) != len(deadlines) || w.len() != 0 {
+		t.Errorf("advance fired %v, %d timers left", fired, w.len())
+	}
+}
+
+func TestTimingWheel_RoundsUp(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(time.Second, start)
+	w.schedule("k", start.Add(1500*time.Millisecond))
+
+	if got := w.advance(start.Add(1999 * time.Millisecond)); len(got) != 0 {
+		t.Errorf("timer fired before its deadline: %v", got)
+	}
+	if got := w.advance(start.Add(2 * time.Second)); len(got) != 1 {
+		t.Errorf("timer did not fire on the tick after its deadline: %v", got)
+	}
+}
+
+func TestTimingWheel_RescheduleAndCancel(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(time.Second, start)
+	w.schedule("a", start.Add(5*time.Second))
+	w.schedule("b", start.Add(5*time.Second))
+
+	w.schedule("a", start.Add(100*time.Second))
+	w.cancel("b")
+	w.cancel("missing")
+
+	if got := w.advance(start.Add(99 * time.Second)); len(got) != 0 {
+		t.Errorf("advance = %v, want no expired keys", got)
+	}
+	if got := w.advance(start.Add(100 * time.Second)); len(got) != 1 || got[0] != "a" {
+		t.Errorf("advance = %v, want [a]", got)
+	}
+}
+
+func TestTimingWheel_PastDeadline(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := newTimingWheel(time.Second, start)
+	w.advance(start.Add(63 * time.Second))
+
+	// Already due: fires on the next tick, even across a level-0 block boundary.
+	w.schedule("late", start)
+	if got := w.advance(start.Add(64 * time.Second)); len(got) != 1 {
+		t.Errorf("advance = %v, want [late]", got)
+	}
+}
+
+func TestCacheUseLRU_PutWithExpiry(t *testing.T) {
+	lru := NewCacheUseLRU(1024, nil)
+	defer lru.Stop()
+	lru.SetCleanupInterval(10 * time.Millisecond)
+	lru.SetTTL(time.Hour)
+
+	lru.PutWithExpiry("short", String("v"), time.Now().Add(20*time.Millisecond))
+	lru.Put("long", String("v"))
+
+	time.Sleep(50 * time.Millisecond)
+	if lru.Len() != 1 {
+		t.Errorf("Len = %d, want 1 after the short entry expired", lru.Len())
+	}
+	if _, _, ok := lru.Get("long"); !ok {
+		t.Error("Entry using the cache-wide TTL should still exist")
+	}
+
+	// Get never returns an entry past its own expiry, even before the wheel fires.
+	lru.Stop()
+	lru.PutWithExpiry("k", String("v"), time.Now().Add(-time.Millisecond))
+	if _, _, ok := lru.Get("k"); ok {
+		t.Error("Get returned an expired entry")
+	}
+}
+
+func TestCacheUseARC_PutWithExpiry(t *testing.T) {
+	arc := NewCacheUseARC(1024, nil)
+	defer arc.Stop()
+	arc.SetCleanupInterval(10 * time.Millisecond)
+
+	// ARC has no cache-wide TTL by default, so only the per-entry expiry applies.
+	arc.PutWithExpiry("short", String("v"), time.Now().Add(20*time.Millisecond))
+	arc.Put("forever", String("v"))
+
+	time.Sleep(50 * time.Millisecond)
+	if _, _, ok := arc.Get("short"); ok {
+		t.Error("Entry should have expired")
+	}
+	if _, _, ok := arc.Get("forever"); !ok {
+		t.Error("Entry without expiry should still exist")
+	}
+}
+
+// BenchmarkExpire compares one cleanup pass of a full scan with one tick of
+// the timing wheel while n live entries are cached and none of them is due.
+// The TTL is long enough that the wheel never reaches the deadlines.
+// The pass runs under the segment locks, so its duration is the latency it
+// adds to concurrent Gets and Puts.
+func BenchmarkExpire(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000} {
+		lru := NewCacheUseLRU(0, nil)
+		lru.Stop()
+		lru.SetTTL(10000 * time.Hour)
+		for i := 0; i < n; i++ {
+			lru.Put(fmt.Sprintf("key-%d", i), String("v"))
+		}
+
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lru.CleanUp(10000 * time.Hour)
+			}
+		})
+		now := time.Now()
+		b.Run(fmt.Sprintf("wheel/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				now = now.Add(defaultWheelTick)
+				lru.expire(now)
+			}
+		})
+	}
+}
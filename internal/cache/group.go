@@ -10,6 +10,7 @@ import (
 	pb "github.com/1055373165/ggcache/api/studentpb"
 	"github.com/1055373165/ggcache/config"
 	"github.com/1055373165/ggcache/internal/bussiness/student/dao"
+	"github.com/1055373165/ggcache/internal/cache/eviction"
 	"github.com/1055373165/ggcache/pkg/common/logger"
 
 	"gorm.io/gorm"
@@ -18,9 +19,30 @@ import (
 // NewGroupManager creates and initializes cache groups for the given group names.
 // It returns a map of group names to their respective Group instances.
 func NewGroupManager(groupNames []string, currentPeerAddr string) map[string]*Group {
+	cfg, err := cacheConfigFromConf(config.Conf.GroupManager)
+	if err != nil {
+		logger.LogrusObj.Errorf("invalid group manager config: %v", err)
+		return GroupManager
+	}
+
+	shadows, err := shadowConfigFromConf(config.Conf.GroupManager.Shadow)
+	if err != nil {
+		logger.LogrusObj.Errorf("invalid shadow cache config: %v", err)
+	}
+
 	for _, name := range groupNames {
 		retriever := createStudentRetriever()
-		group := NewGroup(name, config.Conf.GroupManager.Strategy, config.Conf.GroupManager.MaxCacheSize, retriever)
+		group := NewGroupWithConfig(name, cfg, retriever)
+		if err := group.SetShadows(shadows); err != nil {
+			logger.LogrusObj.Errorf("%v", err)
+		}
+		if err := group.SetHedging(hedgeConfigFromConf(config.Conf.GroupManager.Hedge)); err != nil {
+			logger.LogrusObj.Errorf("invalid hedge config: %v", err)
+		}
+		if err := group.SetCompression(compressionConfigFromConf(config.Conf.GroupManager.Compression[name])); err != nil {
+			logger.LogrusObj.Errorf("invalid compression config of group %s: %v", name, err)
+		}
+		group.SetReplicas(config.Conf.GroupManager.Replicas)
 		GroupManager[name] = group
 		logger.LogrusObj.Infof("Group %s created with strategy %s", name, config.Conf.GroupManager.Strategy)
 	}
@@ -28,6 +50,117 @@ func NewGroupManager(groupNames []string, currentPeerAddr string) map[string]*Gr
 	return GroupManager
 }
 
+// cacheConfigFromConf converts the groupManager section of the configuration
+// into the settings used to build each group's eviction strategy.
+func cacheConfigFromConf(gm *config.GroupManager) (eviction.CacheConfig, error) {
+	evictionType, err := eviction.StringToEvictionType(gm.Strategy)
+	if err != nil {
+		return eviction.CacheConfig{}, err
+	}
+
+	sizer, err := NewSizer(gm.SizeEstimator)
+	if err != nil {
+		return eviction.CacheConfig{}, err
+	}
+
+	return eviction.CacheConfig{
+		MaxBytes:        gm.MaxCacheSize,
+		MaxEntries:      gm.MaxEntries,
+		Sizer:           sizer,
+		EvictionType:    evictionType,
+		TTL:             gm.TTL,
+		CleanupInterval: gm.CleanupInterval,
+		BatchSize:       gm.BatchSize,
+		AgingPeriod:     gm.AgingPeriod,
+		AgingFactor:     gm.AgingFactor,
+	}, nil
+}
+
+// ClientConfigFromConf converts the peerClient section of the configuration
+// into the configuration of the peer clients. A missing section selects
+// DefaultClientConfig.
+func ClientConfigFromConf(pc *config.PeerClient) ClientConfig {
+	if pc == nil {
+		return DefaultClientConfig
+	}
+	return ClientConfig{
+		DialTimeout:      pc.DialTimeout,
+		RequestTimeout:   pc.RequestTimeout,
+		KeepaliveTime:    pc.KeepaliveTime,
+		KeepaliveTimeout: pc.KeepaliveTimeout,
+		MaxMessageSize:   pc.MaxMessageSize,
+		BackoffBaseDelay: pc.BackoffBaseDelay,
+		BackoffMaxDelay:  pc.BackoffMaxDelay,
+
+		MaxIdleConnsPerHost: pc.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     pc.MaxConnsPerHost,
+		IdleConnTimeout:     pc.IdleConnTimeout,
+	}.withDefaults()
+}
+
+// BreakerConfigFromConf converts the breaker section of the peerClient
+// configuration. A missing section disables the circuit breakers.
+func BreakerConfigFromConf(bc *config.Breaker) BreakerConfig {
+	if bc == nil {
+		return BreakerConfig{}
+	}
+	return BreakerConfig{
+		Enabled:          bc.Enabled,
+		FailureThreshold: bc.FailureThreshold,
+		OpenTimeout:      bc.OpenTimeout,
+		MaxOpenTimeout:   bc.MaxOpenTimeout,
+		HalfOpenRequests: bc.HalfOpenRequests,
+	}
+}
+
+// shadowConfigFromConf converts the shadow section of the group manager
+// configuration. A missing section disables the shadow caches.
+func shadowConfigFromConf(sc *config.Shadow) (ShadowConfig, error) {
+	if sc == nil {
+		return ShadowConfig{}, nil
+	}
+
+	strategies := make([]eviction.EvictionType, 0, len(sc.Strategies))
+	for _, name := range sc.Strategies {
+		t, err := eviction.StringToEvictionType(name)
+		if err != nil {
+			return ShadowConfig{}, err
+		}
+		strategies = append(strategies, t)
+	}
+
+	return ShadowConfig{
+		SampleRate: sc.SampleRate,
+		Sizes:      sc.Sizes,
+		Strategies: strategies,
+	}, nil
+}
+
+// hedgeConfigFromConf converts the hedge section of the group manager
+// configuration. A missing section disables hedging.
+func hedgeConfigFromConf(hc *config.Hedge) HedgeConfig {
+	if hc == nil {
+		return HedgeConfig{}
+	}
+	return HedgeConfig{
+		Enabled:     hc.Enabled,
+		Quantile:    hc.Quantile,
+		MinDelay:    hc.MinDelay,
+		MaxDelay:    hc.MaxDelay,
+		BudgetRatio: hc.BudgetRatio,
+		BudgetBurst: hc.BudgetBurst,
+	}
+}
+
+// compressionConfigFromConf converts the compression section of a group.
+// A missing section disables compression.
+func compressionConfigFromConf(cc *config.Compression) CompressionConfig {
+	if cc == nil {
+		return CompressionConfig{}
+	}
+	return CompressionConfig{Codec: cc.Codec, MinSize: cc.MinSize}
+}
+
 // createStudentRetriever creates a new RetrieveFunc that fetches student data from the database.
 // It includes proper error handling and logging.
 func createStudentRetriever() RetrieveFunc {
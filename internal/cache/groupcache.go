@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/1055373165/ggcache/internal/cache/eviction"
 	"github.com/1055373165/ggcache/internal/metrics"
 	"github.com/1055373165/ggcache/pkg/common/logger"
 	"gorm.io/gorm"
@@ -23,12 +25,27 @@ type Group struct {
 	cache     *cache
 	retriever Retriever
 	server    Picker
+	replicas  int // number of peers holding each key
 	flight    *FlightGroup
+
+	compressor atomic.Pointer[compressor] // nil unless compression is enabled
+	hedger     atomic.Pointer[hedger]     // nil unless hedging is enabled
 }
 
 // NewGroup creates a new cache namespace with the specified configuration.
 // It returns an existing group if one exists with the same name.
 func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever) *Group {
+	evictionType, err := eviction.StringToEvictionType(strategy)
+	if err != nil {
+		logger.LogrusObj.Errorf("failed to create cache with strategy %q: %v", strategy, err)
+		return nil
+	}
+	return NewGroupWithConfig(name, eviction.CacheConfig{MaxBytes: maxBytes, EvictionType: evictionType}, retriever)
+}
+
+// NewGroupWithConfig creates a new cache namespace whose cache is built from cfg.
+// It returns an existing group if one exists with the same name.
+func NewGroupWithConfig(name string, cfg eviction.CacheConfig, retriever Retriever) *Group {
 	if retriever == nil {
 		panic("retriever is required for group creation")
 	}
@@ -43,9 +60,9 @@ func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever)
 	mu.Lock()
 	defer mu.Unlock()
 
-	cache, err := NewCache(strategy, maxBytes)
+	cache, err := NewCacheWithConfig(cfg)
 	if err != nil {
-		logger.LogrusObj.Errorf("failed to create cache with strategy %q: %v", strategy, err)
+		logger.LogrusObj.Errorf("failed to create cache with strategy %q: %v", cfg.EvictionType, err)
 		return nil
 	}
 
@@ -53,6 +70,7 @@ func NewGroup(name string, strategy string, maxBytes int64, retriever Retriever)
 		name:      name,
 		cache:     cache,
 		retriever: retriever,
+		replicas:  1,
 		flight:    NewFlightGroup(10 * time.Second),
 	}
 
@@ -69,6 +87,105 @@ func (g *Group) RegisterServer(p Picker) {
 	g.server = p
 }
 
+// SetReplicas sets the number of peers that hold each key, 1 by default.
+// With more than one, Set writes every replica and Get fails over to the
+// next replica when a peer cannot be reached, if the registered server is
+// a ReplicaPicker. It must be called before the group serves requests.
+func (g *Group) SetReplicas(n int) {
+	g.replicas = max(n, 1)
+}
+
+// SetStrategy switches the group's eviction strategy to the named one at runtime.
+// The cached entries are moved to the new strategy in order of recency while
+// the current strategy keeps serving requests.
+func (g *Group) SetStrategy(name string) error {
+	evictionType, err := eviction.StringToEvictionType(name)
+	if err != nil {
+		return err
+	}
+
+	from := g.cache.strategyType()
+	start := time.Now()
+	moved, err := g.cache.setStrategy(evictionType)
+	if err != nil {
+		return fmt.Errorf("failed to switch group %s to strategy %s: %w", g.name, evictionType, err)
+	}
+	logger.LogrusObj.Infof("Group %s switched eviction strategy from %s to %s, moved %d entries in %v",
+		g.name, from, evictionType, moved, time.Since(start))
+	return nil
+}
+
+// Strategy returns the name of the group's eviction strategy.
+func (g *Group) Strategy() string {
+	return g.cache.strategyType().String()
+}
+
+// SetShadows replaces the group's shadow caches, which estimate the hit ratio
+// the group would have with other eviction strategies and cache sizes.
+// A zero sample rate disables them.
+func (g *Group) SetShadows(sc ShadowConfig) error {
+	if err := g.cache.setShadows(g.name, sc); err != nil {
+		return fmt.Errorf("failed to set shadow caches of group %s: %w", g.name, err)
+	}
+	return nil
+}
+
+// SetCompression configures the compression of the values cached from now
+// on. Values already cached stay as they are. A zero config disables it.
+func (g *Group) SetCompression(cc CompressionConfig) error {
+	c, err := newCompressor(g.name, cc)
+	if err != nil {
+		return err
+	}
+	g.compressor.Store(c)
+	return nil
+}
+
+// SetHedging configures hedged and retried peer fetches of the group.
+// A disabled config asks one peer at a time and fails over without budget.
+func (g *Group) SetHedging(hc HedgeConfig) error {
+	h, err := newHedger(g.name, hc)
+	if err != nil {
+		return err
+	}
+	g.hedger.Store(h)
+	return nil
+}
+
+// ShadowStats returns the estimates of the group's shadow caches, or nil if they are disabled.
+func (g *Group) ShadowStats() []ShadowStats {
+	return g.cache.shadowStats()
+}
+
+// Ring returns the hash ring that places the group's keys on the peers.
+// It fails if no server is registered, its peers are not set yet, or it
+// uses a placement other than "ring".
+func (g *Group) Ring() (*ConsistentMap, error) {
+	p, ok := g.server.(placer)
+	if !ok {
+		return nil, fmt.Errorf("group %s has no peers", g.name)
+	}
+	placement := p.currentPlacement()
+	if placement == nil {
+		return nil, fmt.Errorf("peers of group %s are not set yet", g.name)
+	}
+	ring, ok := placement.(*ConsistentMap)
+	if !ok {
+		return nil, fmt.Errorf("group %s does not use the ring placement", g.name)
+	}
+	return ring, nil
+}
+
+// PeerBreakers returns the state of the circuit breakers guarding the peers
+// of the group, or nil if it has no peers or the breakers are disabled.
+func (g *Group) PeerBreakers() []BreakerStatus {
+	br, ok := g.server.(breakerReporter)
+	if !ok {
+		return nil
+	}
+	return br.breakerStats()
+}
+
 // GetGroup retrieves a Group by name from the GroupManager.
 func GetGroup(name string) *Group {
 	mu.RLock()
@@ -89,6 +206,7 @@ func DestroyGroup(name string) {
 		if g.flight != nil {
 			g.flight.Stop()
 		}
+		g.cache.close()
 		mu.Lock()
 		delete(GroupManager, name)
 		mu.Unlock()
@@ -111,15 +229,22 @@ func (g *Group) Get(key string) (ByteView, error) {
 	return g.load(key)
 }
 
-// load retrieves data for a key, either from a peer or locally.
-// It uses FlightGroup to prevent thundering herd.
+// load retrieves data for a key, either from a peer or locally, hedging slow
+// peers if the group is configured to. It uses FlightGroup to prevent
+// thundering herd.
 func (g *Group) load(key string) (value ByteView, err error) {
 	ctx := context.Background()
 	viewi, err := g.flight.Do(ctx, key, func() (interface{}, error) {
+		if h := g.hedger.Load(); h != nil {
+			return g.loadHedged(h, key)
+		}
+		if rp, ok := g.server.(ReplicaPicker); ok && g.replicas > 1 {
+			return g.loadFromReplicas(rp, key)
+		}
 		if g.server != nil {
 			if peer, ok := g.server.Pick(key); ok {
-				if value, err = g.fetchFromPeer(peer, key); err == nil {
-					return value, nil
+				if value, err = g.fetchFromPeer(peer, key); err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+					return value, err
 				}
 				logger.LogrusObj.Warnf("failed to get from peer: %v", err)
 			}
@@ -135,8 +260,108 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return viewi.(ByteView), nil
 }
 
-// fetchFromPeer retrieves data from a peer cache node.
+// loadFromReplicas fetches key from its replicas in order, failing over to
+// the next one when a fetch fails. It loads the key locally once it reaches
+// the current node, or if every replica failed. A replica reporting that the
+// key does not exist ends the search.
+func (g *Group) loadFromReplicas(rp ReplicaPicker, key string) (ByteView, error) {
+	for i, peer := range rp.PickReplicas(key, g.replicas) {
+		if peer == nil {
+			break
+		}
+		value, err := g.fetchFromPeer(peer, key)
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+			return value, err
+		}
+		logger.LogrusObj.Warnf("failed to get key %s from replica %d: %v", key, i, err)
+	}
+	return g.getLocally(key)
+}
+
+// Set stores value for key on every replica of the key: in the local cache
+// if the current node is one of them, and on the peers through Setter.
+// Without a registered server the value is only stored locally. Replicas
+// ejected by their circuit breaker are not skipped: they fail the write.
+// It returns the errors of the replicas that could not be written.
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+
+	replicas := []Fetcher{nil}
+	if wp, ok := g.server.(writeReplicaPicker); ok {
+		if peers := wp.pickWriteReplicas(key, g.replicas); len(peers) > 0 {
+			replicas = peers
+		}
+	} else if rp, ok := g.server.(ReplicaPicker); ok {
+		if peers := rp.PickReplicas(key, g.replicas); len(peers) > 0 {
+			replicas = peers
+		}
+	} else if g.server != nil {
+		if peer, ok := g.server.Pick(key); ok {
+			replicas = []Fetcher{peer}
+		}
+	}
+
+	var errs []error
+	for _, peer := range replicas {
+		if peer == nil {
+			g.setLocally(key, value)
+			continue
+		}
+		setter, ok := peer.(Setter)
+		if !ok {
+			errs = append(errs, fmt.Errorf("peer does not support set"))
+			continue
+		}
+		if err := setter.Set(g.name, key, value); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set key %q on replica: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// acceptHandoff caches a value handed off by the previous owner of key,
+// unless the key is already cached, and reports whether it did.
+// The value may arrive compressed with the codec of encoding.
+func (g *Group) acceptHandoff(key string, value []byte, encoding string, expireAt time.Time) bool {
+	c, err := codecByName(encoding)
+	if err != nil {
+		logger.LogrusObj.Warnf("dropping handed off key %s: %v", key, err)
+		return false
+	}
+	view := ByteView{b: cloneBytes(value), expireAt: expireAt, codec: c}
+	if view.IsExpired() {
+		return false
+	}
+	if _, err := view.decode(); err != nil {
+		logger.LogrusObj.Warnf("dropping handed off key %s: %v", key, err)
+		return false
+	}
+	return g.cache.add(key, g.compressor.Load().compress(view))
+}
+
+// setLocally stores a copy of value for key in the local cache, replacing
+// any result of a recent load.
+func (g *Group) setLocally(key string, value []byte) {
+	g.flight.ForceEvict(key)
+	g.populateCache(key, ByteView{b: cloneBytes(value)}, 0)
+}
+
+// fetchFromPeer retrieves data from a peer cache node, with its expiration
+// time if the peer reports it. A compressed value that does not decompress
+// is an error rather than a value to cache.
 func (g *Group) fetchFromPeer(peer Fetcher, key string) (ByteView, error) {
+	if vf, ok := peer.(viewFetcher); ok {
+		view, err := vf.fetchView(g.name, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		if _, err := view.decode(); err != nil {
+			return ByteView{}, fmt.Errorf("failed to decompress key %q from peer: %w", key, err)
+		}
+		return ByteView{b: cloneBytes(view.b), expireAt: view.expireAt, codec: view.codec}, nil
+	}
 	bytes, err := peer.Fetch(g.name, key)
 	if err != nil {
 		return ByteView{}, err
@@ -145,24 +370,29 @@ func (g *Group) fetchFromPeer(peer Fetcher, key string) (ByteView, error) {
 }
 
 // getLocally retrieves data from the configured retriever and populates the cache.
+// The time spent in the retriever is recorded as the entry's load cost.
 func (g *Group) getLocally(key string) (ByteView, error) {
+	start := time.Now()
 	bytes, err := g.retriever.retrieve(key)
+	cost := time.Since(start)
+	metrics.ObserveRequestDuration("load", cost.Seconds())
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// Cache empty result to prevent cache penetration
 			logger.LogrusObj.Infof("caching empty result for non-existent key %q to prevent cache penetration", key)
-			g.populateCache(key, ByteView{})
+			g.populateCache(key, ByteView{}, cost)
 		}
 		return ByteView{}, fmt.Errorf("failed to retrieve key %q locally: %w", key, err)
 	}
 
 	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	g.populateCache(key, value, cost)
 
 	return value, nil
 }
 
-// populateCache adds a key-value pair to the cache.
-func (g *Group) populateCache(key string, value ByteView) {
-	g.cache.put(key, value)
+// populateCache adds a key-value pair that took cost to load to the cache,
+// compressing the value if the group compresses values.
+func (g *Group) populateCache(key string, value ByteView, cost time.Duration) {
+	g.cache.putWithCost(key, g.compressor.Load().compress(value), cost)
 }
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+)
+
+// costRecorder is a cost-aware strategy that remembers the costs it was given.
+type costRecorder struct {
+	eviction.CacheStrategy
+	costs map[string]time.Duration
+}
+
+func (r *costRecorder) PutWithCost(key string, value eviction.Value, cost time.Duration) {
+	r.costs[key] = cost
+	r.Put(key, value)
+}
+
+func TestGroup_GetLocallyRecordsCost(t *testing.T) {
+	g := NewGroupWithConfig("cost-test", eviction.CacheConfig{MaxBytes: 1 << 10, EvictionType: eviction.EvictionGDSF},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			time.Sleep(20 * time.Millisecond)
+			return []byte("value"), nil
+		}))
+	defer DestroyGroup("cost-test")
+
+	recorder := &costRecorder{CacheStrategy: g.cache.strategy, costs: make(map[string]time.Duration)}
+	g.cache.strategy = recorder
+
+	if _, err := g.Get("k"); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if cost := recorder.costs["k"]; cost < 20*time.Millisecond {
+		t.Errorf("recorded load cost = %v, want at least 20ms", cost)
+	}
+}
+
+func TestGroup_SetStrategy(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroupWithConfig("switch-test", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte("value-" + key), nil
+		}))
+	defer DestroyGroup("switch-test")
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if _, err := g.Get(fmt.Sprintf("k%d", i)); err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+	}
+
+	// Gets keep being served from the cache while the entries are moved.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := fmt.Sprintf("k%d", i%n)
+			if v, err := g.Get(key); err != nil || v.String() != "value-"+key {
+				t.Errorf("Get(%s) = %v, %v during the switch", key, v, err)
+				return
+			}
+		}
+	}()
+
+	for _, name := range []string{"arc", "s3fifo", "gdsf", "lfu", "fifo"} {
+		if err := g.SetStrategy(name); err != nil {
+			t.Fatalf("SetStrategy(%s) returned error: %v", name, err)
+		}
+		if got := g.Strategy(); got != name {
+			t.Errorf("Strategy() = %s, want %s", got, name)
+		}
+		if got := g.cache.len(); got != n {
+			t.Errorf("after switching to %s the cache holds %d entries, want %d", name, got, n)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if got := loads.Load(); got != n {
+		t.Errorf("retriever was called %d times, want %d", got, n)
+	}
+	if err := g.SetStrategy("unknown"); err == nil {
+		t.Error("SetStrategy with an unknown strategy should fail")
+	}
+}
+
+func TestCache_SetStrategyKeepsCosts(t *testing.T) {
+	c, err := NewCacheWithConfig(eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionGDSF})
+	if err != nil {
+		t.Fatalf("NewCacheWithConfig returned error: %v", err)
+	}
+	c.putWithCost("slow", ByteView{b: []byte("v")}, time.Second)
+
+	if _, err := c.setStrategy(eviction.EvictionGDSF); err != nil {
+		t.Fatalf("setStrategy returned error: %v", err)
+	}
+	entries := c.strategy.(eviction.Enumerable).Entries()
+	if len(entries) != 1 || entries[0].Cost != time.Second {
+		t.Errorf("entries after the switch = %+v, want slow with its 1s cost", entries)
+	}
+}
+
+func TestCache_SetStrategyKeepsExpiry(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	c, err := NewCacheWithConfig(eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU, TTL: ttl})
+	if err != nil {
+		t.Fatalf("NewCacheWithConfig returned error: %v", err)
+	}
+	defer c.close()
+	c.put("k", ByteView{b: []byte("v")})
+	time.Sleep(ttl * 3 / 4)
+
+	if _, err := c.setStrategy(eviction.EvictionARC); err != nil {
+		t.Fatalf("setStrategy returned error: %v", err)
+	}
+	if _, ok := c.get("k"); !ok {
+		t.Fatal("k is missing right after the switch")
+	}
+	time.Sleep(ttl / 2)
+	if _, ok := c.get("k"); ok {
+		t.Error("k outlived its TTL after the switch")
+	}
+}
+
+// fakePeer is a peer whose cache is a map, or that fails every request if down.
+type fakePeer struct {
+	mu     sync.Mutex
+	down   bool
+	values map[string][]byte
+}
+
+func (p *fakePeer) Fetch(group string, key string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return nil, fmt.Errorf("peer is down")
+	}
+	value, ok := p.values[key]
+	if !ok {
+		return nil, fmt.Errorf("no value for key %s", key)
+	}
+	return value, nil
+}
+
+func (p *fakePeer) Set(group string, key string, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return fmt.Errorf("peer is down")
+	}
+	p.values[key] = value
+	return nil
+}
+
+// fakeReplicaPicker places every key on the same replicas.
+type fakeReplicaPicker struct {
+	replicas []Fetcher
+}
+
+func (p *fakeReplicaPicker) Pick(key string) (Fetcher, bool) {
+	return p.replicas[0], p.replicas[0] != nil
+}
+
+func (p *fakeReplicaPicker) PickReplicas(key string, n int) []Fetcher {
+	return p.replicas[:min(n, len(p.replicas))]
+}
+
+func TestGroup_Replicas(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroupWithConfig("replica-test", eviction.CacheConfig{MaxBytes: 1 << 10, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte("db-" + key), nil
+		}))
+	defer DestroyGroup("replica-test")
+
+	primary := &fakePeer{values: make(map[string][]byte)}
+	secondary := &fakePeer{values: make(map[string][]byte)}
+	g.RegisterServer(&fakeReplicaPicker{replicas: []Fetcher{primary, secondary, nil}})
+	g.SetReplicas(3)
+
+	// Set writes every replica, including the current node.
+	if err := g.Set("a", []byte("1")); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if string(primary.values["a"]) != "1" || string(secondary.values["a"]) != "1" {
+		t.Errorf("peers hold %q and %q, want both to hold %q", primary.values["a"], secondary.values["a"], "1")
+	}
+	if v, ok := g.cache.get("a"); !ok || v.String() != "1" {
+		t.Errorf("local cache holds %q, %v, want %q", v.String(), ok, "1")
+	}
+
+	// Get fails over from the primary to the next replica.
+	primary.down = true
+	secondary.values["b"] = []byte("2")
+	if v, err := g.Get("b"); err != nil || v.String() != "2" {
+		t.Errorf("Get(b) = %q, %v, want %q from the secondary", v.String(), err, "2")
+	}
+
+	// Reaching the current node loads locally.
+	if v, err := g.Get("c"); err != nil || v.String() != "db-c" {
+		t.Errorf("Get(c) = %q, %v, want %q", v.String(), err, "db-c")
+	}
+	if loads.Load() != 1 {
+		t.Errorf("retriever called %d times, want 1", loads.Load())
+	}
+
+	// Set reports the replicas it could not write.
+	if err := g.Set("d", []byte("4")); err == nil {
+		t.Error("Set with a replica down should return an error")
+	}
+	if string(secondary.values["d"]) != "4" {
+		t.Errorf("secondary holds %q, want %q", secondary.values["d"], "4")
+	}
+}
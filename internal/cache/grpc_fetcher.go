@@ -9,62 +9,135 @@ import (
 
 	pb "github.com/1055373165/ggcache/api/groupcachepb"
 	"github.com/1055373165/ggcache/pkg/common/logger"
-	"github.com/1055373165/ggcache/pkg/etcd/discovery"
 
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
-var _ Fetcher = (*Client)(nil)
+var (
+	_ Fetcher     = (*Client)(nil)
+	_ Setter      = (*Client)(nil)
+	_ viewFetcher = (*Client)(nil)
+)
 
+// Client is the gRPC client of one peer. It holds a single long-lived
+// connection to the peer's address, shared by all requests to it.
 type Client struct {
-	serviceName string
-	conn        *clientv3.Client
-	mu          sync.RWMutex // 保护连接状态
+	addr    string
+	timeout time.Duration // limit on each request
+	conn    *grpc.ClientConn
+	client  pb.GroupCacheClient
+	mu      sync.RWMutex // 保护连接状态
 }
 
-func NewClient(serviceName string) *Client {
-	cli, err := clientv3.NewFromURL("http://localhost:2379")
+// NewClient creates a client for the peer at addr configured by cfg, whose
+// zero fields take the value of DefaultClientConfig. The connection is
+// established in the background and re-established if it breaks.
+func NewClient(addr string, cfg ClientConfig) (*Client, error) {
+	cfg = cfg.withDefaults()
+	conn, err := grpc.NewClient(addr, cfg.dialOptions()...)
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("could not create connection to peer %s: %w", addr, err)
 	}
 	return &Client{
-		serviceName: serviceName,
-		conn:        cli,
-	}
+		addr:    addr,
+		timeout: cfg.RequestTimeout,
+		conn:    conn,
+		client:  pb.NewGroupCacheClient(conn),
+	}, nil
 }
 
 // Fetch gets the corresponding cache value from remote peer
 func (c *Client) Fetch(group string, key string) ([]byte, error) {
-	// Discover services and obtain connection to services
-	conn, err := discovery.Discovery(c.conn, c.serviceName)
+	view, err := c.fetchView(group, key)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	return view.decode()
+}
+
+// fetchView gets the cache value of key from the remote peer with its expiration time.
+func (c *Client) fetchView(group string, key string) (ByteView, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil {
+		return ByteView{}, fmt.Errorf("connection to peer %s is closed", c.addr)
+	}
 
-	grpcClient := pb.NewGroupCacheClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
 	start := time.Now()
-	resp, err := grpcClient.Get(ctx, &pb.GetRequest{
+	resp, err := c.client.Get(ctx, &pb.GetRequest{
 		Group: group,
 		Key:   key,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.serviceName)
+		return ByteView{}, fmt.Errorf("could not get %s/%s from peer %s: %w", group, key, c.addr, err)
 	}
 
 	logger.LogrusObj.Debugf("the duration of this grpc Call is: %v ms", time.Since(start).Milliseconds())
 
-	return resp.Value, nil
+	return viewFromResponse(resp, group, key, c.addr)
+}
+
+// viewFromResponse converts the response of peer to a get of group/key into a
+// value, still compressed if the peer sent it compressed, or into an error
+// wrapping gorm.ErrRecordNotFound if the key does not exist.
+func viewFromResponse(resp *pb.GetResponse, group, key, peer string) (ByteView, error) {
+	if resp.GetNotFound() {
+		return ByteView{}, fmt.Errorf("%s/%s not found on peer %s: %w", group, key, peer, gorm.ErrRecordNotFound)
+	}
+	c, err := codecByName(resp.GetEncoding())
+	if err != nil {
+		return ByteView{}, fmt.Errorf("%s/%s from peer %s: %w", group, key, peer, err)
+	}
+	view := ByteView{b: resp.GetValue(), codec: c}
+	if resp.GetExpireAt() != 0 {
+		view.expireAt = time.Unix(0, resp.GetExpireAt())
+	}
+	return view, nil
+}
+
+// Set stores the value of key in the cache of the remote peer
+func (c *Client) Set(group string, key string, value []byte) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil {
+		return fmt.Errorf("connection to peer %s is closed", c.addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if _, err := c.client.Set(ctx, &pb.SetRequest{
+		Group: group,
+		Key:   key,
+		Value: value,
+	}); err != nil {
+		return fmt.Errorf("could not set %s/%s on peer %s: %w", group, key, c.addr, err)
+	}
+	return nil
+}
+
+// handoff opens a stream to hand entries off to the peer.
+func (c *Client) handoff(ctx context.Context) (pb.GroupCache_HandoffClient, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil {
+		return nil, fmt.Errorf("connection to peer %s is closed", c.addr)
+	}
+	return c.client.Handoff(ctx)
 }
 
+// Close closes the connection to the peer. Requests made afterwards fail.
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn != nil {
-		return c.conn.Close()
+		err := c.conn.Close()
+		c.conn = nil
+		return err
 	}
 	return nil
 }
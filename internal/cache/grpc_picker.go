@@ -2,38 +2,67 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"github.com/1055373165/ggcache/internal/metrics"
 	"github.com/1055373165/ggcache/pkg/common/logger"
 	"github.com/1055373165/ggcache/pkg/common/validate"
 	"github.com/1055373165/ggcache/pkg/etcd/discovery"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gorm.io/gorm"
 )
 
-var _ Picker = (*Server)(nil)
+var _ ReplicaPicker = (*Server)(nil)
 
 var (
 	defaultAddr     = "127.0.0.1:9999"
 	defaultReplicas = 50
 	serviceName     = "GroupCache"
+
+	// defaultUpdateDebounce is the quiet interval after a membership change
+	// notification before the change is applied.
+	defaultUpdateDebounce = 500 * time.Millisecond
 )
 
+// maxUpdateDelays bounds, in debounce intervals, how long a stream of
+// notifications can postpone applying membership changes.
+const maxUpdateDelays = 10
+
 // Server provides gRPC-based peer-to-peer communication for distributed caching.
 type Server struct {
 	pb.UnimplementedGroupCacheServer
 
 	addr        string
+	weight      int // share of the keys this node registers for, relative to its peers
 	isRunning   bool
 	stopSignal  chan error
 	updateChan  chan struct{}
 	mu          sync.RWMutex
-	consistHash *ConsistentMap
+	placement   string    // name of the placement algorithm, DefaultPlacement if empty
+	loadBound   float64   // load bound factor ε of placements that support it, 0 disables it
+	consistHash Placement // decides which peer owns each key
 	clients     map[string]*Client
+	peerWeights map[string]int // peers in consistHash and their weights
+	stale       bool           // placement or load bound changed since consistHash was built
+	epoch       uint64         // number of membership changes applied to consistHash
+	debounce    time.Duration  // quiet interval before membership changes are applied
+	clientCfg   ClientConfig   // configuration of the peer clients and of the accepted connections
+	serverTLS   *tls.Config    // TLS of the accepted connections, nil for plaintext
+	auth        *Auth          // authenticates the accepted requests, nil accepts all
+	breakers    *breakerSet    // circuit breakers of the peers, nil disables them
+
+	handoffConfig HandoffConfig      // how entries are handed off to their new owners
+	handoffCancel context.CancelFunc // cancels the handoff in progress, if any
 }
 
 // NewServer creates a new cache server.
@@ -47,7 +76,128 @@ func NewServer(update chan struct{}, addr string) (*Server, error) {
 		return nil, fmt.Errorf("invalid peer address %s", addr)
 	}
 
-	return &Server{addr: addr, updateChan: update}, nil
+	return &Server{
+		addr:       addr,
+		updateChan: update,
+		debounce:   defaultUpdateDebounce,
+		clientCfg:  DefaultClientConfig,
+	}, nil
+}
+
+// SetWeight sets the weight the server registers with, which gives it a share
+// of the keys in proportion to the weights of its peers. It must be called
+// before Start; a non-positive weight registers DefaultWeight and one above
+// discovery.MaxWeight registers MaxWeight.
+func (s *Server) SetWeight(weight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weight = weight
+}
+
+// SetPlacement selects the algorithm that decides which peer owns each key:
+// "ring", "rendezvous", "jump" or "maglev". It applies from the next time
+// the peers are set or rediscovered.
+func (s *Server) SetPlacement(name string) error {
+	if _, err := NewPlacement(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.placement = name
+	s.stale = true
+	return nil
+}
+
+// SetLoadBound caps the in-flight requests this server forwards to each peer
+// at (1+epsilon) times the average, sending the excess of hot keys to the next
+// peer instead, if the placement supports it (the "ring" placement does).
+// It applies from the next time the peers are set or rediscovered; a
+// non-positive epsilon disables the bound.
+func (s *Server) SetLoadBound(epsilon float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadBound = epsilon
+	s.stale = true
+}
+
+// SetUpdateDebounce sets how long the membership must stay unchanged after a
+// notification on the update channel before the change is applied, 500ms by
+// default. A burst of notifications is applied at once, at the latest ten
+// intervals after the first one. A non-positive interval applies every
+// change immediately.
+func (s *Server) SetUpdateDebounce(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.debounce = max(d, 0)
+}
+
+// SetHandoff configures the handoff of cached entries to their new owners
+// when the peers are rediscovered, hottest first and within the configured
+// rates. Handoff is disabled unless cfg.Enabled is set.
+func (s *Server) SetHandoff(cfg HandoffConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handoffConfig = cfg
+}
+
+// SetClientConfig configures the connections to the peers, and the limits on
+// the connections the server accepts from them, which should match. It must
+// be called before SetPeers and Start; zero fields take the value of
+// DefaultClientConfig.
+func (s *Server) SetClientConfig(cfg ClientConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg.TLS == nil {
+		cfg.TLS = s.clientCfg.TLS
+	}
+	if cfg.Auth == nil {
+		cfg.Auth = s.clientCfg.Auth
+	}
+	s.clientCfg = cfg.withDefaults()
+}
+
+// SetTLSConfig serves the peers over TLS and connects to them over TLS,
+// mutual if cfg.ClientAuth is set. It must be called before SetPeers and
+// Start; a disabled cfg keeps the connections in plaintext.
+func (s *Server) SetTLSConfig(cfg TLSConfig) error {
+	server, client, err := cfg.configs()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serverTLS = server
+	s.clientCfg.TLS = client
+	return nil
+}
+
+// SetAuth makes the server authenticate and authorize requests with a, and
+// sign its requests to the peers if a authenticates peers. It must be called
+// before SetPeers and Start; a nil Auth accepts every request.
+func (s *Server) SetAuth(a *Auth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = a
+	s.clientCfg.Auth = a
+}
+
+// SetBreaker guards the requests to each peer with a circuit breaker that
+// ejects the peer from routing while it keeps failing, so that its keys are
+// loaded locally without waiting for it. It replaces the current breakers,
+// closed; a disabled cfg routes to every peer.
+func (s *Server) SetBreaker(cfg BreakerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakers = newBreakerSet(cfg)
+}
+
+// breakerStats returns the state of the circuit breakers of the peers, nil if they are disabled.
+func (s *Server) breakerStats() []BreakerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.breakers.stats()
 }
 
 // Get handles gRPC requests to fetch values from the cache.
@@ -66,117 +216,389 @@ func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse,
 		return resp, fmt.Errorf("no such group: %s", group)
 	}
 
+	return getResponse(g, key)
+}
+
+// getResponse gets key from g and describes the result as a response to a
+// peer: the value with its expiration time, or that the key does not exist.
+func getResponse(g *Group, key string) (*pb.GetResponse, error) {
+	resp := &pb.GetResponse{}
 	value, err := g.Get(key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		resp.NotFound = true
+		return resp, nil
+	}
 	if err != nil {
 		return resp, err
 	}
 
-	resp.Value = value.Bytes()
+	// Compressed values are sent as stored, for the reader to decompress.
+	resp.Value = value.b
+	resp.Encoding = codecName(value.codec)
+	if !value.expireAt.IsZero() {
+		resp.ExpireAt = value.expireAt.UnixNano()
+	}
+	return resp, nil
+}
+
+// Set handles gRPC requests to store a value in the local cache of a group.
+// The value is not forwarded: the node setting a key writes every replica itself.
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	group, key := req.GetGroup(), req.GetKey()
+	resp := &pb.SetResponse{}
+
+	logger.LogrusObj.Infof("[Server %s] Received RPC set request - group: %s, key: %s", s.addr, group, key)
+
+	if key == "" || group == "" {
+		return resp, fmt.Errorf("key and group name are required")
+	}
+
+	g := GetGroup(group)
+	if g == nil {
+		return resp, fmt.Errorf("no such group: %s", group)
+	}
+
+	g.setLocally(key, req.GetValue())
 	return resp, nil
 }
 
-// SetPeers configures each remote host IP to the Server
+// Handoff handles streams of entries handed off by a peer that owned them
+// before the peers changed. Entries are only added where the key is not
+// cached yet, so values loaded or set in the meantime are kept.
+func (s *Server) Handoff(stream pb.GroupCache_HandoffServer) error {
+	var received, accepted int
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		received++
+
+		g := GetGroup(entry.GetGroup())
+		if g == nil || entry.GetKey() == "" {
+			continue
+		}
+		var expireAt time.Time
+		if entry.GetExpireAt() != 0 {
+			expireAt = time.Unix(0, entry.GetExpireAt())
+		}
+		if g.acceptHandoff(entry.GetKey(), entry.GetValue(), entry.GetEncoding(), expireAt) {
+			accepted++
+		}
+	}
+
+	metrics.RecordHandoff("accepted", accepted)
+	logger.LogrusObj.Infof("[Server %s] accepted %d of %d handed off entries", s.addr, accepted, received)
+	return stream.SendAndClose(&pb.HandoffResponse{Accepted: int64(accepted)})
+}
+
+// SetPeers configures each remote host IP to the Server with DefaultWeight,
+// and starts applying the membership changes notified on the update channel.
 func (s *Server) SetPeers(peersAddrs []string) {
+	s.SetWeightedPeers(defaultWeights(peersAddrs))
+}
+
+// SetWeightedPeers is like SetPeers but gives each peer the weight it
+// registered with, as listed by discovery.ListServiceWeights, so that the
+// first placement matches the ones built on membership changes.
+func (s *Server) SetWeightedPeers(weights map[string]int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if len(peersAddrs) == 0 {
-		peersAddrs = []string{s.addr}
+	if len(weights) == 0 {
+		weights = defaultWeights([]string{s.addr})
 	}
 
-	s.consistHash = NewConsistentHash(defaultReplicas, nil)
-	s.consistHash.AddNodes(peersAddrs...)
+	s.peerWeights = weights
+	s.breakers.retain(s.peerWeights)
+	s.consistHash = buildPlacement(s.placement, s.loadBound, s.peerWeights)
+	s.stale = false
+	s.closeClients()
 	s.clients = make(map[string]*Client)
 
-	for _, peersAddr := range peersAddrs {
+	for peersAddr := range weights {
 		if !validate.ValidPeerAddr(peersAddr) {
 			s.mu.Unlock()
 			panic(fmt.Sprintf("[peer %s] invalid address format, it should be x.x.x.x:port", peersAddr))
 		}
-		s.clients[peersAddr] = NewClient("GroupCache")
+		s.connect(peersAddr)
 	}
+	s.setEpoch(s.epoch + 1)
 
-	go func() {
-		for {
-			select {
-			case <-s.updateChan:
-				s.reconstruct()
-			case <-s.stopSignal:
-				if err := s.Stop(); err != nil {
-					logger.LogrusObj.Errorf("Failed to stop server: %v", err)
-				}
-				return
-			default:
-				time.Sleep(2 * time.Second)
+	go s.watchUpdates()
+}
+
+// watchUpdates applies membership changes once the update channel has been
+// quiet for the debounce interval, or at the latest maxUpdateDelays debounce
+// intervals after the first pending notification, so that a burst of etcd
+// events during a deploy costs a single update.
+func (s *Server) watchUpdates() {
+	var (
+		timer   *time.Timer
+		fire    <-chan time.Time
+		pending time.Time // when the first pending notification arrived
+	)
+	// The stop signal is created by Start, which may run after the peers are set.
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+	for {
+		s.mu.RLock()
+		stop := s.stopSignal
+		s.mu.RUnlock()
+
+		select {
+		case <-s.updateChan:
+			s.mu.RLock()
+			debounce := s.debounce
+			s.mu.RUnlock()
+
+			now := time.Now()
+			if fire == nil {
+				pending = now
 			}
+			delay := min(debounce, pending.Add(maxUpdateDelays*debounce).Sub(now))
+			if timer == nil {
+				timer = time.NewTimer(delay)
+			} else {
+				timer.Stop()
+				timer.Reset(delay)
+			}
+			fire = timer.C
+		case <-fire:
+			fire = nil
+			s.reconstruct()
+		case <-tick.C:
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			if err := s.Stop(); err != nil {
+				logger.LogrusObj.Errorf("Failed to stop server: %v", err)
+			}
+			return
 		}
-	}()
+	}
 }
 
+// reconstruct updates the placement to the peers registered in etcd.
 func (s *Server) reconstruct() {
-	serviceList, err := discovery.ListServicePeers("GroupCache")
+	weights, err := discovery.ListServiceWeights("GroupCache")
 	if err != nil {
 		return
 	}
-
-	// 创建新的 map 和 hash 环
-	newClients := make(map[string]*Client)
-	newHash := NewConsistentHash(defaultReplicas, nil)
-	newHash.AddNodes(serviceList...)
-
-	// 复用现有的有效连接
-	s.mu.RLock()
-	for _, peerAddr := range serviceList {
+	for peerAddr := range weights {
 		if !validate.ValidPeerAddr(peerAddr) {
-			s.mu.RUnlock()
 			panic(fmt.Sprintf("[peer %s] invalid address format, expect x.x.x.x:port", peerAddr))
 		}
+	}
+	s.applyPeers(weights)
+}
 
-		// 尝试复用现有连接
-		if client, exists := s.clients[peerAddr]; exists {
-			newClients[peerAddr] = client
-		} else {
-			newClients[peerAddr] = NewClient("GroupCache")
+// applyPeers applies the differences between the given peers and the current
+// ones to the placement, adding, removing and reweighting only the peers that
+// changed, and bumps the epoch if anything did. The placement is rebuilt from
+// scratch only if its algorithm or load bound changed.
+func (s *Server) applyPeers(weights map[string]int) {
+	s.mu.Lock()
+	added, removed := diffPeers(s.peerWeights, weights)
+	if len(added) == 0 && len(removed) == 0 && !s.stale {
+		s.mu.Unlock()
+		return
+	}
+
+	var old Placement
+	if s.handoffConfig.Enabled {
+		old = clonePlacement(s.consistHash)
+	}
+	if s.consistHash == nil || s.stale {
+		s.consistHash = buildPlacement(s.placement, s.loadBound, weights)
+		s.stale = false
+	} else {
+		for _, peerAddr := range removed {
+			s.consistHash.RemoveNode(peerAddr)
 		}
+		s.consistHash.AddWeightedNodes(added)
 	}
-	s.mu.RUnlock()
 
-	// 原子替换
-	s.mu.Lock()
-	oldClients := s.clients
-	s.clients = newClients
-	s.consistHash = newHash
+	// 复用现有的连接，只为新节点建立连接，并关闭离开节点的连接
+	if s.clients == nil {
+		s.clients = make(map[string]*Client)
+	}
+	var closed []*Client
+	for _, peerAddr := range removed {
+		if _, exists := weights[peerAddr]; exists {
+			continue // reweighted, not gone
+		}
+		if client, exists := s.clients[peerAddr]; exists {
+			closed = append(closed, client)
+			delete(s.clients, peerAddr)
+		}
+	}
+	for peerAddr := range added {
+		if _, exists := s.clients[peerAddr]; !exists {
+			s.connect(peerAddr)
+		}
+	}
+	s.peerWeights = weights
+	s.breakers.retain(weights)
+	s.setEpoch(s.epoch + 1)
+	epoch, next := s.epoch, s.consistHash
 	s.mu.Unlock()
 
-	for addr, client := range oldClients {
-		if _, exists := newClients[addr]; !exists {
-			client.Close()
+	for _, client := range closed {
+		client.Close()
+	}
+	s.handoff(old, next)
+
+	logger.LogrusObj.Infof("hash ring epoch %d, added or reweighted %v, removed %v", epoch, added, removed)
+}
+
+// connect creates the client of a peer other than the current node, which
+// keeps a connection to the peer until it is closed.
+// Caller must hold the lock.
+func (s *Server) connect(peerAddr string) {
+	if peerAddr == s.addr {
+		return
+	}
+	client, err := NewClient(peerAddr, s.clientCfg)
+	if err != nil {
+		logger.LogrusObj.Errorf("failed to connect to peer %s: %v", peerAddr, err)
+		return
+	}
+	s.clients[peerAddr] = client
+}
+
+// closeClients closes the connections to all peers.
+// Caller must hold the lock.
+func (s *Server) closeClients() {
+	for addr, client := range s.clients {
+		if err := client.Close(); err != nil {
+			logger.LogrusObj.Warnf("failed to close connection to peer %s: %v", addr, err)
 		}
 	}
+}
 
-	logger.LogrusObj.Infof("hash ring reconstruct, contain service peer %v", serviceList)
+// diffPeers returns the peers of next that are new or have a new weight, and
+// the peers of cur that are gone or have a new weight. A reweighted peer is
+// in both, as it must be removed before it is added back with its new weight.
+func diffPeers(cur, next map[string]int) (added map[string]int, removed []string) {
+	added = make(map[string]int)
+	for peer, weight := range next {
+		if curWeight, ok := cur[peer]; !ok || curWeight != weight {
+			added[peer] = weight
+		}
+	}
+	for peer, weight := range cur {
+		if nextWeight, ok := next[peer]; !ok || nextWeight != weight {
+			removed = append(removed, peer)
+		}
+	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+// setEpoch records the epoch of the peers.
+// Caller must hold the lock.
+func (s *Server) setEpoch(epoch uint64) {
+	s.epoch = epoch
+	metrics.UpdateRingEpoch(epoch)
+}
+
+// Epoch returns the number of membership changes applied to the placement,
+// starting at 1 when the peers are first set.
+func (s *Server) Epoch() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.epoch
 }
 
 // Pick selects which cache node should handle the given key.
 // It returns (nil, false) only when the hash ring is not yet initialized (peerAddr is empty).
 // When the key is mapped to the current node, it still returns (nil, false) but this is an
 // expected case indicating the key should be handled locally.
+// With a load bound, a request to a peer counts towards its load until the fetch returns;
+// requests handled locally are not counted, as the peers count the ones they forward here.
+// Keys of a peer ejected by its circuit breaker are handled locally too.
 func (s *Server) Pick(key string) (Fetcher, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	peerAddr := s.consistHash.GetNode(key)
+	peerAddr, release := pick(s.consistHash, key)
 	if peerAddr == "" {
 		logger.LogrusObj.Warnf("hash ring not initialized yet, handling key %s locally", key)
 		return nil, false
 	}
 
 	if peerAddr == s.addr {
+		release()
 		logger.LogrusObj.Debugf("key %s is mapped to current node %s (local handling)", key, s.addr)
 		return nil, false
 	}
 
+	client, ok := s.clients[peerAddr]
+	if !ok {
+		release()
+		logger.LogrusObj.Warnf("no connection to peer %s, handling key %s locally", peerAddr, key)
+		return nil, false
+	}
+
+	b := s.breakers.get(peerAddr)
+	if !b.available() {
+		release()
+		logger.LogrusObj.Debugf("peer %s is ejected, handling key %s locally", peerAddr, key)
+		return nil, false
+	}
+
 	logger.LogrusObj.Debugf("key %s is mapped to remote peer %s", key, peerAddr)
-	return s.clients[peerAddr], true
+	return releasingFetcher{Fetcher: b.wrap(client), release: release}, true
+}
+
+// PickReplicas returns the fetchers for the peers holding the first n
+// replicas of key, with nil standing for the current node. Peers without a
+// connection or ejected by their circuit breaker are left out, and it returns
+// nil when the hash ring is not yet initialized. Requests to replicas do not
+// count towards the load bound.
+func (s *Server) PickReplicas(key string, n int) []Fetcher {
+	return s.replicas(key, n, false)
+}
+
+// pickWriteReplicas is like PickReplicas but keeps ejected peers, whose
+// breakers fail the writes to them.
+func (s *Server) pickWriteReplicas(key string, n int) []Fetcher {
+	return s.replicas(key, n, true)
+}
+
+// replicas returns the fetchers for the peers holding the first n replicas
+// of key, leaving out ejected peers unless withEjected is set.
+func (s *Server) replicas(key string, n int, withEjected bool) []Fetcher {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.consistHash == nil {
+		return nil
+	}
+
+	peerAddrs := s.consistHash.GetNodes(key, n)
+	fetchers := make([]Fetcher, 0, len(peerAddrs))
+	for _, peerAddr := range peerAddrs {
+		if peerAddr == s.addr {
+			fetchers = append(fetchers, nil)
+		} else if client, ok := s.clients[peerAddr]; ok {
+			if b := s.breakers.get(peerAddr); withEjected || b.available() {
+				fetchers = append(fetchers, b.wrap(client))
+			}
+		}
+	}
+	return fetchers
+}
+
+// currentPlacement returns the placement of the peers.
+func (s *Server) currentPlacement() Placement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.consistHash
 }
 
 // Start initializes and starts the gRPC server.
@@ -241,7 +663,15 @@ func (s *Server) setupListener() (net.Listener, error) {
 }
 
 func (s *Server) setupGRPCServer() *grpc.Server {
-	grpcServer := grpc.NewServer()
+	s.mu.RLock()
+	opts := s.clientCfg.serverOptions()
+	if s.serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.serverTLS)))
+	}
+	opts = append(opts, s.auth.serverOptions()...)
+	s.mu.RUnlock()
+
+	grpcServer := grpc.NewServer(opts...)
 	pb.RegisterGroupCacheServer(grpcServer, s)
 	return grpcServer
 }
@@ -253,7 +683,11 @@ func (s *Server) registerService(lis net.Listener, errChan chan error) error {
 		}
 	}()
 
-	err := discovery.Register(serviceName, s.addr, s.stopSignal)
+	s.mu.RLock()
+	weight := s.weight
+	s.mu.RUnlock()
+
+	err := discovery.Register(serviceName, s.addr, weight, s.stopSignal)
 	if err != nil {
 		logger.LogrusObj.Errorf("failed to register service: %v", err)
 		errChan <- err
@@ -299,10 +733,14 @@ func (s *Server) Stop() error {
 }
 
 func (s *Server) cleanup() {
-	// Clear maps and help GC
-	for k := range s.clients {
-		delete(s.clients, k)
+	if s.handoffCancel != nil {
+		s.handoffCancel()
+		s.handoffCancel = nil
 	}
+
+	// Close the peer connections, clear maps and help GC
+	s.closeClients()
 	s.clients = nil
 	s.consistHash = nil
+	s.peerWeights = nil
 }
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"google.golang.org/grpc"
+)
+
+// addrServer answers every Get with the address it listens on.
+type addrServer struct {
+	pb.UnimplementedGroupCacheServer
+	addr string
+}
+
+func (s *addrServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	return &pb.GetResponse{Value: []byte(s.addr)}, nil
+}
+
+// startAddrServer starts an addrServer on a free local port and returns its address.
+func startAddrServer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterGroupCacheServer(grpcServer, &addrServer{addr: lis.Addr().String()})
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+func TestClient_Fetch(t *testing.T) {
+	addrs := []string{startAddrServer(t), startAddrServer(t)}
+	for _, addr := range addrs {
+		client, err := NewClient(addr, ClientConfig{})
+		if err != nil {
+			t.Fatalf("NewClient(%s) returned error: %v", addr, err)
+		}
+
+		// Every request reaches the peer the client was created for.
+		for i := 0; i < 10; i++ {
+			value, err := client.Fetch("group", "key")
+			if err != nil {
+				t.Fatalf("Fetch returned error: %v", err)
+			}
+			if string(value) != addr {
+				t.Fatalf("Fetch from the client of %s reached %s", addr, value)
+			}
+		}
+
+		if err := client.Close(); err != nil {
+			t.Errorf("Close returned error: %v", err)
+		}
+		if _, err := client.Fetch("group", "key"); err == nil {
+			t.Error("Fetch after Close should fail")
+		}
+	}
+}
+
+func TestDiffPeers(t *testing.T) {
+	cur := map[string]int{"a": 10, "b": 10, "c": 10}
+	next := map[string]int{"a": 10, "b": 20, "d": 10}
+
+	added, removed := diffPeers(cur, next)
+	if want := map[string]int{"b": 20, "d": 10}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	added, removed = diffPeers(next, next)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("diff of identical peers = %v, %v, want nothing", added, removed)
+	}
+}
+
+func TestServer_ApplyPeers(t *testing.T) {
+	keys := placementKeys(5000)
+	nodes := placementNodes(4)
+
+	for _, name := range PlacementNames() {
+		t.Run(name, func(t *testing.T) {
+			s := &Server{addr: nodes[0]}
+			if err := s.SetPlacement(name); err != nil {
+				t.Fatalf("SetPlacement returned error: %v", err)
+			}
+			s.applyPeers(map[string]int{nodes[0]: 10, nodes[1]: 10, nodes[2]: 10})
+			ring := s.consistHash
+			if s.Epoch() != 1 {
+				t.Errorf("epoch after the first peers = %d, want 1", s.Epoch())
+			}
+
+			// A node joins, one leaves and one is reweighted.
+			final := map[string]int{nodes[0]: 10, nodes[1]: 30, nodes[3]: 10}
+			s.applyPeers(final)
+			if s.consistHash != ring {
+				t.Error("membership changes should update the placement in place")
+			}
+			if s.Epoch() != 2 {
+				t.Errorf("epoch after a change = %d, want 2", s.Epoch())
+			}
+			if _, ok := s.clients[nodes[2]]; ok {
+				t.Error("the client of a removed peer should be dropped")
+			}
+			if _, ok := s.clients[nodes[3]]; !ok {
+				t.Error("a client should be created for an added peer")
+			}
+			if _, ok := s.clients[nodes[0]]; ok {
+				t.Error("no client should be created for the current node")
+			}
+
+			// The result matches a placement built from scratch.
+			if m := moved(s.consistHash, buildPlacement(name, 0, final), keys); m != 0 {
+				t.Errorf("%.2f%% of keys differ from a placement built from the same peers", m*100)
+			}
+
+			// Unchanged peers are not an update.
+			s.applyPeers(final)
+			if s.Epoch() != 2 {
+				t.Errorf("epoch after no change = %d, want 2", s.Epoch())
+			}
+
+			// A new load bound rebuilds the placement.
+			s.SetLoadBound(0.5)
+			s.applyPeers(final)
+			if s.consistHash == ring || s.Epoch() != 3 {
+				t.Errorf("a new load bound should rebuild the placement and bump the epoch to 3, got epoch %d", s.Epoch())
+			}
+		})
+	}
+}
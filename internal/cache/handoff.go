@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"github.com/1055373165/ggcache/internal/metrics"
+	"github.com/1055373165/ggcache/pkg/common/logger"
+)
+
+// HandoffConfig controls the handoff of cached entries to their new owners
+// when the peers change, so that the new owners do not have to reload them.
+type HandoffConfig struct {
+	Enabled          bool
+	EntriesPerSecond float64 // most entries sent per second, 0 means unlimited
+	BytesPerSecond   float64 // most value bytes sent per second, 0 means unlimited
+	MaxEntries       int     // most entries of each group sent per peer change, hottest first, 0 means all
+}
+
+// handoffEntry is a cached entry of a group that moves to another peer.
+type handoffEntry struct {
+	group string
+	entry eviction.Entry
+}
+
+// planHandoff returns the entries of the groups that self owns under old but
+// another peer owns under next, by new owner. Each group's entries keep the
+// order of group.cache.hottest, and at most maxEntries of them are kept per
+// peer if maxEntries is positive.
+func planHandoff(self string, old, next Placement, groups []*Group, maxEntries int) map[string][]handoffEntry {
+	plan := make(map[string][]handoffEntry)
+	for _, g := range groups {
+		sent := make(map[string]int)
+		for _, e := range g.cache.hottest() {
+			if old.GetNode(e.Key) != self {
+				continue
+			}
+			owner := next.GetNode(e.Key)
+			if owner == "" || owner == self {
+				continue
+			}
+			if maxEntries > 0 && sent[owner] >= maxEntries {
+				continue
+			}
+			sent[owner]++
+			plan[owner] = append(plan[owner], handoffEntry{group: g.name, entry: e})
+		}
+	}
+	return plan
+}
+
+// sortedGroups returns the registered groups in order of name.
+func sortedGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	groups := make([]*Group, 0, len(GroupManager))
+	for _, g := range GroupManager {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+// pacer spaces out sends so that they stay within a number of entries and
+// of bytes per second, measured from the first send.
+type pacer struct {
+	entriesPerSecond float64
+	bytesPerSecond   float64
+	start            time.Time
+	entries          float64
+	bytes            float64
+}
+
+// newPacer returns a pacer enforcing the rates of cfg.
+func newPacer(cfg HandoffConfig) *pacer {
+	return &pacer{
+		entriesPerSecond: cfg.EntriesPerSecond,
+		bytesPerSecond:   cfg.BytesPerSecond,
+		start:            time.Now(),
+	}
+}
+
+// wait blocks until an entry of size bytes can be sent within the rates,
+// or until ctx is done, in which case it returns the context's error.
+func (p *pacer) wait(ctx context.Context, size int) error {
+	var due time.Duration
+	if p.entriesPerSecond > 0 {
+		due = max(due, time.Duration(p.entries/p.entriesPerSecond*float64(time.Second)))
+	}
+	if p.bytesPerSecond > 0 {
+		due = max(due, time.Duration(p.bytes/p.bytesPerSecond*float64(time.Second)))
+	}
+	p.entries++
+	p.bytes += float64(size)
+
+	if d := due - time.Since(p.start); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// handoff sends the entries whose owner changed from the current node to
+// another peer when the placement changes from old to next. A later call
+// cancels the handoff in progress, whose remaining keys the new owners load
+// as usual. Nodes signing their requests hand off only over TLS.
+func (s *Server) handoff(old, next Placement) {
+	s.mu.Lock()
+	if s.handoffCancel != nil {
+		s.handoffCancel()
+		s.handoffCancel = nil
+	}
+	cfg := s.handoffConfig
+	if !cfg.Enabled || old == nil || next == nil {
+		s.mu.Unlock()
+		return
+	}
+	if auth := s.clientCfg.Auth; auth != nil && auth.peer != nil && s.clientCfg.TLS == nil {
+		s.mu.Unlock()
+		logger.LogrusObj.Warn("skipping handoff: peers refuse signed streams without TLS")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.handoffCancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		start := time.Now()
+		plan := planHandoff(s.addr, old, next, sortedGroups(), cfg.MaxEntries)
+		peers := make([]string, 0, len(plan))
+		for peer := range plan {
+			peers = append(peers, peer)
+		}
+		sort.Strings(peers)
+
+		p := newPacer(cfg)
+		for _, peer := range peers {
+			s.mu.RLock()
+			client, ok := s.clients[peer]
+			s.mu.RUnlock()
+			if !ok {
+				logger.LogrusObj.Warnf("no connection to peer %s, skipping handoff of %d entries", peer, len(plan[peer]))
+				continue
+			}
+
+			sent, accepted, err := sendHandoff(ctx, client, plan[peer], p)
+			metrics.RecordHandoff("sent", sent)
+			if err != nil {
+				logger.LogrusObj.Warnf("handoff to %s stopped after %d of %d entries: %v", peer, sent, len(plan[peer]), err)
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			logger.LogrusObj.Infof("handed off %d entries to %s, %d accepted", sent, peer, accepted)
+		}
+		logger.LogrusObj.Infof("handoff to %d peers finished in %v", len(peers), time.Since(start))
+	}()
+}
+
+// sendHandoff streams entries to the peer of client, paced by p, and returns
+// how many were sent and how many the peer accepted.
+func sendHandoff(ctx context.Context, client *Client, entries []handoffEntry, p *pacer) (sent int, accepted int, err error) {
+	stream, err := client.handoff(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not open handoff stream: %w", err)
+	}
+
+	for _, he := range entries {
+		// Compressed values are sent as stored.
+		var value []byte
+		var encoding string
+		switch v := he.entry.Value.(type) {
+		case ByteView:
+			value, encoding = v.b, codecName(v.codec)
+		case eviction.ByteValue:
+			value = v.Bytes()
+		default:
+			continue
+		}
+		if err := p.wait(ctx, len(value)); err != nil {
+			return sent, 0, err
+		}
+
+		var expireAt int64
+		if !he.entry.ExpireAt.IsZero() {
+			expireAt = he.entry.ExpireAt.UnixNano()
+		}
+		if err := stream.Send(&pb.HandoffEntry{
+			Group:    he.group,
+			Key:      he.entry.Key,
+			Value:    value,
+			ExpireAt: expireAt,
+			Encoding: encoding,
+		}); err != nil {
+			return sent, 0, fmt.Errorf("could not send entry %s/%s: %w", he.group, he.entry.Key, err)
+		}
+		sent++
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return sent, 0, err
+	}
+	return sent, int(resp.GetAccepted()), nil
+}
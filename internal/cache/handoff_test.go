@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"google.golang.org/grpc"
+)
+
+// newHandoffGroup returns a group holding keys k0 to k<n-1>, k<n-1> the most recently used.
+func newHandoffGroup(t *testing.T, name string, n int) *Group {
+	g := NewGroupWithConfig(name, eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			return []byte("db-" + key), nil
+		}))
+	t.Cleanup(func() { DestroyGroup(name) })
+	for i := 0; i < n; i++ {
+		g.cache.put(fmt.Sprintf("k%d", i), ByteView{b: []byte(fmt.Sprintf("v%d", i))})
+	}
+	return g
+}
+
+func TestPlanHandoff(t *testing.T) {
+	g := newHandoffGroup(t, "handoff-plan", 1000)
+	nodes := placementNodes(4)
+	self := nodes[0]
+	old, _ := NewPlacement("ring")
+	old.AddNodes(nodes[:3]...)
+	next, _ := NewPlacement("ring")
+	next.AddNodes(nodes...)
+
+	plan := planHandoff(self, old, next, []*Group{g}, 0)
+	if len(plan) == 0 {
+		t.Fatal("adding a node should move some keys")
+	}
+	planned := 0
+	for peer, entries := range plan {
+		last := 1000
+		for _, e := range entries {
+			if old.GetNode(e.entry.Key) != self || next.GetNode(e.entry.Key) != peer {
+				t.Errorf("key %s planned for %s but is owned by %s, then %s", e.entry.Key, peer,
+					old.GetNode(e.entry.Key), next.GetNode(e.entry.Key))
+			}
+			// Hotter entries come first.
+			var i int
+			fmt.Sscanf(e.entry.Key, "k%d", &i)
+			if i >= last {
+				t.Errorf("key %s planned after k%d, want the most recently used first", e.entry.Key, last)
+			}
+			last = i
+		}
+		planned += len(entries)
+	}
+
+	// Every key that moved away from self is planned.
+	want := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if old.GetNode(key) == self && next.GetNode(key) != self {
+			want++
+		}
+	}
+	if planned != want {
+		t.Errorf("planned %d entries, want %d", planned, want)
+	}
+
+	capped := planHandoff(self, old, next, []*Group{g}, 5)
+	for peer, entries := range capped {
+		if len(entries) > 5 {
+			t.Errorf("planned %d entries for %s, want at most 5", len(entries), peer)
+		}
+	}
+}
+
+func TestPacer(t *testing.T) {
+	p := newPacer(HandoffConfig{EntriesPerSecond: 1000, BytesPerSecond: 10000})
+	start := time.Now()
+	// 21 entries of 100 bytes: the byte rate allows one per 10ms.
+	for i := 0; i < 21; i++ {
+		if err := p.wait(context.Background(), 100); err != nil {
+			t.Fatalf("wait returned error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("21 entries of 100 bytes at 10000 bytes/s took %v, want at least 200ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.wait(ctx, 1<<20); err == nil {
+		t.Error("wait with a canceled context should return its error")
+	}
+}
+
+func TestServer_Handoff(t *testing.T) {
+	src := newHandoffGroup(t, "handoff-src", 10)
+	dst := newHandoffGroup(t, "handoff-dst", 0)
+	dst.cache.put("k3", ByteView{b: []byte("newer")})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterGroupCacheServer(grpcServer, &Server{addr: lis.Addr().String()})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	var entries []handoffEntry
+	for _, e := range src.cache.hottest() {
+		entries = append(entries, handoffEntry{group: "handoff-dst", entry: e})
+	}
+	expired := eviction.Entry{Key: "gone", Value: ByteView{b: []byte("x")}, ExpireAt: time.Now().Add(-time.Minute)}
+	entries = append(entries, handoffEntry{group: "handoff-dst", entry: expired})
+
+	client, err := NewClient(lis.Addr().String(), ClientConfig{})
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	defer client.Close()
+
+	sent, accepted, err := sendHandoff(context.Background(), client, entries, newPacer(HandoffConfig{}))
+	if err != nil {
+		t.Fatalf("sendHandoff returned error: %v", err)
+	}
+	if sent != 11 || accepted != 9 {
+		t.Errorf("sent %d and accepted %d entries, want 11 and 9", sent, accepted)
+	}
+	if v, ok := dst.cache.get("k7"); !ok || v.String() != "v7" {
+		t.Errorf("handed off k7 = %q, %v, want %q", v.String(), ok, "v7")
+	}
+	if v, _ := dst.cache.get("k3"); v.String() != "newer" {
+		t.Errorf("k3 = %q, want the value cached before the handoff", v.String())
+	}
+	if _, ok := dst.cache.get("gone"); ok {
+		t.Error("an expired entry should not be accepted")
+	}
+}
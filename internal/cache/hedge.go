@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/metrics"
+	"github.com/1055373165/ggcache/pkg/common/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	// latencyWindowSize is the number of recent peer fetch latencies the hedge delay is computed from.
+	latencyWindowSize = 512
+	// minLatencySamples is the number of latencies needed before the quantile replaces MaxDelay.
+	minLatencySamples = 20
+	// latencyRecomputeEvery is the number of new latencies after which the quantile is computed again.
+	latencyRecomputeEvery = 32
+)
+
+// HedgeConfig configures hedged and retried peer fetches of a group.
+//
+// When the first peer asked for a key has not answered within the Quantile
+// of the recent peer fetch latencies, the next candidate is asked as well:
+// the next replica, or the local retriever once there is none. The first
+// answer wins; the slower request is left to finish in the background.
+// Hedges draw from a budget refilled by BudgetRatio for each load, so they
+// add at most that fraction of extra peer requests. A failed fetch is
+// retried on the next candidate without drawing from the budget, as it is
+// without hedging.
+type HedgeConfig struct {
+	Enabled     bool
+	Quantile    float64       // quantile of the peer fetch latencies the hedge waits for, 0.95 if zero
+	MinDelay    time.Duration // shortest wait before hedging, 1ms if zero
+	MaxDelay    time.Duration // longest wait before hedging, also used until enough latencies are known, 100ms if zero
+	BudgetRatio float64       // hedges allowed per load, 0.1 if zero
+	BudgetBurst float64       // most hedges saved up, 10 if zero
+}
+
+// withDefaults returns c with its zero fields set to their defaults.
+func (c HedgeConfig) withDefaults() HedgeConfig {
+	if c.Quantile == 0 {
+		c.Quantile = 0.95
+	}
+	if c.MinDelay <= 0 {
+		c.MinDelay = time.Millisecond
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = 100 * time.Millisecond
+	}
+	c.MaxDelay = max(c.MaxDelay, c.MinDelay)
+	if c.BudgetRatio == 0 {
+		c.BudgetRatio = 0.1
+	}
+	if c.BudgetBurst == 0 {
+		c.BudgetBurst = 10
+	}
+	return c
+}
+
+// hedger holds the hedging state of a group.
+type hedger struct {
+	group     string
+	cfg       HedgeConfig
+	latencies latencyWindow
+	budget    retryBudget
+}
+
+// newHedger returns the hedger of the group configured by hc, or nil if hedging is disabled.
+func newHedger(group string, hc HedgeConfig) (*hedger, error) {
+	if !hc.Enabled {
+		return nil, nil
+	}
+	hc = hc.withDefaults()
+	if hc.Quantile <= 0 || hc.Quantile > 1 {
+		return nil, fmt.Errorf("hedge quantile must be in (0, 1], got %v", hc.Quantile)
+	}
+	if hc.BudgetRatio < 0 || hc.BudgetBurst < 0 {
+		return nil, fmt.Errorf("hedge budget must not be negative, got ratio %v and burst %v", hc.BudgetRatio, hc.BudgetBurst)
+	}
+	return &hedger{
+		group:     group,
+		cfg:       hc,
+		latencies: latencyWindow{samples: make([]time.Duration, latencyWindowSize)},
+		budget:    retryBudget{ratio: hc.BudgetRatio, burst: hc.BudgetBurst, tokens: hc.BudgetBurst},
+	}, nil
+}
+
+// delay returns how long to wait for a peer before hedging: the configured
+// quantile of the recent latencies, within MinDelay and MaxDelay.
+func (h *hedger) delay() time.Duration {
+	d, ok := h.latencies.quantile(h.cfg.Quantile)
+	if !ok {
+		d = h.cfg.MaxDelay
+	}
+	d = min(max(d, h.cfg.MinDelay), h.cfg.MaxDelay)
+	metrics.UpdateHedgeDelay(h.group, d.Seconds())
+	return d
+}
+
+// latencyWindow keeps the latest latencies and their quantile.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration // ring buffer
+	next    int
+	count   int
+	pending int // samples observed since cached was computed
+	cached  time.Duration
+	valid   bool
+}
+
+// observe records a latency.
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+	w.count = min(w.count+1, len(w.samples))
+	w.pending++
+}
+
+// quantile returns the q quantile of the latencies, computed again every
+// latencyRecomputeEvery samples, and false if too few are known.
+func (w *latencyWindow) quantile(q float64) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count < minLatencySamples {
+		return 0, false
+	}
+	if !w.valid || w.pending >= latencyRecomputeEvery {
+		sorted := make([]time.Duration, w.count)
+		copy(sorted, w.samples[:w.count])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		i := int(math.Ceil(q*float64(len(sorted)))) - 1
+		w.cached = sorted[max(i, 0)]
+		w.pending, w.valid = 0, true
+	}
+	return w.cached, true
+}
+
+// retryBudget limits hedges to a fraction of the loads.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	burst  float64
+	tokens float64
+}
+
+// deposit credits the budget for a load.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+}
+
+// withdraw takes an extra request from the budget and reports whether there was one.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// candidates returns the fetchers asked for key in order: the peer the key
+// is picked on, or its replicas up to the current node, and finally nil
+// standing for the local retriever.
+func (g *Group) candidates(key string) []Fetcher {
+	var peers []Fetcher
+	if rp, ok := g.server.(ReplicaPicker); ok && g.replicas > 1 {
+		peers = rp.PickReplicas(key, g.replicas)
+	} else if g.server != nil {
+		if peer, ok := g.server.Pick(key); ok {
+			peers = []Fetcher{peer}
+		}
+	}
+
+	candidates := make([]Fetcher, 0, len(peers)+1)
+	for _, peer := range peers {
+		if peer == nil {
+			break
+		}
+		candidates = append(candidates, peer)
+	}
+	return append(candidates, nil)
+}
+
+// loadHedged loads key from its candidates, hedging a slow one with the next
+// candidate within the budget of h and retrying a failed one on the next.
+// The local retriever, last of the candidates, is the fallback once the
+// peers failed. A peer reporting that the key does not exist ends the load.
+func (g *Group) loadHedged(h *hedger, key string) (ByteView, error) {
+	candidates := g.candidates(key)
+	if len(candidates) == 1 {
+		return g.getLocally(key)
+	}
+	h.budget.deposit()
+
+	type result struct {
+		view ByteView
+		err  error
+		i    int
+	}
+	results := make(chan result, len(candidates))
+	kinds := make([]string, len(candidates)) // why each candidate was asked, "" for the first and fallbacks
+	launch := func(i int, kind string) {
+		kinds[i] = kind
+		go func() {
+			peer := candidates[i]
+			if peer == nil {
+				view, err := g.getLocally(key)
+				results <- result{view, err, i}
+				return
+			}
+			start := time.Now()
+			view, err := g.fetchFromPeer(peer, key)
+			if err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+				h.latencies.observe(time.Since(start))
+			}
+			results <- result{view, err, i}
+		}()
+	}
+
+	launch(0, "")
+	next, inFlight := 1, 1
+	hedge := time.NewTimer(h.delay())
+	defer hedge.Stop()
+
+	var lastErr error
+	for inFlight > 0 {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil || errors.Is(r.err, gorm.ErrRecordNotFound) {
+				if kinds[r.i] != "" {
+					metrics.RecordHedge(g.name, kinds[r.i], "won")
+				}
+				return r.view, r.err
+			}
+			lastErr = r.err
+			if next == len(candidates) {
+				continue
+			}
+			logger.LogrusObj.Warnf("failed to get key %s from candidate %d: %v", key, r.i, r.err)
+			if candidates[next] == nil {
+				launch(next, "")
+			} else {
+				metrics.RecordHedge(g.name, "retry", "sent")
+				launch(next, "retry")
+			}
+			next++
+			inFlight++
+		case <-hedge.C:
+			if next == len(candidates) {
+				continue
+			}
+			if !h.budget.withdraw() {
+				metrics.RecordHedge(g.name, "hedge", "denied")
+				continue
+			}
+			metrics.RecordHedge(g.name, "hedge", "sent")
+			launch(next, "hedge")
+			next++
+			inFlight++
+		}
+	}
+	return ByteView{}, lastErr
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+)
+
+// slowPeer answers every key with its name after a delay.
+type slowPeer struct {
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (p *slowPeer) Fetch(group string, key string) ([]byte, error) {
+	p.calls.Add(1)
+	time.Sleep(p.delay)
+	return []byte("peer-" + key), nil
+}
+
+func TestLatencyWindow(t *testing.T) {
+	w := latencyWindow{samples: make([]time.Duration, latencyWindowSize)}
+	for i := 1; i < minLatencySamples; i++ {
+		w.observe(time.Millisecond)
+	}
+	if _, ok := w.quantile(0.95); ok {
+		t.Errorf("quantile of %d samples should not be known", minLatencySamples-1)
+	}
+
+	w = latencyWindow{samples: make([]time.Duration, latencyWindowSize)}
+	for i := 1; i <= 100; i++ {
+		w.observe(time.Duration(i) * time.Millisecond)
+	}
+	if got, ok := w.quantile(0.95); !ok || got != 95*time.Millisecond {
+		t.Errorf("p95 of 1..100ms = %v, %v, want 95ms", got, ok)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := retryBudget{ratio: 0.5, burst: 1}
+	if b.withdraw() {
+		t.Error("an empty budget should deny")
+	}
+	b.deposit()
+	if b.withdraw() {
+		t.Error("half a token should deny")
+	}
+	for i := 0; i < 10; i++ {
+		b.deposit()
+	}
+	if !b.withdraw() || b.withdraw() {
+		t.Error("the budget should save up a single token, its burst")
+	}
+}
+
+func TestGroup_Hedging(t *testing.T) {
+	var loads atomic.Int32
+	g := NewGroupWithConfig("hedge-test", eviction.CacheConfig{MaxBytes: 1 << 10, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			return []byte("db-" + key), nil
+		}))
+	defer DestroyGroup("hedge-test")
+
+	slow := &slowPeer{delay: 200 * time.Millisecond}
+	fast := &slowPeer{}
+	g.RegisterServer(&fakeReplicaPicker{replicas: []Fetcher{slow, fast, nil}})
+	g.SetReplicas(3)
+	if err := g.SetHedging(HedgeConfig{Enabled: true, MaxDelay: 10 * time.Millisecond, BudgetBurst: 1}); err != nil {
+		t.Fatalf("SetHedging returned error: %v", err)
+	}
+
+	// A slow primary is hedged with the next replica, which answers first.
+	start := time.Now()
+	if v, err := g.Get("a"); err != nil || v.String() != "peer-a" {
+		t.Fatalf("Get(a) = %q, %v, want %q", v.String(), err, "peer-a")
+	}
+	if elapsed := time.Since(start); elapsed >= slow.delay {
+		t.Errorf("hedged Get took %v, want less than the slow peer's %v", elapsed, slow.delay)
+	}
+	if fast.calls.Load() != 1 {
+		t.Errorf("second replica asked %d times, want 1", fast.calls.Load())
+	}
+
+	// Without budget left, the slow primary is waited for.
+	start = time.Now()
+	if _, err := g.Get("b"); err != nil {
+		t.Fatalf("Get(b) returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < slow.delay {
+		t.Errorf("Get without budget took %v, want the slow peer's %v", elapsed, slow.delay)
+	}
+	if fast.calls.Load() != 1 {
+		t.Errorf("second replica asked %d times without budget, want 1", fast.calls.Load())
+	}
+
+	// Failed fetches walk the replicas even without budget.
+	down := &fakePeer{down: true}
+	g.server = &fakeReplicaPicker{replicas: []Fetcher{down, down, fast, nil}}
+	g.SetReplicas(4)
+	g.hedger.Load().budget.tokens = 0
+	if v, err := g.Get("d"); err != nil || v.String() != "peer-d" {
+		t.Errorf("Get(d) = %q, %v, want %q from the third replica", v.String(), err, "peer-d")
+	}
+	if loads.Load() != 0 {
+		t.Errorf("retriever called %d times, want the retries to reach the live replica", loads.Load())
+	}
+	g.SetReplicas(3)
+
+	// Without another replica the hedge goes to the local retriever.
+	g.server = &fakeReplicaPicker{replicas: []Fetcher{slow, nil}}
+	g.hedger.Load().budget.tokens = 1
+	if v, err := g.Get("c"); err != nil || v.String() != "db-c" {
+		t.Errorf("Get(c) = %q, %v, want %q from the retriever", v.String(), err, "db-c")
+	}
+	if loads.Load() != 1 {
+		t.Errorf("retriever called %d times, want 1", loads.Load())
+	}
+}
@@ -1,37 +1,147 @@
 package cache
 
 import (
+	"bytes"
 	"fmt"
 
 	"io"
 	"net/http"
 	"net/url"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	_ Fetcher     = (*httpFetcher)(nil)
+	_ Setter      = (*httpFetcher)(nil)
+	_ viewFetcher = (*httpFetcher)(nil)
 )
 
-var _ Fetcher = (*httpFetcher)(nil)
+// protobufContentType is the content type of the protobuf bodies exchanged by peers over HTTP.
+const protobufContentType = "application/x-protobuf"
 
 type httpFetcher struct {
-	baseURL string
+	baseURL        string
+	client         *http.Client
+	maxMessageSize int
+	backoff        *dialBackoff
+	auth           *Auth // signs the requests, nil sends them unsigned
+}
+
+// newHTTPFetcher returns a fetcher for the node serving baseURL, using client
+// and the message size, backoff and request signing of cfg.
+func newHTTPFetcher(baseURL string, client *http.Client, cfg ClientConfig) *httpFetcher {
+	return &httpFetcher{
+		baseURL:        baseURL,
+		client:         client,
+		maxMessageSize: cfg.MaxMessageSize,
+		backoff:        newDialBackoff(cfg),
+		auth:           cfg.Auth,
+	}
 }
 
 // httpFetcher responsible for querying the value of key from the group cache of the specified node through http request
 func (h *httpFetcher) Fetch(group string, key string) ([]byte, error) {
-	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
-
-	res, err := http.Get(u)
+	view, err := h.fetchView(group, key)
 	if err != nil {
 		return nil, err
 	}
+	return view.decode()
+}
+
+// fetchView queries the value of key with its expiration time, decoding the
+// pb.GetResponse the node answers with.
+func (h *httpFetcher) fetchView(group string, key string) (ByteView, error) {
+	req, err := http.NewRequest(http.MethodGet, h.url(group, key), nil)
+	if err != nil {
+		return ByteView{}, err
+	}
+	req.Header.Set("Accept", protobufContentType)
+	res, err := h.do(req)
+	if err != nil {
+		return ByteView{}, err
+	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+		return ByteView{}, fmt.Errorf("server returned: %v", res.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, int64(h.maxMessageSize)+1))
+	if err != nil {
+		return ByteView{}, fmt.Errorf("reading response body failed: %v", err)
+	}
+	if len(b) > h.maxMessageSize {
+		return ByteView{}, fmt.Errorf("response body larger than %d bytes", h.maxMessageSize)
+	}
+
+	resp := &pb.GetResponse{}
+	if err := proto.Unmarshal(b, resp); err != nil {
+		return ByteView{}, fmt.Errorf("decoding response body failed: %v", err)
+	}
+	return viewFromResponse(resp, group, key, h.baseURL)
+}
+
+// Set stores the value of key in the group cache of the node with a PUT
+// request carrying a pb.SetRequest.
+func (h *httpFetcher) Set(group string, key string, value []byte) error {
+	body, err := proto.Marshal(&pb.SetRequest{Group: group, Key: key, Value: value})
+	if err != nil {
+		return err
+	}
+	if len(body) > h.maxMessageSize {
+		return fmt.Errorf("request body larger than %d bytes", h.maxMessageSize)
 	}
 
-	b, err := io.ReadAll(res.Body)
+	req, err := http.NewRequest(http.MethodPut, h.url(group, key), bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("reading response body failed: %v", err)
+		return err
 	}
+	req.Header.Set("Content-Type", protobufContentType)
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// url returns the URL of key in group on the node.
+func (h *httpFetcher) url(group string, key string) string {
+	return fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
+}
+
+// do signs and sends req unless the node is backed off after failing to connect.
+// The response body is drained on close so that the connection can be reused.
+func (h *httpFetcher) do(req *http.Request) (*http.Response, error) {
+	if err := h.backoff.allow(); err != nil {
+		return nil, err
+	}
+	h.auth.signHTTP(req)
+	res, err := h.client.Do(req)
+	h.backoff.done(err)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = drainingBody{res.Body}
+	return res, nil
+}
+
+// drainingBody reads what remains of a response body before closing it,
+// which lets the transport return the connection to its idle pool.
+type drainingBody struct {
+	io.ReadCloser
+}
+
+// drainLimit is the most bytes read from an unconsumed body to reuse its connection.
+const drainLimit = 64 << 10
 
-	return b, nil
+func (b drainingBody) Close() error {
+	io.Copy(io.Discard, io.LimitReader(b.ReadCloser, drainLimit))
+	return b.ReadCloser.Close()
 }
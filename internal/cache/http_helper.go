@@ -2,15 +2,18 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/1055373165/ggcache/config"
 	"github.com/1055373165/ggcache/pkg/common/logger"
 )
 
@@ -18,6 +21,8 @@ import (
 type HTTPServer struct {
 	srv     *http.Server
 	handler *HTTPPool
+	tls     TLSConfig    // TLS between the nodes
+	auth    *config.Auth // authentication of the requests, nil accepts all
 	cache   *Group
 	stopCh  chan struct{}
 	wg      sync.WaitGroup
@@ -26,14 +31,27 @@ type HTTPServer struct {
 // NewServer creates a new HTTP cache server instance.
 func NewHTTPServer(currentSrvAddr string, peers []string, cache *Group) *HTTPServer {
 	h := NewHTTPPool(currentSrvAddr)
+	if config.Conf != nil {
+		h.SetClientConfig(ClientConfigFromConf(config.Conf.PeerClient))
+		if config.Conf.PeerClient != nil {
+			h.SetBreaker(BreakerConfigFromConf(config.Conf.PeerClient.Breaker))
+		}
+	}
 	h.UpdatePeers(peers...)
 	cache.RegisterServer(h)
 
-	return &HTTPServer{
+	s := &HTTPServer{
 		handler: h,
 		cache:   cache,
 		stopCh:  make(chan struct{}),
 	}
+	if config.Conf != nil && config.Conf.TLS != nil {
+		s.tls = TLSConfigFromConf(config.Conf.TLS.Peer)
+	}
+	if config.Conf != nil {
+		s.auth = config.Conf.Auth
+	}
+	return s
 }
 
 // StartHTTPCacheServer starts a cache server with graceful shutdown support.
@@ -52,11 +70,22 @@ func StartHTTPCacheServer(currentSrvAddr string, peers []string, cache *Group) e
 	return nil
 }
 
-// Start initializes and starts the HTTP server
+// Start initializes and starts the HTTP server, over TLS if it is configured.
 func (s *HTTPServer) Start(addr string) error {
+	if s.tls.Enabled {
+		if err := s.handler.SetTLSConfig(s.tls); err != nil {
+			return fmt.Errorf("invalid peer TLS config: %w", err)
+		}
+	}
+	auth, err := AuthFromConf(s.auth)
+	if err != nil {
+		return fmt.Errorf("invalid auth config: %w", err)
+	}
+	s.handler.SetAuth(auth)
 	s.srv = &http.Server{
-		Addr:    addr,
-		Handler: s.handler,
+		Addr:      addr,
+		Handler:   auth.Middleware(s.handler, s.handler.access),
+		TLSConfig: s.handler.serverTLSConfig(),
 	}
 
 	// Start server in a goroutine
@@ -64,7 +93,7 @@ func (s *HTTPServer) Start(addr string) error {
 	go func() {
 		defer s.wg.Done()
 		logger.LogrusObj.Infof("cache service is running at %v", addr)
-		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(s.srv); err != nil && err != http.ErrServerClosed {
 			logger.LogrusObj.Errorf("HTTP server error: %v", err)
 		}
 	}()
@@ -91,6 +120,15 @@ func (s *HTTPServer) Stop(ctx context.Context) error {
 	return nil
 }
 
+// listenAndServe serves srv over TLS if it has a TLS configuration, whose
+// certificates come from GetCertificate, and over plain HTTP otherwise.
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
 // handleSignals sets up signal handling for graceful shutdown
 func (s *HTTPServer) handleSignals() {
 	sigCh := make(chan os.Signal, 1)
@@ -114,16 +152,25 @@ func (s *HTTPServer) handleSignals() {
 type APIServer struct {
 	srv    *http.Server
 	cache  *Group
+	tls    TLSConfig    // TLS of the API clients
+	auth   *config.Auth // authentication of the requests, nil accepts all
 	stopCh chan struct{}
 	wg     sync.WaitGroup
 }
 
 // NewAPIServer creates a new HTTP API server instance
 func NewAPIServer(cache *Group) *APIServer {
-	return &APIServer{
+	s := &APIServer{
 		cache:  cache,
 		stopCh: make(chan struct{}),
 	}
+	if config.Conf != nil && config.Conf.TLS != nil {
+		s.tls = TLSConfigFromConf(config.Conf.TLS.API)
+	}
+	if config.Conf != nil {
+		s.auth = config.Conf.Auth
+	}
+	return s
 }
 
 // StartHTTPAPIServer starts an API server with graceful shutdown support
@@ -142,14 +189,29 @@ func StartHTTPAPIServer(apiAddr string, cache *Group) error {
 	return nil
 }
 
-// Start initializes and starts the API server
+// Start initializes and starts the API server, over TLS if it is configured.
 func (s *APIServer) Start(addr string) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api", s.handleAPIRequest)
+	auth, err := AuthFromConf(s.auth)
+	if err != nil {
+		return fmt.Errorf("invalid auth config: %w", err)
+	}
 
+	mux := http.NewServeMux()
+	mux.Handle("/api", auth.Middleware(http.HandlerFunc(s.handleAPIRequest), s.apiAccess))
+	mux.Handle("/admin/strategy", auth.Middleware(http.HandlerFunc(s.handleStrategy), s.adminAccess))
+	mux.Handle("/admin/shadows", auth.Middleware(http.HandlerFunc(s.handleShadows), s.adminAccess))
+	mux.Handle("/admin/breakers", auth.Middleware(http.HandlerFunc(s.handleBreakers), s.adminAccess))
+	mux.Handle("/admin/ring", auth.Middleware(http.HandlerFunc(s.handleRing), s.adminAccess))
+	mux.Handle("/admin/ring/explain", auth.Middleware(http.HandlerFunc(s.handleRingExplain), s.adminAccess))
+
+	tlsConfig, _, err := s.tls.configs()
+	if err != nil {
+		return fmt.Errorf("invalid API TLS config: %w", err)
+	}
 	s.srv = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 
 	// Start server in a goroutine
@@ -157,7 +219,7 @@ func (s *APIServer) Start(addr string) error {
 	go func() {
 		defer s.wg.Done()
 		logger.LogrusObj.Infof("API server is running at %v", addr)
-		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listenAndServe(s.srv); err != nil && err != http.ErrServerClosed {
 			logger.LogrusObj.Errorf("API server error: %v", err)
 		}
 	}()
@@ -203,6 +265,25 @@ func (s *APIServer) handleSignals() {
 	}()
 }
 
+// apiAccess returns the access an /api request needs: reading the server's group.
+func (s *APIServer) apiAccess(r *http.Request) (string, Access) {
+	return s.cache.name, AccessRead
+}
+
+// adminAccess returns the access an admin request needs to the group chosen
+// by the group parameter, the server's group by default: write to change it
+// with POST, read otherwise.
+func (s *APIServer) adminAccess(r *http.Request) (string, Access) {
+	group := s.cache.name
+	if name := r.URL.Query().Get("group"); name != "" {
+		group = name
+	}
+	if r.Method == http.MethodPost {
+		return group, AccessWrite
+	}
+	return group, AccessRead
+}
+
 // handleAPIRequest handles the API requests
 func (s *APIServer) handleAPIRequest(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("key")
@@ -222,3 +303,160 @@ func (s *APIServer) handleAPIRequest(w http.ResponseWriter, r *http.Request) {
 		logger.LogrusObj.Errorf("failed to write response: %v", err)
 	}
 }
+
+// handleStrategy reports the eviction strategy of a group on GET and switches
+// it on POST. The group defaults to the server's group and can be chosen with
+// the group parameter; the new strategy is given by the strategy parameter.
+func (s *APIServer) handleStrategy(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		strategy := r.URL.Query().Get("strategy")
+		if strategy == "" {
+			http.Error(w, "missing strategy parameter", http.StatusBadRequest)
+			return
+		}
+		if err := g.SetStrategy(strategy); err != nil {
+			http.Error(w, fmt.Sprintf("failed to switch strategy: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := fmt.Fprintf(w, "%s\n", g.Strategy()); err != nil {
+		logger.LogrusObj.Errorf("failed to write response: %v", err)
+	}
+}
+
+// handleShadows reports the estimates of a group's shadow caches as JSON.
+// The group defaults to the server's group and can be chosen with the group parameter.
+func (s *APIServer) handleShadows(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	stats := g.ShadowStats()
+	if stats == nil {
+		http.Error(w, "shadow caches are disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.LogrusObj.Errorf("failed to write response: %v", err)
+	}
+}
+
+// handleBreakers reports the circuit breakers guarding the peers of a group as JSON.
+// The group defaults to the server's group and can be chosen with the group parameter.
+func (s *APIServer) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.groupParam(w, r)
+	if !ok {
+		return
+	}
+
+	stats := g.PeerBreakers()
+	if stats == nil {
+		http.Error(w, "circuit breakers are disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.LogrusObj.Errorf("failed to write response: %v", err)
+	}
+}
+
+// RingInfo is the JSON body of /admin/ring.
+type RingInfo struct {
+	Nodes        []NodeOwnership `json:"nodes"`
+	VirtualNodes []VirtualNode   `json:"virtualNodes,omitempty"`
+}
+
+// handleRing reports the ownership of a group's hash ring per node as JSON,
+// and its virtual nodes in clockwise order if the vnodes parameter is true.
+// The group defaults to the server's group and can be chosen with the group parameter.
+func (s *APIServer) handleRing(w http.ResponseWriter, r *http.Request) {
+	ring, ok := s.groupRing(w, r)
+	if !ok {
+		return
+	}
+
+	info := RingInfo{Nodes: ring.Ownership()}
+	if vnodes, _ := strconv.ParseBool(r.URL.Query().Get("vnodes")); vnodes {
+		info.VirtualNodes = ring.Ring()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.LogrusObj.Errorf("failed to write response: %v", err)
+	}
+}
+
+// handleRingExplain reports where the key parameter lands on a group's hash
+// ring as JSON. The group defaults to the server's group and can be chosen
+// with the group parameter.
+func (s *APIServer) handleRingExplain(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	ring, ok := s.groupRing(w, r)
+	if !ok {
+		return
+	}
+
+	placement, ok := ring.Explain(key)
+	if !ok {
+		http.Error(w, "hash ring is empty", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(placement); err != nil {
+		logger.LogrusObj.Errorf("failed to write response: %v", err)
+	}
+}
+
+// groupRing returns the hash ring of the group chosen by the group parameter,
+// or writes an error response and returns false.
+func (s *APIServer) groupRing(w http.ResponseWriter, r *http.Request) (*ConsistentMap, bool) {
+	g, ok := s.groupParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	ring, err := g.Ring()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return ring, true
+}
+
+// groupParam returns the group chosen by the group parameter, the server's
+// group by default, or writes an error response and returns false.
+func (s *APIServer) groupParam(w http.ResponseWriter, r *http.Request) (*Group, bool) {
+	name := r.URL.Query().Get("group")
+	if name == "" {
+		return s.cache, true
+	}
+	g := GetGroup(name)
+	if g == nil {
+		http.Error(w, fmt.Sprintf("group %s not found", name), http.StatusNotFound)
+		return nil, false
+	}
+	return g, true
+}
@@ -1,15 +1,19 @@
 package cache
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
 
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
 	"github.com/1055373165/ggcache/pkg/common/logger"
+	"google.golang.org/protobuf/proto"
 )
 
-var _ Picker = (*HTTPPool)(nil)
+var _ ReplicaPicker = (*HTTPPool)(nil)
 
 const (
 	defaultBasePath = "/_ggcache/"
@@ -21,8 +25,15 @@ const (
 type HTTPPool struct {
 	currentServer string
 	basePath      string
-	peerSelector  *ConsistentMap
+	placement     string    // name of the placement algorithm, DefaultPlacement if empty
+	loadBound     float64   // load bound factor ε of placements that support it, 0 disables it
+	peers         []string  // peers the placement was built from
+	peerSelector  Placement // decides which peer owns each key
 	fetcherMap    map[string]*httpFetcher
+	clientCfg     ClientConfig // configuration of the fetchers
+	client        *http.Client // shared by the fetchers
+	serverTLS     *tls.Config  // TLS of the served requests, nil for plaintext
+	breakers      *breakerSet  // circuit breakers of the peers, nil disables them
 	mu            sync.Mutex
 }
 
@@ -31,9 +42,13 @@ func NewHTTPPool(srvAddr string) *HTTPPool {
 	return &HTTPPool{
 		currentServer: srvAddr,
 		basePath:      defaultBasePath,
+		clientCfg:     DefaultClientConfig,
+		client:        DefaultClientConfig.httpClient(),
 	}
 }
 
+// ServeHTTP answers the requests of peers for the keys of a group: a GET with
+// a pb.GetResponse, and a PUT carrying a pb.SetRequest by storing its value.
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		http.Error(w, "invalid cache endpoint", http.StatusBadRequest)
@@ -55,16 +70,44 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
+	p.mu.Lock()
+	maxMessageSize := p.clientCfg.MaxMessageSize
+	p.mu.Unlock()
+
+	if r.Method == http.MethodPut {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxMessageSize)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		req := &pb.SetRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, req.GetValue())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp, err := getResponse(group, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := proto.Marshal(resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if len(body) > maxMessageSize {
+		http.Error(w, fmt.Sprintf("response body larger than %d bytes", maxMessageSize), http.StatusInternalServerError)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	if _, err := w.Write(view.Bytes()); err != nil {
+	w.Header().Set("Content-Type", protobufContentType)
+	if _, err := w.Write(body); err != nil {
 		logger.LogrusObj.Errorf("Failed to write response: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
@@ -75,19 +118,71 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 
 // Pick implements the Picker interface.
 // It selects a peer based on the given key and returns the corresponding HTTP client.
+// Keys of a peer ejected by its circuit breaker are handled locally.
 func (p *HTTPPool) Pick(key string) (Fetcher, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	peerAddress := p.peerSelector.GetNode(key)
+	peerAddress, release := pick(p.peerSelector, key)
 	if peerAddress == p.currentServer {
 		// upper layer get the value of the key locally after receiving false
+		release()
+		return nil, false
+	}
+
+	b := p.breakers.get(peerAddress)
+	if !b.available() {
+		release()
+		logger.LogrusObj.Debugf("peer %s is ejected, handling key %s locally", peerAddress, key)
 		return nil, false
 	}
 
 	logger.LogrusObj.Infof("[request forward by peer %s], pick remote peer: %s", p.currentServer, peerAddress)
 
-	return p.fetcherMap[peerAddress], true
+	return releasingFetcher{Fetcher: b.wrap(p.fetcherMap[peerAddress]), release: release}, true
+}
+
+// PickReplicas implements the ReplicaPicker interface.
+// It returns the HTTP clients of the peers holding the first n replicas of
+// key, with nil standing for the current node. Peers ejected by their
+// circuit breaker are left out.
+func (p *HTTPPool) PickReplicas(key string, n int) []Fetcher {
+	return p.replicas(key, n, false)
+}
+
+// pickWriteReplicas is like PickReplicas but keeps ejected peers, whose
+// breakers fail the writes to them.
+func (p *HTTPPool) pickWriteReplicas(key string, n int) []Fetcher {
+	return p.replicas(key, n, true)
+}
+
+// replicas returns the HTTP clients of the peers holding the first n
+// replicas of key, leaving out ejected peers unless withEjected is set.
+func (p *HTTPPool) replicas(key string, n int, withEjected bool) []Fetcher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peerSelector == nil {
+		return nil
+	}
+
+	peerAddresses := p.peerSelector.GetNodes(key, n)
+	fetchers := make([]Fetcher, 0, len(peerAddresses))
+	for _, peerAddress := range peerAddresses {
+		if peerAddress == p.currentServer {
+			fetchers = append(fetchers, nil)
+		} else if b := p.breakers.get(peerAddress); withEjected || b.available() {
+			fetchers = append(fetchers, b.wrap(p.fetcherMap[peerAddress]))
+		}
+	}
+	return fetchers
+}
+
+// currentPlacement returns the placement of the peers.
+func (p *HTTPPool) currentPlacement() Placement {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peerSelector
 }
 
 // UpdatePeers updates the peer list and rebuilds the consistent hash ring.
@@ -95,13 +190,126 @@ func (p *HTTPPool) UpdatePeers(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.peerSelector = NewConsistentHash(defaultReplicas, nil)
-	p.peerSelector.AddNodes(peers...)
-	p.fetcherMap = make(map[string]*httpFetcher, len(peers))
+	p.peers = peers
+	p.peerSelector = buildPlacement(p.placement, p.loadBound, defaultWeights(peers))
+	p.breakers.retain(defaultWeights(peers))
+	p.buildFetchers()
+}
 
-	for _, peer := range peers {
-		p.fetcherMap[peer] = &httpFetcher{
-			baseURL: peer + p.basePath, // such "http://10.0.0.1:9999/_ggcache/"
+// buildFetchers creates the fetchers of the peers.
+// Caller must hold the lock.
+func (p *HTTPPool) buildFetchers() {
+	p.fetcherMap = make(map[string]*httpFetcher, len(p.peers))
+	for _, peer := range p.peers {
+		// such "http://10.0.0.1:9999/_ggcache/"
+		baseURL := peer + p.basePath
+		if p.clientCfg.TLS != nil {
+			baseURL = "https://" + strings.TrimPrefix(baseURL, "http://")
 		}
+		p.fetcherMap[peer] = newHTTPFetcher(baseURL, p.client, p.clientCfg)
 	}
 }
+
+// SetClientConfig configures the requests to the peers and the largest value
+// accepted from them, and rebuilds the fetchers of the current peers.
+// Zero fields take the value of DefaultClientConfig.
+func (p *HTTPPool) SetClientConfig(cfg ClientConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cfg.TLS == nil {
+		cfg.TLS = p.clientCfg.TLS
+	}
+	if cfg.Auth == nil {
+		cfg.Auth = p.clientCfg.Auth
+	}
+	p.clientCfg = cfg.withDefaults()
+	p.client = p.clientCfg.httpClient()
+	p.buildFetchers()
+}
+
+// SetTLSConfig sends the requests to the peers over HTTPS, with a client
+// certificate if cfg.ClientAuth is set, and rebuilds the fetchers of the
+// current peers. The server serving the pool gets the server side from
+// serverTLSConfig. A disabled cfg keeps plain HTTP.
+func (p *HTTPPool) SetTLSConfig(cfg TLSConfig) error {
+	server, client, err := cfg.configs()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.serverTLS = server
+	p.clientCfg.TLS = client
+	p.client = p.clientCfg.httpClient()
+	p.buildFetchers()
+	return nil
+}
+
+// SetAuth signs the requests to the peers with a if it authenticates peers,
+// and rebuilds the fetchers of the current peers. The server serving the pool
+// enforces a with a.Middleware and access.
+func (p *HTTPPool) SetAuth(a *Auth) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clientCfg.Auth = a
+	p.buildFetchers()
+}
+
+// SetBreaker guards the requests to each peer with a circuit breaker that
+// ejects the peer from routing while it keeps failing, so that its keys are
+// loaded locally without waiting for it. It replaces the current breakers,
+// closed; a disabled cfg routes to every peer.
+func (p *HTTPPool) SetBreaker(cfg BreakerConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakers = newBreakerSet(cfg)
+}
+
+// breakerStats returns the state of the circuit breakers of the peers, nil if they are disabled.
+func (p *HTTPPool) breakerStats() []BreakerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.breakers.stats()
+}
+
+// access returns the group a request to the pool accesses and the access it
+// needs: write to set a key, read otherwise.
+func (p *HTTPPool) access(r *http.Request) (string, Access) {
+	group, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, p.basePath), "/")
+	if r.Method == http.MethodPut {
+		return group, AccessWrite
+	}
+	return group, AccessRead
+}
+
+// serverTLSConfig returns the TLS configuration to serve the pool with, nil for plain HTTP.
+func (p *HTTPPool) serverTLSConfig() *tls.Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.serverTLS
+}
+
+// SetPlacement selects the algorithm that decides which peer owns each key:
+// "ring", "rendezvous", "jump" or "maglev", and rebuilds it from the current peers.
+func (p *HTTPPool) SetPlacement(name string) error {
+	if _, err := NewPlacement(name); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.placement = name
+	p.peerSelector = buildPlacement(p.placement, p.loadBound, defaultWeights(p.peers))
+	return nil
+}
+
+// SetLoadBound caps the in-flight requests forwarded to each peer at
+// (1+epsilon) times the average if the placement supports it, and rebuilds
+// the placement from the current peers. A non-positive epsilon disables the bound.
+func (p *HTTPPool) SetLoadBound(epsilon float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loadBound = epsilon
+	p.peerSelector = buildPlacement(p.placement, p.loadBound, defaultWeights(p.peers))
+}
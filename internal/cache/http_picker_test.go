@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"gorm.io/gorm"
+)
+
+func TestHTTPPool_ServeHTTP(t *testing.T) {
+	NewGroupWithConfig("http-pool", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU, TTL: time.Minute},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, gorm.ErrRecordNotFound
+			}
+			return []byte("db-" + key), nil
+		}))
+	t.Cleanup(func() { DestroyGroup("http-pool") })
+
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	cfg := DefaultClientConfig
+	f := newHTTPFetcher(srv.URL+defaultBasePath, cfg.httpClient(), cfg)
+
+	start := time.Now()
+	view, err := f.fetchView("http-pool", "k")
+	if err != nil {
+		t.Fatalf("fetchView returned error: %v", err)
+	}
+	if view.String() != "db-k" {
+		t.Errorf("fetchView = %q, want %q", view.String(), "db-k")
+	}
+	// The second fetch hits the cache, whose TTL is reported.
+	if view, err = f.fetchView("http-pool", "k"); err != nil {
+		t.Fatalf("fetchView of a cached key returned error: %v", err)
+	}
+	if exp := view.ExpireAt(); exp.Before(start.Add(time.Minute)) || exp.After(time.Now().Add(time.Minute)) {
+		t.Errorf("expiration time = %v, want a minute after the entry was last used", exp)
+	}
+
+	if _, err := f.fetchView("http-pool", "missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("fetchView of a missing key = %v, want gorm.ErrRecordNotFound", err)
+	}
+
+	if err := f.Set("http-pool", "k", []byte("set")); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if value, err := f.Fetch("http-pool", "k"); err != nil || string(value) != "set" {
+		t.Errorf("Fetch after Set = %q, %v, want %q", value, err, "set")
+	}
+}
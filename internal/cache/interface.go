@@ -8,6 +8,23 @@ type Picker interface {
 	Pick(key string) (Fetcher, bool)
 }
 
+// ReplicaPicker is implemented by Pickers that place each key on several peers.
+type ReplicaPicker interface {
+	Picker
+	// PickReplicas returns the fetchers for the peers holding the first n
+	// replicas of key, the one Pick would return first. A nil fetcher stands
+	// for the current node.
+	PickReplicas(key string, n int) []Fetcher
+}
+
+// writeReplicaPicker is implemented by ReplicaPickers that leave unavailable
+// peers out of PickReplicas but must still report them as failed writes.
+type writeReplicaPicker interface {
+	// pickWriteReplicas returns every replica PickReplicas would without
+	// leaving any out.
+	pickWriteReplicas(key string, n int) []Fetcher
+}
+
 // Fetcher is the interface that wraps the basic Fetch method.
 // Each distributed node must implement this interface to support peer-to-peer cache retrieval.
 type Fetcher interface {
@@ -16,6 +33,21 @@ type Fetcher interface {
 	Fetch(group string, key string) ([]byte, error)
 }
 
+// Setter is implemented by Fetchers that can also store values on their peer.
+type Setter interface {
+	// Set stores value for key in the specified group's cache on the peer only,
+	// without forwarding it to other replicas.
+	Set(group string, key string, value []byte) error
+}
+
+// viewFetcher is implemented by Fetchers whose peer also reports when the
+// value expires and whether the key does not exist.
+type viewFetcher interface {
+	// fetchView retrieves the value for key from the specified group's cache.
+	// A key that does not exist yields an error wrapping gorm.ErrRecordNotFound.
+	fetchView(group string, key string) (ByteView, error)
+}
+
 // Retriever is the interface that wraps the basic retrieve method.
 // It provides the ability to fetch data from a backing store when cache misses occur.
 type Retriever interface {
@@ -0,0 +1,151 @@
+package cache
+
+import "sync"
+
+// JumpHash implements jump consistent hashing (Lamping and Veach), which maps
+// a key to one of n numbered buckets with no table at all and a near perfect
+// spread. Going from n to n+1 buckets moves only 1/(n+1) of the keys, but
+// buckets can only be added or removed at the end.
+//
+// Buckets are the nodes in sorted order, the weights being scaled to about
+// jumpBuckets buckets in all and a node taking its share rounded to at least
+// one, so keys follow the weights up to that rounding whatever they add up
+// to. Adding or removing a node rescales the shares and renumbers the buckets
+// after it, and moves more keys than the other placements do.
+type JumpHash struct {
+	mu      sync.RWMutex
+	weights nodeWeights
+	nodes   []string // sorted nodes
+	buckets []string
+}
+
+// jumpBuckets is the number of buckets the weights are scaled to.
+const jumpBuckets = 1024
+
+// jumpReplicaRounds bounds the rehashes per replica GetNodes makes before
+// taking the remaining replicas in sorted order.
+const jumpReplicaRounds = 32
+
+// NewJumpHash creates an empty jump hash placement.
+func NewJumpHash() *JumpHash {
+	return &JumpHash{weights: make(nodeWeights)}
+}
+
+// AddNodes adds nodes with DefaultWeight.
+func (j *JumpHash) AddNodes(nodes ...string) {
+	j.AddWeightedNodes(defaultWeights(nodes))
+}
+
+// AddWeightedNodes adds nodes that receive keys in proportion to their weight.
+func (j *JumpHash) AddWeightedNodes(weights map[string]int) {
+	if len(weights) == 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.weights.add(weights)
+	j.rebuild()
+}
+
+// RemoveNode removes a node from the placement.
+func (j *JumpHash) RemoveNode(node string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.weights[node]; !ok {
+		return
+	}
+	delete(j.weights, node)
+	j.rebuild()
+}
+
+// clone returns a copy of the placement.
+func (j *JumpHash) clone() Placement {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return &JumpHash{
+		weights: j.weights.copy(),
+		nodes:   append([]string(nil), j.nodes...),
+		buckets: append([]string(nil), j.buckets...),
+	}
+}
+
+// rebuild assigns the buckets to the nodes.
+// Caller must hold the lock.
+func (j *JumpHash) rebuild() {
+	j.buckets = j.buckets[:0]
+	j.nodes = j.weights.sorted()
+	total := 0
+	for _, weight := range j.weights {
+		total += weight
+	}
+	for _, node := range j.nodes {
+		n := max(1, (j.weights[node]*jumpBuckets+total/2)/total)
+		for i := 0; i < n; i++ {
+			j.buckets = append(j.buckets, node)
+		}
+	}
+}
+
+// GetNode returns the node owning the bucket key jumps to.
+func (j *JumpHash) GetNode(key string) string {
+	if key == "" || j == nil {
+		return ""
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jump(hash64(key), len(j.buckets))]
+}
+
+// GetNodes returns the owner of key followed by the owners of the buckets
+// the key jumps to when rehashed, skipping nodes already returned, so the
+// replicas too are drawn in proportion to the weights.
+func (j *JumpHash) GetNodes(key string, n int) []string {
+	if key == "" || j == nil || n <= 0 {
+		return nil
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if len(j.buckets) == 0 {
+		return nil
+	}
+
+	n = min(n, len(j.weights))
+	nodes := make([]string, 0, n)
+	h := hash64(key)
+	for i := 0; i < n*jumpReplicaRounds && len(nodes) < n; i++ {
+		if node := j.buckets[jump(h, len(j.buckets))]; !containsString(nodes, node) {
+			nodes = append(nodes, node)
+		}
+		h = mix64(h + 0x9e3779b97f4a7c15)
+	}
+	// Nodes with a small share may be missed; fill up in sorted order.
+	for _, node := range j.nodes {
+		if len(nodes) == n {
+			break
+		}
+		if !containsString(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// jump returns the bucket in [0, n) of the key with the given hash.
+func jump(key uint64, n int) int {
+	var b, next int64 = -1, 0
+	for next < int64(n) {
+		b = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,155 @@
+package cache
+
+import "sync"
+
+// defaultMaglevSize is the size of the Maglev lookup table. It must be a
+// prime, and much larger than the number of nodes for an even spread.
+const defaultMaglevSize = 65537
+
+// Maglev implements Maglev hashing (Eisenbud et al.), which fills a lookup
+// table by letting nodes take turns claiming the next free entry of their
+// own permutation of the table. Lookups are a single table access, the
+// spread is within a few percent of perfect, and a node change moves little
+// more than the keys of the node added or removed.
+//
+// A node of weight w claims w entries per round, so it owns about that
+// share of the table.
+type Maglev struct {
+	mu      sync.RWMutex
+	size    uint64
+	weights nodeWeights
+	nodes   []string // sorted by name
+	table   []int32  // index into nodes for each entry
+}
+
+// NewMaglev creates an empty Maglev placement with a lookup table of size
+// entries, which should be a prime.
+func NewMaglev(size int) *Maglev {
+	if size < 2 {
+		size = defaultMaglevSize
+	}
+	return &Maglev{size: uint64(size), weights: make(nodeWeights)}
+}
+
+// AddNodes adds nodes with DefaultWeight.
+func (m *Maglev) AddNodes(nodes ...string) {
+	m.AddWeightedNodes(defaultWeights(nodes))
+}
+
+// AddWeightedNodes adds nodes that receive keys in proportion to their weight.
+func (m *Maglev) AddWeightedNodes(weights map[string]int) {
+	if len(weights) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.weights.add(weights)
+	m.rebuild()
+}
+
+// RemoveNode removes a node from the placement.
+func (m *Maglev) RemoveNode(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.weights[node]; !ok {
+		return
+	}
+	delete(m.weights, node)
+	m.rebuild()
+}
+
+// clone returns a copy of the placement.
+func (m *Maglev) clone() Placement {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return &Maglev{
+		size:    m.size,
+		weights: m.weights.copy(),
+		nodes:   append([]string(nil), m.nodes...),
+		table:   append([]int32(nil), m.table...),
+	}
+}
+
+// rebuild fills the lookup table from the current nodes.
+// Caller must hold the lock.
+func (m *Maglev) rebuild() {
+	m.nodes = m.weights.sorted()
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+
+	// Each node walks its own permutation of the table: offset, offset+skip, ...
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		h := hash64(node)
+		offsets[i] = (h >> 32) % m.size
+		skips[i] = (h&0xffffffff)%(m.size-1) + 1
+	}
+
+	table := make([]int32, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := uint64(0); ; {
+		for i, node := range m.nodes {
+			for turn := 0; turn < m.weights[node]; turn++ {
+				entry := (offsets[i] + next[i]*skips[i]) % m.size
+				for table[entry] >= 0 {
+					next[i]++
+					entry = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[entry] = int32(i)
+				next[i]++
+				if filled++; filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+// GetNode returns the node owning the table entry of key.
+func (m *Maglev) GetNode(key string) string {
+	if key == "" || m == nil {
+		return ""
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[hash64(key)%m.size]]
+}
+
+// GetNodes returns the owner of the table entry of key followed by the
+// owners of the next entries, skipping nodes already returned.
+func (m *Maglev) GetNodes(key string, n int) []string {
+	if key == "" || m == nil || n <= 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0 {
+		return nil
+	}
+
+	n = min(n, len(m.nodes))
+	nodes := make([]string, 0, n)
+	entry := hash64(key) % m.size
+	for i := uint64(0); i < m.size && len(nodes) < n; i++ {
+		if node := m.nodes[m.table[(entry+i)%m.size]]; !containsString(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
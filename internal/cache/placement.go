@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+var (
+	_ Placement = (*ConsistentMap)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*JumpHash)(nil)
+	_ Placement = (*Maglev)(nil)
+
+	_ loadBounded = (*ConsistentMap)(nil)
+
+	_ cloner = (*ConsistentMap)(nil)
+	_ cloner = (*Rendezvous)(nil)
+	_ cloner = (*JumpHash)(nil)
+	_ cloner = (*Maglev)(nil)
+
+	_ placer = (*Server)(nil)
+	_ placer = (*HTTPPool)(nil)
+
+	_ Setter      = releasingFetcher{}
+	_ viewFetcher = releasingFetcher{}
+)
+
+// Placement decides which node owns each key.
+//
+// Every peer builds its own placement from the nodes it discovers, so an
+// implementation must map keys the same way regardless of the order in
+// which nodes are added.
+type Placement interface {
+	// AddNodes adds nodes with DefaultWeight.
+	AddNodes(nodes ...string)
+	// AddWeightedNodes adds nodes that receive keys in proportion to their weight.
+	// Nodes with a non-positive weight get DefaultWeight.
+	AddWeightedNodes(weights map[string]int)
+	// RemoveNode removes a node. Removing an unknown node is a no-op.
+	RemoveNode(node string)
+	// GetNode returns the node that owns key, or "" if there are no nodes.
+	GetNode(key string) string
+	// GetNodes returns up to n distinct nodes that hold the replicas of key,
+	// the owner returned by GetNode first. It returns fewer than n nodes
+	// only if the placement holds fewer.
+	GetNodes(key string, n int) []string
+}
+
+// placer is implemented by Pickers that place keys with a Placement.
+type placer interface {
+	// currentPlacement returns the placement in use, or nil if there is none yet.
+	currentPlacement() Placement
+}
+
+// cloner is implemented by placements that can be copied, so that the
+// ownership of keys before a change can still be looked up after it.
+type cloner interface {
+	clone() Placement
+}
+
+// clonePlacement returns a copy of p that later changes to p do not affect,
+// or nil if p cannot be copied.
+func clonePlacement(p Placement) Placement {
+	if c, ok := p.(cloner); ok {
+		return c.clone()
+	}
+	return nil
+}
+
+// loadBounded is implemented by placements that can bound the in-flight load of each node.
+type loadBounded interface {
+	SetLoadBound(epsilon float64)
+	Acquire(key string) string
+	Release(node string)
+}
+
+// DefaultPlacement is the placement used when none is configured.
+const DefaultPlacement = "ring"
+
+// placements maps placement names to their constructors.
+var placements = map[string]func() Placement{
+	"ring":       func() Placement { return NewConsistentHash(defaultReplicas, nil) },
+	"rendezvous": func() Placement { return NewRendezvous() },
+	"jump":       func() Placement { return NewJumpHash() },
+	"maglev":     func() Placement { return NewMaglev(defaultMaglevSize) },
+}
+
+// NewPlacement returns an empty placement of the named algorithm:
+// "ring", "rendezvous", "jump" or "maglev". An empty name selects DefaultPlacement.
+func NewPlacement(name string) (Placement, error) {
+	if name == "" {
+		name = DefaultPlacement
+	}
+	newPlacement, ok := placements[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid placement: %s", name)
+	}
+	return newPlacement(), nil
+}
+
+// buildPlacement returns a placement of the named algorithm holding the
+// given nodes, with the load bound applied if the algorithm supports one.
+// An invalid name selects DefaultPlacement.
+func buildPlacement(name string, epsilon float64, weights map[string]int) Placement {
+	p, err := NewPlacement(name)
+	if err != nil {
+		p, _ = NewPlacement(DefaultPlacement)
+	}
+	if lb, ok := p.(loadBounded); ok {
+		lb.SetLoadBound(epsilon)
+	}
+	p.AddWeightedNodes(weights)
+	return p
+}
+
+// pick returns the node for key, or "" if p is nil or empty. If p bounds
+// loads, the request counts as in flight on that node until release is called.
+func pick(p Placement, key string) (node string, release func()) {
+	if p == nil {
+		return "", func() {}
+	}
+	lb, ok := p.(loadBounded)
+	if !ok {
+		return p.GetNode(key), func() {}
+	}
+	node = lb.Acquire(key)
+	if node == "" {
+		return "", func() {}
+	}
+	return node, func() { lb.Release(node) }
+}
+
+// releasingFetcher ends the in-flight request counted for a peer once its fetch returns.
+type releasingFetcher struct {
+	Fetcher
+	release func()
+}
+
+// Fetch fetches from the peer and then releases the request.
+func (f releasingFetcher) Fetch(group string, key string) ([]byte, error) {
+	defer f.release()
+	return f.Fetcher.Fetch(group, key)
+}
+
+// Set stores the value on the peer and then releases the request.
+func (f releasingFetcher) Set(group string, key string, value []byte) error {
+	defer f.release()
+	setter, ok := f.Fetcher.(Setter)
+	if !ok {
+		return fmt.Errorf("peer does not support set")
+	}
+	return setter.Set(group, key, value)
+}
+
+// fetchView fetches from the peer with the expiration time if it reports it,
+// and then releases the request.
+func (f releasingFetcher) fetchView(group string, key string) (ByteView, error) {
+	defer f.release()
+	vf, ok := f.Fetcher.(viewFetcher)
+	if !ok {
+		b, err := f.Fetcher.Fetch(group, key)
+		return ByteView{b: b}, err
+	}
+	return vf.fetchView(group, key)
+}
+
+// PlacementNames returns the names of all placement algorithms in sorted order.
+func PlacementNames() []string {
+	names := make([]string, 0, len(placements))
+	for name := range placements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hash64 returns a 64-bit FNV-1a hash of s passed through the murmur3
+// finalizer, so that similar strings give unrelated hashes.
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix64(h.Sum64())
+}
+
+// mix64 is the murmur3 64-bit finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// nodeWeights holds the nodes of a placement and their weights.
+type nodeWeights map[string]int
+
+// copy returns a copy of the weights.
+func (w nodeWeights) copy() nodeWeights {
+	c := make(nodeWeights, len(w))
+	for node, weight := range w {
+		c[node] = weight
+	}
+	return c
+}
+
+// add records the nodes with their weights, defaulting non-positive weights.
+func (w nodeWeights) add(weights map[string]int) {
+	for node, weight := range weights {
+		if weight <= 0 {
+			weight = DefaultWeight
+		}
+		w[node] = weight
+	}
+}
+
+// sorted returns the nodes in sorted order, the order every peer agrees on.
+func (w nodeWeights) sorted() []string {
+	nodes := make([]string, 0, len(w))
+	for node := range w {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// defaultWeights assigns DefaultWeight to every node.
+func defaultWeights(nodes []string) map[string]int {
+	weights := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		weights[node] = DefaultWeight
+	}
+	return weights
+}
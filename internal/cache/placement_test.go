@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// placementKeys returns n distinct keys.
+func placementKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+// placementNodes returns n node addresses.
+func placementNodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("10.0.0.%d:9999", i+1)
+	}
+	return nodes
+}
+
+// spread returns the largest number of keys owned by a node divided by the mean.
+func spread(p Placement, keys []string, nodes int) float64 {
+	counts := make(map[string]int)
+	for _, key := range keys {
+		counts[p.GetNode(key)]++
+	}
+	most := 0
+	for _, c := range counts {
+		most = max(most, c)
+	}
+	return float64(most) / (float64(len(keys)) / float64(nodes))
+}
+
+// moved returns the fraction of keys owned by a different node in a and b.
+func moved(a, b Placement, keys []string) float64 {
+	n := 0
+	for _, key := range keys {
+		if a.GetNode(key) != b.GetNode(key) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(keys))
+}
+
+func TestNewPlacement(t *testing.T) {
+	for _, name := range append(PlacementNames(), "") {
+		if _, err := NewPlacement(name); err != nil {
+			t.Errorf("NewPlacement(%q) returned error: %v", name, err)
+		}
+	}
+	if _, err := NewPlacement("unknown"); err == nil {
+		t.Error("NewPlacement with an unknown name should fail")
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	keys := placementKeys(20000)
+	nodes := placementNodes(5)
+
+	for _, name := range PlacementNames() {
+		t.Run(name, func(t *testing.T) {
+			p, _ := NewPlacement(name)
+			if got := p.GetNode("key"); got != "" {
+				t.Errorf("GetNode on an empty placement = %q, want empty string", got)
+			}
+
+			p.AddNodes(nodes...)
+			if got := p.GetNode(""); got != "" {
+				t.Errorf("GetNode(\"\") = %q, want empty string", got)
+			}
+
+			// The order nodes are added in does not matter.
+			reversed, _ := NewPlacement(name)
+			for i := len(nodes) - 1; i >= 0; i-- {
+				reversed.AddNodes(nodes[i])
+			}
+			if m := moved(p, reversed, keys); m != 0 {
+				t.Errorf("%.2f%% of keys differ when nodes are added in reverse order", m*100)
+			}
+
+			// Removing a node leaves no key on it, and adding it back restores the placement.
+			removed, _ := NewPlacement(name)
+			removed.AddNodes(nodes...)
+			removed.RemoveNode(nodes[2])
+			removed.RemoveNode("unknown")
+			for _, key := range keys {
+				if removed.GetNode(key) == nodes[2] {
+					t.Fatalf("key %s is still placed on the removed node", key)
+				}
+			}
+			removed.AddNodes(nodes[2])
+			if m := moved(p, removed, keys); m != 0 {
+				t.Errorf("%.2f%% of keys differ after removing and adding back a node", m*100)
+			}
+
+			// GetNodes returns distinct nodes, the owner first, and never more than there are.
+			for _, key := range keys[:1000] {
+				replicas := p.GetNodes(key, 3)
+				if len(replicas) != 3 || replicas[0] != p.GetNode(key) {
+					t.Fatalf("GetNodes(%s, 3) = %v, want 3 nodes starting with %s", key, replicas, p.GetNode(key))
+				}
+				if replicas[0] == replicas[1] || replicas[1] == replicas[2] || replicas[0] == replicas[2] {
+					t.Fatalf("GetNodes(%s, 3) = %v, want distinct nodes", key, replicas)
+				}
+			}
+			if got := p.GetNodes("key", 10); len(got) != len(nodes) {
+				t.Errorf("GetNodes(key, 10) returned %d nodes, want %d", len(got), len(nodes))
+			}
+
+			// A node of three times the default weight gets about three times the keys.
+			weighted, _ := NewPlacement(name)
+			weighted.AddWeightedNodes(map[string]int{nodes[0]: DefaultWeight, nodes[1]: 3 * DefaultWeight})
+			counts := make(map[string]int)
+			for _, key := range keys {
+				counts[weighted.GetNode(key)]++
+			}
+			if ratio := float64(counts[nodes[1]]) / float64(counts[nodes[0]]); math.Abs(ratio-3) > 1 {
+				t.Errorf("heavy node got %.2f times the keys of the light node, want about 3", ratio)
+			}
+		})
+	}
+}
+
+// BenchmarkPlacement reports, for each placement and number of nodes, the
+// load spread (the busiest node's share of keys over the mean, 1 is perfect),
+// the percentage of keys that move when a node is added (the ideal is
+// 100/(nodes+1)) and when one is removed (the ideal is 100/nodes), and the
+// cost of a lookup.
+func BenchmarkPlacement(b *testing.B) {
+	keys := placementKeys(100000)
+	for _, name := range PlacementNames() {
+		for _, n := range []int{3, 10, 50} {
+			nodes := placementNodes(n + 1)
+			p, _ := NewPlacement(name)
+			p.AddNodes(nodes[:n]...)
+			added, _ := NewPlacement(name)
+			added.AddNodes(nodes...)
+			removed, _ := NewPlacement(name)
+			removed.AddNodes(nodes[:n]...)
+			removed.RemoveNode(nodes[n/2])
+
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.GetNode(keys[i%len(keys)])
+				}
+				b.StopTimer()
+				b.ReportMetric(spread(p, keys, n), "spread")
+				b.ReportMetric(moved(p, added, keys)*100, "%moved-add")
+				b.ReportMetric(moved(p, removed, keys)*100, "%moved-remove")
+			})
+		}
+	}
+}
+
+func TestClonePlacement(t *testing.T) {
+	keys := placementKeys(5000)
+	nodes := placementNodes(4)
+
+	for _, name := range PlacementNames() {
+		t.Run(name, func(t *testing.T) {
+			p, _ := NewPlacement(name)
+			p.AddNodes(nodes[:3]...)
+			c := clonePlacement(p)
+			if c == nil {
+				t.Fatal("clonePlacement returned nil")
+			}
+			if m := moved(p, c, keys); m != 0 {
+				t.Errorf("%.2f%% of keys differ in the copy", m*100)
+			}
+
+			// Changes to the original do not reach the copy.
+			before := make([]string, len(keys))
+			for i, key := range keys {
+				before[i] = c.GetNode(key)
+			}
+			p.AddNodes(nodes[3])
+			p.RemoveNode(nodes[0])
+			for i, key := range keys {
+				if got := c.GetNode(key); got != before[i] {
+					t.Fatalf("copy places %s on %s after changing the original, want %s", key, got, before[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJumpHash_Weights(t *testing.T) {
+	// Weights are scaled to jumpBuckets buckets whatever they add up to.
+	j := NewJumpHash()
+	j.AddWeightedNodes(map[string]int{"a": 10000019, "b": 10000019, "c": 1})
+	counts := make(map[string]int)
+	for _, node := range j.buckets {
+		counts[node]++
+	}
+	if counts["a"] != 512 || counts["b"] != 512 || counts["c"] != 1 {
+		t.Errorf("buckets per node = %v, want a:512 b:512 c:1", counts)
+	}
+
+	// Replicas follow the weights too rather than the next sorted node.
+	j = NewJumpHash()
+	j.AddWeightedNodes(map[string]int{"a": 30, "b": 10, "c": 10})
+	second := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		nodes := j.GetNodes(fmt.Sprintf("key-%d", i), 3)
+		if len(nodes) != 3 {
+			t.Fatalf("GetNodes(%d, 3) = %v, want 3 nodes", i, nodes)
+		}
+		if nodes[0] != "a" {
+			second[nodes[1]]++
+		}
+	}
+	if second["a"] == 0 || second["b"] == 0 || second["c"] == 0 {
+		t.Errorf("second replicas of keys not owned by a = %v, want all nodes", second)
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Rendezvous implements rendezvous, or highest random weight (HRW), hashing.
+// Each key scores every node and goes to the node with the highest score,
+// so adding or removing a node only moves the keys that node gains or loses.
+// Lookups cost O(number of nodes) but need no precomputed table.
+//
+// Weights use the logarithmic method: the score of a node of weight w is
+// -w / ln(u), where u is a uniform hash of the key and node in (0, 1).
+type Rendezvous struct {
+	mu      sync.RWMutex
+	weights nodeWeights
+	nodes   []rendezvousNode // sorted by name
+}
+
+// rendezvousNode is a node with its precomputed hash.
+type rendezvousNode struct {
+	name   string
+	hash   uint64
+	weight float64
+}
+
+// NewRendezvous creates an empty rendezvous placement.
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{weights: make(nodeWeights)}
+}
+
+// AddNodes adds nodes with DefaultWeight.
+func (r *Rendezvous) AddNodes(nodes ...string) {
+	r.AddWeightedNodes(defaultWeights(nodes))
+}
+
+// AddWeightedNodes adds nodes that receive keys in proportion to their weight.
+func (r *Rendezvous) AddWeightedNodes(weights map[string]int) {
+	if len(weights) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.weights.add(weights)
+	r.rebuild()
+}
+
+// RemoveNode removes a node from the placement.
+func (r *Rendezvous) RemoveNode(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.weights[node]; !ok {
+		return
+	}
+	delete(r.weights, node)
+	r.rebuild()
+}
+
+// clone returns a copy of the placement.
+func (r *Rendezvous) clone() Placement {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &Rendezvous{weights: r.weights.copy(), nodes: append([]rendezvousNode(nil), r.nodes...)}
+}
+
+// rebuild recomputes the node list from the weights.
+// Caller must hold the lock.
+func (r *Rendezvous) rebuild() {
+	r.nodes = r.nodes[:0]
+	for _, name := range r.weights.sorted() {
+		r.nodes = append(r.nodes, rendezvousNode{
+			name:   name,
+			hash:   hash64(name),
+			weight: float64(r.weights[name]),
+		})
+	}
+}
+
+// GetNode returns the node with the highest score for key.
+func (r *Rendezvous) GetNode(key string) string {
+	if key == "" || r == nil {
+		return ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keyHash := hash64(key)
+	best, bestScore := "", math.Inf(-1)
+	for _, n := range r.nodes {
+		if score := n.score(keyHash); score > bestScore {
+			best, bestScore = n.name, score
+		}
+	}
+	return best
+}
+
+// GetNodes returns the n nodes with the highest scores for key, highest first.
+func (r *Rendezvous) GetNodes(key string, n int) []string {
+	if key == "" || r == nil || n <= 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keyHash := hash64(key)
+	scores := make([]float64, len(r.nodes))
+	order := make([]int, len(r.nodes))
+	for i, node := range r.nodes {
+		scores[i] = node.score(keyHash)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	nodes := make([]string, 0, min(n, len(order)))
+	for _, i := range order[:min(n, len(order))] {
+		nodes = append(nodes, r.nodes[i].name)
+	}
+	return nodes
+}
+
+// score returns the score of the node for the key with the given hash.
+func (n rendezvousNode) score(keyHash uint64) float64 {
+	// Map the combined hash to (0, 1), excluding both ends.
+	u := (float64(mix64(keyHash^n.hash)>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(u)
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ringSize is the size of the hash space of the ring, the range of Hash.
+const ringSize = 1 << 32
+
+// VirtualNode is a point on the hash ring that belongs to a real node.
+type VirtualNode struct {
+	Hash    uint32 `json:"hash"`
+	Node    string `json:"node"`
+	Replica int    `json:"replica"` // index among the virtual nodes of Node
+}
+
+// NodeOwnership describes the part of the hash ring a real node owns.
+type NodeOwnership struct {
+	Node         string  `json:"node"`
+	VirtualNodes int     `json:"virtualNodes"`
+	Share        float64 `json:"share"`    // fraction of the hash space owned, from 0 to 1
+	InFlight     int64   `json:"inFlight"` // requests counted by Acquire and not yet released
+}
+
+// KeyPlacement explains how a key is placed on the ring.
+type KeyPlacement struct {
+	Key         string      `json:"key"`
+	Hash        uint32      `json:"hash"`
+	Index       int         `json:"index"`       // position of VirtualNode on the ring
+	Wrapped     bool        `json:"wrapped"`     // the key hashed past the last virtual node
+	VirtualNode VirtualNode `json:"virtualNode"` // first virtual node clockwise from the key
+	Owner       string      `json:"owner"`       // node of VirtualNode, which GetNode returns
+}
+
+// Ring returns the virtual nodes of the ring in clockwise order.
+func (m *ConsistentMap) Ring() []VirtualNode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ring := make([]VirtualNode, len(m.keys))
+	for i := range m.keys {
+		ring[i] = m.virtualNode(i)
+	}
+	return ring
+}
+
+// Ownership returns, for each real node in order of name, its number of
+// virtual nodes, the share of the hash space it owns and its in-flight load.
+// A virtual node owns the hashes from the previous virtual node, exclusive,
+// up to its own, inclusive.
+func (m *ConsistentMap) Ownership() []NodeOwnership {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	arcs := make(map[string]int64, len(m.virtuals))
+	for i, hash := range m.keys {
+		prev := int64(m.keys[(i+len(m.keys)-1)%len(m.keys)])
+		arc := int64(hash) - prev
+		if arc <= 0 {
+			// The first virtual node also owns the hashes after the last one.
+			arc += ringSize
+		}
+		arcs[m.hashMap[hash]] += arc
+	}
+
+	ownership := make([]NodeOwnership, 0, len(m.virtuals))
+	for node, n := range m.virtuals {
+		ownership = append(ownership, NodeOwnership{
+			Node:         node,
+			VirtualNodes: n,
+			Share:        float64(arcs[node]) / ringSize,
+			InFlight:     m.loads[node].Load(),
+		})
+	}
+	sort.Slice(ownership, func(i, j int) bool { return ownership[i].Node < ownership[j].Node })
+	return ownership
+}
+
+// Explain returns where key hashes on the ring and the virtual node that
+// owns it. It reports false if the key is empty or the ring has no nodes.
+func (m *ConsistentMap) Explain(key string) (KeyPlacement, bool) {
+	if key == "" || m == nil {
+		return KeyPlacement{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return KeyPlacement{}, false
+	}
+
+	hash := m.hash([]byte(key))
+	idx := m.search(key)
+	vnode := m.virtualNode(idx)
+	return KeyPlacement{
+		Key:         key,
+		Hash:        hash,
+		Index:       idx,
+		Wrapped:     int(hash) > m.keys[len(m.keys)-1],
+		VirtualNode: vnode,
+		Owner:       vnode.Node,
+	}, true
+}
+
+// virtualNode returns the virtual node at position idx of the ring.
+// Caller must hold the lock.
+func (m *ConsistentMap) virtualNode(idx int) VirtualNode {
+	hash := m.keys[idx]
+	node := m.hashMap[hash]
+	replica := -1
+	for i := 0; i < m.virtuals[node]; i++ {
+		if int(m.hash([]byte(strconv.Itoa(i)+node))) == hash {
+			replica = i
+			break
+		}
+	}
+	return VirtualNode{Hash: uint32(hash), Node: node, Replica: replica}
+}
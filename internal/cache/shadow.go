@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"github.com/1055373165/ggcache/internal/metrics"
+)
+
+// DefaultShadowSizes are the shadow cache sizes, as multiples of the cache
+// size, used when ShadowConfig.Sizes is empty.
+var DefaultShadowSizes = []float64{0.5, 1, 2, 4}
+
+// ShadowConfig configures the shadow caches of a group.
+//
+// A shadow cache replays the gets and puts of a sample of the keys against
+// an eviction strategy of its own, storing only the size of each value. Its
+// capacity is scaled down by the sample rate, so its hit ratio estimates the
+// hit ratio the group would have with that strategy and size.
+type ShadowConfig struct {
+	SampleRate float64                 // Fraction of keys tracked, in (0, 1]
+	Sizes      []float64               // Sizes as multiples of the cache size, DefaultShadowSizes if empty
+	Strategies []eviction.EvictionType // Strategies simulated, the cache's own strategy if empty
+}
+
+// ShadowStats is the estimate of one shadow cache.
+type ShadowStats struct {
+	Strategy string  `json:"strategy"`
+	Scale    float64 `json:"scale"`
+	MaxBytes int64   `json:"maxBytes"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+// shadowValue stands in for a cached value in a shadow cache.
+type shadowValue int
+
+// Len returns the size of the value it stands for.
+func (v shadowValue) Len() int {
+	return int(v)
+}
+
+// shadowCache is a key-only copy of the cache with another strategy or size.
+type shadowCache struct {
+	strategy eviction.EvictionType
+	scale    float64
+	maxBytes int64 // Size of the cache it simulates, before sampling
+	cache    eviction.CacheStrategy
+	hits     atomic.Int64
+	misses   atomic.Int64
+}
+
+// shadowSet holds the shadow caches of a group.
+type shadowSet struct {
+	group     string
+	threshold uint64 // Keys whose hash is below threshold are sampled
+	caches    []*shadowCache
+	done      chan struct{} // closed to stop publishing the hit ratios
+	stopOnce  sync.Once
+}
+
+// shadowPublishInterval is how often the hit ratios of the shadow caches are published as metrics.
+const shadowPublishInterval = 10 * time.Second
+
+// newShadowSet builds the shadow caches described by sc for a cache built from cfg.
+func newShadowSet(group string, cfg eviction.CacheConfig, sc ShadowConfig) (*shadowSet, error) {
+	if sc.SampleRate <= 0 || sc.SampleRate > 1 {
+		return nil, fmt.Errorf("shadow sample rate must be in (0, 1], got %v", sc.SampleRate)
+	}
+	sizes := sc.Sizes
+	if len(sizes) == 0 {
+		sizes = DefaultShadowSizes
+	}
+	strategies := sc.Strategies
+	if len(strategies) == 0 {
+		strategies = []eviction.EvictionType{cfg.EvictionType}
+	}
+
+	s := &shadowSet{group: group, threshold: math.MaxUint64}
+	if sc.SampleRate < 1 {
+		s.threshold = uint64(sc.SampleRate * math.MaxUint64)
+	}
+	for _, t := range strategies {
+		if t == eviction.EvictionArena {
+			// The arena only stores byte values, so it cannot hold key-only entries.
+			s.stop()
+			return nil, fmt.Errorf("strategy %s cannot be shadowed", t)
+		}
+		for _, scale := range sizes {
+			if scale <= 0 {
+				s.stop()
+				return nil, fmt.Errorf("shadow size must be positive, got %v", scale)
+			}
+			shadowCfg := cfg
+			shadowCfg.EvictionType = t
+			shadowCfg.MaxBytes = max(int64(float64(cfg.MaxBytes)*scale*sc.SampleRate), 1)
+			if cfg.MaxEntries > 0 {
+				shadowCfg.MaxEntries = max(int(float64(cfg.MaxEntries)*scale*sc.SampleRate), 1)
+			}
+			strategy, err := eviction.NewWithConfig(shadowCfg, nil)
+			if err != nil {
+				s.stop()
+				return nil, fmt.Errorf("failed to create shadow cache: %w", err)
+			}
+			s.caches = append(s.caches, &shadowCache{
+				strategy: t,
+				scale:    scale,
+				maxBytes: int64(float64(cfg.MaxBytes) * scale),
+				cache:    strategy,
+			})
+		}
+	}
+	s.done = make(chan struct{})
+	go s.publishLoop()
+	return s, nil
+}
+
+// sampled reports whether the key is tracked by the shadow caches.
+func (s *shadowSet) sampled(key string) bool {
+	return hash64(key) <= s.threshold
+}
+
+// get records a lookup of key in every shadow cache. If the real cache
+// holds the key (cached), a shadow cache that misses it caches it with the
+// real value's size, as its own strategy would once the value was loaded,
+// since the real cache does not load it again.
+func (s *shadowSet) get(key string, size int, cached bool) {
+	if !s.sampled(key) {
+		return
+	}
+	for _, c := range s.caches {
+		if _, _, ok := c.cache.Get(key); ok {
+			c.hits.Add(1)
+			continue
+		}
+		c.misses.Add(1)
+		if cached {
+			c.cache.Put(key, shadowValue(size))
+		}
+	}
+}
+
+// publish updates the hit ratio metrics of the shadow caches.
+func (s *shadowSet) publish() {
+	for _, c := range s.caches {
+		metrics.UpdateShadowHitRatio(s.group, c.strategy.String(), strconv.FormatFloat(c.scale, 'g', -1, 64), c.hitRatio())
+	}
+}
+
+// publishLoop publishes the hit ratios every shadowPublishInterval until the set is stopped.
+func (s *shadowSet) publishLoop() {
+	ticker := time.NewTicker(shadowPublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.publish()
+		case <-s.done:
+			s.publish()
+			return
+		}
+	}
+}
+
+// put records that key was cached with a value of size bytes.
+func (s *shadowSet) put(key string, size int) {
+	if !s.sampled(key) {
+		return
+	}
+	for _, c := range s.caches {
+		c.cache.Put(key, shadowValue(size))
+	}
+}
+
+// stats returns the estimates of every shadow cache.
+func (s *shadowSet) stats() []ShadowStats {
+	stats := make([]ShadowStats, 0, len(s.caches))
+	for _, c := range s.caches {
+		stats = append(stats, ShadowStats{
+			Strategy: c.strategy.String(),
+			Scale:    c.scale,
+			MaxBytes: c.maxBytes,
+			Hits:     c.hits.Load(),
+			Misses:   c.misses.Load(),
+			HitRatio: c.hitRatio(),
+		})
+	}
+	return stats
+}
+
+// stop stops the background routines of the shadow caches.
+func (s *shadowSet) stop() {
+	if s.done != nil {
+		s.stopOnce.Do(func() { close(s.done) })
+	}
+	for _, c := range s.caches {
+		if stopper, ok := c.cache.(eviction.Stopper); ok {
+			stopper.Stop()
+		}
+	}
+}
+
+// hitRatio returns the fraction of lookups that hit, or 0 before the first lookup.
+func (c *shadowCache) hitRatio() float64 {
+	hits, misses := c.hits.Load(), c.misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+)
+
+func TestCache_Shadows(t *testing.T) {
+	c, err := NewCacheWithConfig(eviction.CacheConfig{MaxBytes: 2000, EvictionType: eviction.EvictionLRU})
+	if err != nil {
+		t.Fatalf("NewCacheWithConfig returned error: %v", err)
+	}
+	defer c.close()
+
+	if err := c.setShadows("shadow-test", ShadowConfig{
+		SampleRate: 1,
+		Sizes:      []float64{0.5, 1, 2},
+		Strategies: []eviction.EvictionType{eviction.EvictionLRU, eviction.EvictionS3FIFO},
+	}); err != nil {
+		t.Fatalf("setShadows returned error: %v", err)
+	}
+
+	const gets = 20000
+	var misses int64
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 1000)
+	for i := 0; i < gets; i++ {
+		key := fmt.Sprintf("key-%d", zipf.Uint64())
+		if _, ok := c.get(key); !ok {
+			misses++
+			c.put(key, ByteView{b: []byte("0123456789")})
+		}
+	}
+
+	stats := c.shadowStats()
+	if len(stats) != 6 {
+		t.Fatalf("shadowStats returned %d shadows, want 6", len(stats))
+	}
+	for i, s := range stats {
+		if s.Hits+s.Misses != gets {
+			t.Errorf("%s@%v recorded %d lookups, want %d", s.Strategy, s.Scale, s.Hits+s.Misses, gets)
+		}
+		// A larger cache with the same strategy never hits less often.
+		if i%3 != 0 && s.HitRatio < stats[i-1].HitRatio {
+			t.Errorf("%s@%v hit ratio %v is below %v at scale %v", s.Strategy, s.Scale, s.HitRatio, stats[i-1].HitRatio, stats[i-1].Scale)
+		}
+	}
+
+	// Sampling every key, the shadow of the cache's own strategy and size replays it exactly.
+	if stats[1].Misses != misses {
+		t.Errorf("lru@1 shadow recorded %d misses, the cache missed %d times", stats[1].Misses, misses)
+	}
+
+	if err := c.setShadows("shadow-test", ShadowConfig{}); err != nil {
+		t.Fatalf("setShadows returned error: %v", err)
+	}
+	if stats := c.shadowStats(); stats != nil {
+		t.Errorf("shadowStats after disabling = %v, want nil", stats)
+	}
+}
+
+func TestShadowSet_Sampling(t *testing.T) {
+	s, err := newShadowSet("sampling", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLFU}, ShadowConfig{SampleRate: 0.1})
+	if err != nil {
+		t.Fatalf("newShadowSet returned error: %v", err)
+	}
+	defer s.stop()
+
+	sampled := 0
+	for i := 0; i < 100000; i++ {
+		if s.sampled(fmt.Sprintf("key-%d", i)) {
+			sampled++
+		}
+	}
+	if sampled < 9000 || sampled > 11000 {
+		t.Errorf("sampled %d of 100000 keys, want about 10000", sampled)
+	}
+
+	if _, err := newShadowSet("arena", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionArena}, ShadowConfig{SampleRate: 0.1}); err == nil {
+		t.Error("newShadowSet should reject the arena strategy")
+	}
+}
+
+func TestShadowSet_RefillsOnMiss(t *testing.T) {
+	s, err := newShadowSet("refill", eviction.CacheConfig{MaxBytes: 100, EvictionType: eviction.EvictionFIFO}, ShadowConfig{SampleRate: 1, Sizes: []float64{0.1}})
+	if err != nil {
+		t.Fatalf("newShadowSet returned error: %v", err)
+	}
+	defer s.stop()
+
+	// The shadow holds 10 bytes, so caching b evicts a, which the real cache still holds.
+	s.put("a", 5)
+	s.put("b", 5)
+	s.get("a", 5, true)
+	s.get("a", 5, true)
+	if st := s.stats()[0]; st.Hits != 1 || st.Misses != 1 {
+		t.Errorf("shadow recorded %d hits and %d misses, want the miss to cache a again", st.Hits, st.Misses)
+	}
+
+	// A key the real cache misses is left for the load to put.
+	s.get("c", 0, false)
+	s.get("c", 0, false)
+	if st := s.stats()[0]; st.Misses != 3 {
+		t.Errorf("shadow recorded %d misses, want 3", st.Misses)
+	}
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1055373165/ggcache/config"
+	"github.com/1055373165/ggcache/pkg/common/logger"
+	"google.golang.org/grpc/credentials"
+)
+
+// defaultTLSReloadInterval is how often certificate files are checked for changes.
+const defaultTLSReloadInterval = 30 * time.Second
+
+// TLSConfig configures TLS for the traffic of a server and its clients.
+// With ClientAuth set, servers require client certificates and clients
+// present CertFile: mutual TLS. The files are read again when they change,
+// so certificates can be rotated without a restart.
+type TLSConfig struct {
+	Enabled        bool
+	CertFile       string        // PEM certificate presented to the other side
+	KeyFile        string        // PEM private key of CertFile
+	CAFile         string        // PEM certificates of the CAs verifying the other side, the system roots if empty
+	ClientAuth     bool          // require and verify client certificates
+	ServerName     string        // name verified in server certificates, the dialed host if empty
+	ReloadInterval time.Duration // how often the files are checked for changes, 30s if zero
+}
+
+// TLSConfigFromConf converts a TLS section of the configuration.
+// A missing section disables TLS.
+func TLSConfigFromConf(tc *config.TLSOptions) TLSConfig {
+	if tc == nil {
+		return TLSConfig{}
+	}
+	return TLSConfig{
+		Enabled:        tc.Enabled,
+		CertFile:       tc.CertFile,
+		KeyFile:        tc.KeyFile,
+		CAFile:         tc.CAFile,
+		ClientAuth:     tc.ClientAuth,
+		ServerName:     tc.ServerName,
+		ReloadInterval: tc.ReloadInterval,
+	}
+}
+
+// configs returns the TLS configurations of the servers and of the clients,
+// both nil if TLS is disabled.
+func (c TLSConfig) configs() (server *tls.Config, client *tls.Config, err error) {
+	if !c.Enabled {
+		return nil, nil, nil
+	}
+	if c.CertFile == "" {
+		return nil, nil, errors.New("tls: certFile and keyFile are required to serve TLS")
+	}
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.serverConfig(), r.clientConfig(), nil
+}
+
+// ClientTLS returns the TLS configuration of clients of a server configured
+// with c, or nil if TLS is disabled. Clients only need a certificate if the
+// server requires one.
+func (c TLSConfig) ClientTLS() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, err
+	}
+	return r.clientConfig(), nil
+}
+
+// ClientCredentials returns the gRPC credentials of clients of a server
+// configured with c, or nil if TLS is disabled.
+func (c TLSConfig) ClientCredentials() (credentials.TransportCredentials, error) {
+	cfg, err := c.ClientTLS()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// certReloader holds the certificate and CAs read from the files of a
+// TLSConfig, and reads them again when the files change.
+type certReloader struct {
+	cfg      TLSConfig
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate // nil if no certificate is configured
+	pool    *x509.CertPool   // nil if the system roots apply
+	stamp   string           // modification times and sizes of the files read
+	checked time.Time
+}
+
+// newCertReloader reads the files of cfg.
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("tls: certFile and keyFile must be set together")
+	}
+	if cfg.ClientAuth && cfg.CertFile == "" {
+		return nil, errors.New("tls: clientAuth requires certFile and keyFile")
+	}
+	r := &certReloader{cfg: cfg, interval: cfg.ReloadInterval}
+	if r.interval <= 0 {
+		r.interval = defaultTLSReloadInterval
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the files. Caller must hold the lock or own r exclusively.
+func (r *certReloader) load() error {
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return err
+	}
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("tls: loading certificate: %w", err)
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("tls: reading CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates found in %s", r.cfg.CAFile)
+		}
+	}
+	r.cert, r.pool, r.stamp, r.checked = cert, pool, stamp, time.Now()
+	return nil
+}
+
+// fileStamp describes the versions of the files, changing when any of them is rewritten.
+func (r *certReloader) fileStamp() (string, error) {
+	var stamp string
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", fmt.Errorf("tls: %w", err)
+		}
+		stamp += fmt.Sprintf("%d/%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+	return stamp, nil
+}
+
+// current returns the certificate and CAs, read again first if the reload
+// interval passed and the files changed. A failed reload keeps the
+// previous ones, so that a half-written rotation does not break handshakes.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= r.interval {
+		r.checked = time.Now()
+		if stamp, err := r.fileStamp(); err != nil || stamp != r.stamp {
+			if err == nil {
+				err = r.load()
+			}
+			if err != nil {
+				logger.LogrusObj.Warnf("keeping the current TLS certificate: %v", err)
+			} else {
+				logger.LogrusObj.Infof("reloaded TLS certificate %s", r.cfg.CertFile)
+			}
+		}
+	}
+	return r.cert, r.pool
+}
+
+// serverConfig returns the configuration of servers, which present the
+// current certificate and verify client certificates against the current CAs
+// if ClientAuth is set.
+func (r *certReloader) serverConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+	if r.cfg.ClientAuth {
+		// The chain is verified by VerifyConnection, against the CAs current at the handshake.
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyChain(cs.PeerCertificates, x509.VerifyOptions{
+				Roots:     pool,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+		}
+	}
+	return cfg
+}
+
+// clientConfig returns the configuration of clients, which verify server
+// certificates against the current CAs and present the current certificate
+// if ClientAuth is set.
+func (r *certReloader) clientConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+	}
+	if r.cfg.ClientAuth {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+	if r.cfg.CAFile != "" {
+		// The default verification would use the CAs read at startup, so
+		// the chain is verified by VerifyConnection instead.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyChain(cs.PeerCertificates, x509.VerifyOptions{
+				Roots:   pool,
+				DNSName: cs.ServerName,
+			})
+		}
+	}
+	return cfg
+}
+
+// verifyChain verifies the certificate chain presented by the other side of a connection.
+func verifyChain(chain []*x509.Certificate, opts x509.VerifyOptions) error {
+	if len(chain) == 0 {
+		return errors.New("tls: no certificate presented")
+	}
+	opts.Intermediates = x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(opts)
+	return err
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/1055373165/ggcache/api/groupcachepb"
+	"github.com/1055373165/ggcache/internal/cache/eviction"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// testCA is a self-signed CA issuing certificates for 127.0.0.1.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // PEM file of cert
+}
+
+// newTestCA creates a CA and writes its certificate to dir.
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, file: filepath.Join(dir, name+".pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue writes a certificate for 127.0.0.1 with serial, signed by the CA,
+// and its key to dir, replacing any issued before, and returns the TLSConfig using them.
+func (ca *testCA) issue(t *testing.T, dir string, serial int64) TLSConfig {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	cfg := TLSConfig{
+		Enabled:  true,
+		CertFile: filepath.Join(dir, "node.pem"),
+		KeyFile:  filepath.Join(dir, "node-key.pem"),
+		CAFile:   ca.file,
+	}
+	writePEM(t, cfg.CertFile, "CERTIFICATE", der)
+	writePEM(t, cfg.KeyFile, "EC PRIVATE KEY", keyDER)
+	return cfg
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func TestTLS_MutualGRPC(t *testing.T) {
+	ca := newTestCA(t, t.TempDir(), "ca")
+	cfg := ca.issue(t, t.TempDir(), 2)
+	cfg.ClientAuth = true
+	serverTLS, clientTLS, err := cfg.configs()
+	if err != nil {
+		t.Fatalf("configs returned error: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverTLS)))
+	pb.RegisterGroupCacheServer(grpcServer, &addrServer{addr: lis.Addr().String()})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	client, err := NewClient(lis.Addr().String(), ClientConfig{TLS: clientTLS})
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Fetch("group", "key"); err != nil {
+		t.Errorf("Fetch over mutual TLS returned error: %v", err)
+	}
+
+	// Without a client certificate the server refuses the connection.
+	anonymous, _ := TLSConfig{Enabled: true, CAFile: ca.file}.ClientTLS()
+	client, _ = NewClient(lis.Addr().String(), ClientConfig{TLS: anonymous})
+	defer client.Close()
+	if _, err := client.Fetch("group", "key"); err == nil {
+		t.Error("Fetch without a client certificate should fail")
+	}
+
+	// A server certificate from another CA is not trusted.
+	other := newTestCA(t, t.TempDir(), "other")
+	untrusting, _ := TLSConfig{Enabled: true, CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, CAFile: other.file, ClientAuth: true}.ClientTLS()
+	client, _ = NewClient(lis.Addr().String(), ClientConfig{TLS: untrusting})
+	defer client.Close()
+	if _, err := client.Fetch("group", "key"); err == nil {
+		t.Error("Fetch from a server of an untrusted CA should fail")
+	}
+}
+
+func TestTLS_HTTPPool(t *testing.T) {
+	NewGroupWithConfig("tls-pool", eviction.CacheConfig{MaxBytes: 1 << 20, EvictionType: eviction.EvictionLRU},
+		RetrieveFunc(func(key string) ([]byte, error) {
+			return []byte("db-" + key), nil
+		}))
+	t.Cleanup(func() { DestroyGroup("tls-pool") })
+
+	ca := newTestCA(t, t.TempDir(), "ca")
+	cfg := ca.issue(t, t.TempDir(), 2)
+	cfg.ClientAuth = true
+
+	pool := NewHTTPPool("self")
+	if err := pool.SetTLSConfig(cfg); err != nil {
+		t.Fatalf("SetTLSConfig returned error: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: pool, TLSConfig: pool.serverTLSConfig()}
+	go srv.ServeTLS(lis, "", "")
+	defer srv.Close()
+
+	peer := "http://" + lis.Addr().String()
+	pool.UpdatePeers(peer)
+	value, err := pool.fetcherMap[peer].Fetch("tls-pool", "k")
+	if err != nil {
+		t.Fatalf("Fetch over HTTPS returned error: %v", err)
+	}
+	if string(value) != "db-k" {
+		t.Errorf("Fetch = %q, want %q", value, "db-k")
+	}
+
+	plain := newHTTPFetcher(peer+defaultBasePath, DefaultClientConfig.httpClient(), DefaultClientConfig)
+	if _, err := plain.Fetch("tls-pool", "k"); err == nil {
+		t.Error("Fetch over plain HTTP from a TLS pool should fail")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	cfg := ca.issue(t, dir, 2)
+	cfg.ReloadInterval = time.Millisecond
+
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("newCertReloader returned error: %v", err)
+	}
+	serial := func() int64 {
+		cert, _ := r.current()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if got := serial(); got != 2 {
+		t.Fatalf("serial = %d, want 2", got)
+	}
+
+	// A rotated certificate is picked up without a restart.
+	ca.issue(t, dir, 3)
+	time.Sleep(5 * time.Millisecond)
+	if got := serial(); got != 3 {
+		t.Errorf("serial after rotation = %d, want 3", got)
+	}
+
+	// A broken certificate file keeps the current certificate.
+	if err := os.WriteFile(cfg.CertFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if got := serial(); got != 3 {
+		t.Errorf("serial after a broken rotation = %d, want 3", got)
+	}
+}
@@ -108,6 +108,119 @@ var (
 		},
 	})
 
+	// LRU batch 淘汰指标
+	lruBatchEvictionSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ggcache_lru_batch_eviction_size",
+		Help:    "Number of entries removed by each LRU batch eviction",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12), // from 1 to 2048
+		ConstLabels: prometheus.Labels{
+			"instance": instanceName,
+		},
+	})
+
+	// Shadow cache estimates
+	shadowHitRatio = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ggcache_shadow_hit_ratio",
+			Help: "Estimated hit ratio of a group with another eviction strategy or cache size",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"group", "strategy", "scale"},
+	)
+
+	// Membership changes applied to the hash ring
+	ringEpoch = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ggcache_ring_epoch",
+		Help: "Number of membership changes applied to the hash ring",
+		ConstLabels: prometheus.Labels{
+			"instance": instanceName,
+		},
+	})
+
+	// Entries handed off between peers when the peers change
+	handoffEntries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ggcache_handoff_entries_total",
+			Help: "Number of cache entries handed off to or accepted from other peers",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"direction"},
+	)
+
+	// Compression of cached values
+	compressionBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ggcache_compression_bytes_total",
+			Help: "Bytes of the values compressed by a group before (raw) and after (compressed) compression",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"group", "codec", "stage"},
+	)
+
+	compressionRatio = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ggcache_compression_ratio",
+			Help:    "Compressed size of each value compressed by a group as a fraction of its raw size",
+			Buckets: prometheus.LinearBuckets(0.1, 0.1, 10), // from 0.1 to 1
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"group", "codec"},
+	)
+
+	// Circuit breakers of the peers
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ggcache_peer_breaker_state",
+			Help: "State of the circuit breaker of each peer: 0 closed, 1 half-open, 2 open (ejected)",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"peer"},
+	)
+
+	breakerTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ggcache_peer_breaker_transitions_total",
+			Help: "Number of times the circuit breaker of each peer entered each state",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"peer", "state"},
+	)
+
+	// Hedged and retried peer fetches
+	hedgedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ggcache_hedged_requests_total",
+			Help: "Number of hedges and retries of peer fetches sent, denied by the budget, or answering first",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"group", "kind", "outcome"},
+	)
+
+	hedgeDelay = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ggcache_hedge_delay_seconds",
+			Help: "Time a group waits for a peer before hedging its fetch",
+			ConstLabels: prometheus.Labels{
+				"instance": instanceName,
+			},
+		},
+		[]string{"group"},
+	)
+
 	// 请求延迟指标
 	requestDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -165,6 +278,15 @@ func RecordEviction() {
 	cacheEvictions.Inc()
 }
 
+// RecordBatchEviction records a batch eviction that removed n entries
+func RecordBatchEviction(n int) {
+	if n <= 0 {
+		return
+	}
+	cacheEvictions.Add(float64(n))
+	lruBatchEvictionSize.Observe(float64(n))
+}
+
 // UpdateCacheSize 更新缓存大小（字节）
 func UpdateCacheSize(size int64) {
 	cacheSize.Set(float64(size))
@@ -184,6 +306,59 @@ func UpdateARCMetrics(t1Size, t2Size, b1Size, b2Size, targetSize int) {
 	arcTargetSize.Set(float64(targetSize))
 }
 
+// UpdateShadowHitRatio sets the estimated hit ratio of a group's shadow cache
+// using strategy at scale times the cache size
+func UpdateShadowHitRatio(group, strategy, scale string, ratio float64) {
+	shadowHitRatio.WithLabelValues(group, strategy, scale).Set(ratio)
+}
+
+// UpdateRingEpoch sets the epoch of the hash ring
+func UpdateRingEpoch(epoch uint64) {
+	ringEpoch.Set(float64(epoch))
+}
+
+// RecordHandoff records n entries handed off in the given direction, "sent" or "accepted"
+func RecordHandoff(direction string, n int) {
+	if n <= 0 {
+		return
+	}
+	handoffEntries.WithLabelValues(direction).Add(float64(n))
+}
+
+// ObserveCompression records a value of raw bytes compressed to compressed
+// bytes by group with codec
+func ObserveCompression(group, codec string, raw, compressed int) {
+	if raw <= 0 {
+		return
+	}
+	compressionBytes.WithLabelValues(group, codec, "raw").Add(float64(raw))
+	compressionBytes.WithLabelValues(group, codec, "compressed").Add(float64(compressed))
+	compressionRatio.WithLabelValues(group, codec).Observe(float64(compressed) / float64(raw))
+}
+
+// RecordBreakerState records the circuit breaker of peer entering state,
+// whose gauge value is value
+func RecordBreakerState(peer, state string, value int) {
+	breakerState.WithLabelValues(peer).Set(float64(value))
+	breakerTransitions.WithLabelValues(peer, state).Inc()
+}
+
+// DeleteBreakerState removes the circuit breaker gauge of a peer that left
+func DeleteBreakerState(peer string) {
+	breakerState.DeleteLabelValues(peer)
+}
+
+// RecordHedge records a hedge or retry of a peer fetch of group with its
+// outcome: "sent", "denied" or "won"
+func RecordHedge(group, kind, outcome string) {
+	hedgedRequests.WithLabelValues(group, kind, outcome).Inc()
+}
+
+// UpdateHedgeDelay sets the time group waits for a peer before hedging
+func UpdateHedgeDelay(group string, seconds float64) {
+	hedgeDelay.WithLabelValues(group).Set(seconds)
+}
+
 // ObserveRequestDuration records the duration of a cache operation
 func ObserveRequestDuration(operation string, duration float64) {
 	requestDuration.WithLabelValues(operation, instanceName).Observe(duration)
@@ -45,7 +45,7 @@ func main() {
 	serviceAddr := fmt.Sprintf("localhost:%d", *port)
 	gm := cache.NewGroupManager([]string{"scores", "website"}, serviceAddr)
 
-	updateChan := make(chan struct{})
+	updateChan := make(chan struct{}, 1)
 	svr, err := cache.NewServer(updateChan, serviceAddr)
 	if err != nil {
 		logger.LogrusObj.Errorf("acquire grpc server instance failed, %v", err)
@@ -54,13 +54,43 @@ func main() {
 
 	go discovery.DynamicServices(updateChan, config.Conf.Services["groupcache"].Name)
 
-	peers, err := discovery.ListServicePeers(config.Conf.Services["groupcache"].Name)
+	peers, err := discovery.ListServiceWeights(config.Conf.Services["groupcache"].Name)
 	if err != nil {
 		logger.LogrusObj.Fatalf("failed to discover peers: %v", err)
 		return
 	}
 
-	svr.SetPeers(peers)
+	if err := svr.SetPlacement(config.Conf.Services["groupcache"].Placement); err != nil {
+		logger.LogrusObj.Errorf("invalid placement, using %s: %v", cache.DefaultPlacement, err)
+	}
+	svr.SetLoadBound(config.Conf.Services["groupcache"].LoadBound)
+	if d := config.Conf.Services["groupcache"].UpdateDebounce; d != 0 {
+		svr.SetUpdateDebounce(d)
+	}
+	if h := config.Conf.Services["groupcache"].Handoff; h != nil {
+		svr.SetHandoff(cache.HandoffConfig{
+			Enabled:          h.Enabled,
+			EntriesPerSecond: h.EntriesPerSecond,
+			BytesPerSecond:   h.BytesPerSecond,
+			MaxEntries:       h.MaxEntries,
+		})
+	}
+	svr.SetClientConfig(cache.ClientConfigFromConf(config.Conf.PeerClient))
+	if config.Conf.PeerClient != nil {
+		svr.SetBreaker(cache.BreakerConfigFromConf(config.Conf.PeerClient.Breaker))
+	}
+	if config.Conf.TLS != nil {
+		if err := svr.SetTLSConfig(cache.TLSConfigFromConf(config.Conf.TLS.Peer)); err != nil {
+			logger.LogrusObj.Fatalf("invalid peer TLS config: %v", err)
+		}
+	}
+	auth, err := cache.AuthFromConf(config.Conf.Auth)
+	if err != nil {
+		logger.LogrusObj.Fatalf("invalid auth config: %v", err)
+	}
+	svr.SetAuth(auth)
+	svr.SetWeightedPeers(peers)
+	svr.SetWeight(config.Conf.Services["groupcache"].Weight)
 
 	gm["scores"].RegisterServer(svr)
 
@@ -11,39 +11,61 @@ import (
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"go.etcd.io/etcd/client/v3/naming/resolver"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-// Returns a client connection (established) to the specified server.
-func Discovery(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
+// Returns a client connection (established) to the specified server,
+// secured by creds, or in plaintext if creds is nil.
+func Discovery(c *clientv3.Client, service string, creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
 	etcdResolver, err := resolver.NewBuilder(c)
 	if err != nil {
 		return nil, err
 	}
 
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+
 	// Note that the name of the service here must be consistent
 	// with the name of the service when it is registered.
 	return grpc.NewClient("etcd:///"+service,
 		grpc.WithResolvers(etcdResolver),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
 }
 
 // Go to the service registration center to find a list of
 // available service nodes based on the service name.
 func ListServicePeers(serviceName string) ([]string, error) {
+	weights, err := ListServiceWeights(serviceName)
+	if err != nil {
+		return []string{}, err
+	}
+
+	peersAddr := make([]string, 0, len(weights))
+	for addr := range weights {
+		peersAddr = append(peersAddr, addr)
+	}
+	return peersAddr, nil
+}
+
+// ListServiceWeights finds the available service nodes based on the service name
+// and returns the weight each node registered with, keyed by address.
+func ListServiceWeights(serviceName string) (map[string]int, error) {
 	cli, err := clientv3.New(config.DefaultEtcdConfig)
 	if err != nil {
 		logger.LogrusObj.Errorf("failed to connected to etcd, error: %v", err)
-		return []string{}, err
+		return nil, err
 	}
+	defer cli.Close()
 
 	// Endpoints are actually ip:port combinations, which can also be regarded as socket in Unix.
 	// An endpoint manager stores both an etcd client object and the name of the requested service.
 	endpointsManager, err := endpoints.NewManager(cli, serviceName)
 	if err != nil {
 		logger.LogrusObj.Errorf("create endpoints manager failed, %v", err)
-		return []string{}, err
+		return nil, err
 	}
 
 	// List returns all endpoints of the current service in the form of a map.
@@ -53,20 +75,25 @@ func ListServicePeers(serviceName string) ([]string, error) {
 	Key2EndpointMap, err := endpointsManager.List(ctx)
 	if err != nil {
 		logger.LogrusObj.Errorf("list endpoint nodes for target service failed, error: %s", err.Error())
-		return []string{}, err
+		return nil, err
 	}
 
-	var peersAddr []string
+	weights := make(map[string]int, len(Key2EndpointMap))
 	for key, endpoint := range Key2EndpointMap {
-		peersAddr = append(peersAddr, endpoint.Addr) // Addr is the server address on which a connection will be established.
+		// Addr is the server address on which a connection will be established.
+		weights[endpoint.Addr] = ParseWeight(endpoint.Metadata)
 		logger.LogrusObj.Infof("found endpoint addr: %s (%s):(%v)", key, endpoint.Addr, endpoint.Metadata)
 	}
 
-	return peersAddr, nil
+	return weights, nil
 }
 
 // DynamicServices provides the ability to dynamically build global hash views
 // for the cache system and allowing for second-level view convergence.
+//
+// It sends at most one signal per batch of watch events, and none while a
+// signal is still pending in update, which should have a buffer of one:
+// the receiver lists the current peers, so one signal covers every change.
 func DynamicServices(update chan struct{}, service string) {
 	cli, err := clientv3.New(config.DefaultEtcdConfig)
 	if err != nil {
@@ -84,15 +111,26 @@ func DynamicServices(update chan struct{}, service string) {
 	// Each time a user adds or removes a new instance address to a given service, the watchChan backend daemon
 	// can scan for changes in the number of instances via WithPrefix() and return them as watchResp.Events events.
 	for watchResp := range watchChan {
+		changed := false
 		for _, ev := range watchResp.Events {
 			switch ev.Type {
 			case clientv3.EventTypePut:
-				update <- struct{}{} //When a change occurs, send a signal to update channel telling endpoint manager to rebuild the hash map.
+				changed = true
 				logger.LogrusObj.Warnf("Service endpoint added or updated: %s", string(ev.Kv.Value))
 			case clientv3.EventTypeDelete:
-				update <- struct{}{} //When a change occurs, send a signal to update channel telling endpoint manager to rebuild the hash map.
+				changed = true
 				logger.LogrusObj.Warnf("Service endpoint removed: %s", string(ev.Kv.Key))
 			}
 		}
+		if !changed {
+			continue
+		}
+
+		// When a change occurs, send a signal to update channel telling endpoint manager to update the hash map.
+		select {
+		case update <- struct{}{}:
+		default:
+			logger.LogrusObj.Debugf("Service %s update already pending", service)
+		}
 	}
 }
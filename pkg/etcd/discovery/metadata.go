@@ -0,0 +1,50 @@
+package discovery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultWeight is the weight of endpoints registered without one or
+	// whose metadata does not carry a valid weight.
+	DefaultWeight = 10
+
+	// MaxWeight is the largest weight an endpoint registers or is read
+	// with; larger weights are capped to it.
+	MaxWeight = 1000
+
+	// version is the endpoint version advertised in the metadata.
+	version = "v1.0.0"
+)
+
+// formatMetadata encodes the weight and version of an endpoint as "weight:{weight};version:{version}".
+func formatMetadata(weight int) string {
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+	weight = min(weight, MaxWeight)
+	return fmt.Sprintf("weight:%d;version:%s", weight, version)
+}
+
+// ParseWeight extracts the weight from endpoint metadata of the form
+// "weight:{weight};version:{version}". It returns DefaultWeight if the
+// metadata is not a string or carries no positive weight, and caps the
+// weight at MaxWeight.
+func ParseWeight(metadata interface{}) int {
+	s, ok := metadata.(string)
+	if !ok {
+		return DefaultWeight
+	}
+	for _, field := range strings.Split(s, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(field), ":")
+		if !found || name != "weight" {
+			continue
+		}
+		if weight, err := strconv.Atoi(value); err == nil && weight > 0 {
+			return min(weight, MaxWeight)
+		}
+	}
+	return DefaultWeight
+}
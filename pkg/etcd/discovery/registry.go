@@ -12,9 +12,10 @@ import (
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
 )
 
-// Register registers the {addr} for the specified {service}. During normal service provision, this function will not return.
+// Register registers the {addr} for the specified {service} with the given {weight}, which decides the share of keys
+// the node receives; a non-positive weight registers DefaultWeight. During normal service provision, this function will not return.
 // This is returned only when the 1. application is stopped 2. the lease renewal fails 3. the etcd connection is lost.
-func Register(service string, addr string, stop chan error) error {
+func Register(service string, addr string, weight int, stop chan error) error {
 	cli, err := clientv3.New(config.DefaultEtcdConfig)
 	if err != nil {
 		logger.LogrusObj.Fatalf("err: %v", err)
@@ -34,7 +35,7 @@ func Register(service string, addr string, stop chan error) error {
 
 	// Associate the service address with the lease and delete the service address information from etcd when the lease expires.
 	// If a service address wants to continue to provide services, it needs to renew the lease, which is also called lease keepalive.
-	err = etcdAddEndpoint(cli, leaseId, service, addr)
+	err = etcdAddEndpoint(cli, leaseId, service, addr, weight)
 	if err != nil {
 		return fmt.Errorf("failed to add services as endpoint to etcd endpoint Manager: %v", err)
 	}
@@ -73,8 +74,8 @@ func Register(service string, addr string, stop chan error) error {
 
 // The registration information for the service endpoint is stored in etcd as a key value.
 // the form of key is {service}/{addr},
-// the form of value is {addr, metadata}.
-func etcdAddEndpoint(client *clientv3.Client, leaseId clientv3.LeaseID, service string, addr string) error {
+// the form of value is {addr, metadata}, where metadata is "weight:{weight};version:{version}".
+func etcdAddEndpoint(client *clientv3.Client, leaseId clientv3.LeaseID, service string, addr string, weight int) error {
 	endpointsManager, err := endpoints.NewManager(client, service)
 	if err != nil {
 		return err
@@ -83,7 +84,7 @@ func etcdAddEndpoint(client *clientv3.Client, leaseId clientv3.LeaseID, service
 	// Use string metadata to ensure comparability.
 	metadata := endpoints.Endpoint{
 		Addr:     addr,
-		Metadata: "weight:10;version:v1.0.0",
+		Metadata: formatMetadata(weight),
 	}
 
 	// Addr is the server address on which a connection will be established.
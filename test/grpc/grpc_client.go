@@ -11,6 +11,7 @@ import (
 	pb "github.com/1055373165/ggcache/api/groupcachepb"
 	"github.com/1055373165/ggcache/config"
 	"github.com/1055373165/ggcache/internal/bussiness/student/dao"
+	"github.com/1055373165/ggcache/internal/cache"
 	"github.com/1055373165/ggcache/pkg/common/logger"
 	discovery "github.com/1055373165/ggcache/pkg/etcd/discovery"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -56,7 +57,16 @@ func (c *GGCacheClient) connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	conn, err := discovery.Discovery(c.etcdCli, c.serviceName)
+	var peerTLS *config.TLSOptions
+	if config.Conf.TLS != nil {
+		peerTLS = config.Conf.TLS.Peer
+	}
+	creds, err := cache.TLSConfigFromConf(peerTLS).ClientCredentials()
+	if err != nil {
+		return fmt.Errorf("invalid TLS config: %v", err)
+	}
+
+	conn, err := discovery.Discovery(c.etcdCli, c.serviceName, creds)
 	if err != nil {
 		return fmt.Errorf("failed to discover service: %v", err)
 	}
@@ -228,6 +238,10 @@ func main() {
 				logger.LogrusObj.Errorf("查询学生 %s 分数失败: %v", name, err)
 				return // 如果不是 NotFound 错误，直接退出程序
 			}
+			if resp.GetNotFound() {
+				logger.LogrusObj.Warnf("查询不到学生 %s 的成绩", name)
+				continue
+			}
 			logger.LogrusObj.Infof("查询成功, 学生 %s 的成绩为 %s", name, string(resp.Value))
 		}
 		time.Sleep(time.Millisecond * 100)